@@ -6,26 +6,38 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/dispatcher"
 	"ibuddy_bot/internal/handlers/admin"
 	"ibuddy_bot/internal/handlers/user"
 	"ibuddy_bot/internal/middleware"
+	"ibuddy_bot/internal/ratelimit"
 	"ibuddy_bot/internal/storage/mongodb"
+	"ibuddy_bot/internal/tools"
+	"ibuddy_bot/pkg/anthropicclient"
+	"ibuddy_bot/pkg/llm"
 	"ibuddy_bot/pkg/openaiclient"
 	"ibuddy_bot/pkg/tgbotclient"
 )
 
 const (
-	telegramTokenEnvName = "TELEGRAM_TOKEN"
-	chatgptKeyEnvName    = "CHATGPT_KEY"
-	mongoDbUri           = "MONGODB_URI"
-	debugEnvName         = "DEBUG"
-	adminUserEnvName     = "ADMIN_USER"
-
-	workerCount = 3
+	telegramTokenEnvName  = "TELEGRAM_TOKEN"
+	chatgptKeyEnvName     = "CHATGPT_KEY"
+	anthropicKeyEnvName   = "ANTHROPIC_KEY"
+	mongoDbUri            = "MONGODB_URI"
+	debugEnvName          = "DEBUG"
+	adminUserEnvName      = "ADMIN_USER"
+	visionModelEnvName    = "VISION_MODEL"
+	endpointsFileEnvName  = "LLM_ENDPOINTS_FILE"
+	workerCountEnvName    = "WORKER_COUNT"
+	rateLimitsFileEnvName = "RATE_LIMITS_FILE"
+
+	defaultWorkerCount = 3
 )
 
 func main() {
@@ -37,10 +49,64 @@ func main() {
 
 	telegramToken := os.Getenv(telegramTokenEnvName)
 	chatgptKey := os.Getenv(chatgptKeyEnvName)
+	anthropicKey := os.Getenv(anthropicKeyEnvName)
 	mongodbUri := os.Getenv(mongoDbUri)
 	debug := os.Getenv(debugEnvName) == "true"
 	adminUser := os.Getenv(adminUserEnvName)
-	openAiClient := openaiclient.NewOpenAiClient(chatgptKey)
+	visionModel := os.Getenv(visionModelEnvName)
+	endpointsFile := os.Getenv(endpointsFileEnvName)
+	rateLimitsFile := os.Getenv(rateLimitsFileEnvName)
+	workerCount, err := strconv.Atoi(os.Getenv(workerCountEnvName))
+
+	if err != nil || workerCount < 1 {
+		workerCount = defaultWorkerCount
+	}
+
+	if visionModel == "" {
+		visionModel = openai.GPT4VisionPreview
+	}
+
+	var routes []llm.ModelRoute
+
+	providers := map[string]llm.LLM{llm.ProviderOpenAI: openaiclient.NewOpenAiClient(chatgptKey)}
+
+	if anthropicKey != "" {
+		providers[llm.ProviderAnthropic] = anthropicclient.NewAnthropicClient(anthropicKey)
+	}
+
+	if endpointsFile != "" {
+		endpoints, err := openaiclient.LoadEndpoints(endpointsFile)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, endpoint := range endpoints.Endpoints {
+			providers[endpoint.Name], err = openaiclient.NewEndpointClient(endpoint)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		routes = endpoints.Models
+	}
+
+	for name, provider := range providers {
+		providers[name] = llm.NewResilient(name, provider)
+	}
+
+	rateLimits := ratelimit.DefaultTiers
+
+	if rateLimitsFile != "" {
+		rateLimits, err = ratelimit.Load(rateLimitsFile)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	llmRouter := llm.NewRouter(providers, routes)
 	tgBotClient, err := tgbotclient.NewTgBotClient(telegramToken, debug)
 
 	if err != nil {
@@ -62,29 +128,29 @@ func main() {
 
 	log.Printf("Authorized on account %s", tgBotClient.Self.UserName)
 
-	adminHandler := admin.NewHandler(tgBotClient, openAiClient, storage)
-	userHandler := user.NewHandler(tgBotClient, openAiClient, storage)
+	adminHandler := admin.NewHandler(tgBotClient, llmRouter, storage, rateLimits)
+	toolRegistry := tools.NewRegistry(
+		tools.Calculator{},
+		tools.DateTime{},
+		tools.UnitConverter{},
+		tools.ImageGenerator{Client: llmRouter, Model: openai.CreateImageModelDallE3},
+		tools.NewURLFetcher(),
+	)
+	userHandler := user.NewHandler(tgBotClient, llmRouter, storage, visionModel, toolRegistry)
 
 	adminMiddleware := middleware.AdminMiddleware(adminHandler, userHandler)
-	banCheckMiddleware := middleware.BanCheckMiddleware(tgBotClient, adminMiddleware)
+	rateLimitMiddleware := middleware.RateLimitMiddleware(tgBotClient, storage, rateLimits, adminMiddleware)
+	banCheckMiddleware := middleware.BanCheckMiddleware(tgBotClient, rateLimitMiddleware)
 	currentUserMiddleware := middleware.CurrentUserMiddleware(storage, adminUser, banCheckMiddleware)
+	groupMiddleware := middleware.GroupMiddleware(tgBotClient, currentUserMiddleware)
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 	updateChan := tgBotClient.GetUpdatesChan(u)
 
-	for i := 0; i < workerCount; i++ {
-		go func(ctx context.Context) {
-			for {
-				select {
-				case update := <-updateChan:
-					currentUserMiddleware(ctx, &update)
-				case <-ctx.Done():
-					return
-				}
-			}
-		}(ctx)
-	}
+	updateDispatcher := dispatcher.New(workerCount, groupMiddleware, user.IsStopCommand)
+
+	go updateDispatcher.Run(ctx, updateChan)
 
 	quitChannel := make(chan os.Signal, 1)
 	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,106 @@
+package dispatcher
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// queueSize is the number of updates a worker can fall behind before the dispatch waits for it.
+const queueSize = 100
+
+// Dispatcher hands all the updates of a conversation to the same worker, so they are handled in the
+// order they arrive while different conversations are handled in parallel. Urgent updates, like a
+// command stopping the update being handled, skip the queue.
+type Dispatcher struct {
+	workers int
+	handle  func(context.Context, *tgbotapi.Update)
+	urgent  func(*tgbotapi.Update) bool
+}
+
+func New(
+	workers int,
+	handle func(context.Context, *tgbotapi.Update),
+	urgent func(*tgbotapi.Update) bool,
+) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Dispatcher{workers: workers, handle: handle, urgent: urgent}
+}
+
+// Run dispatches the updates until the context is done or the updates channel is closed, in which case
+// the workers still handle the updates already queued.
+func (d *Dispatcher) Run(ctx context.Context, updates tgbotapi.UpdatesChannel) {
+	queues := make([]chan tgbotapi.Update, d.workers)
+
+	for i := range queues {
+		queues[i] = make(chan tgbotapi.Update, queueSize)
+
+		go d.work(ctx, queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			if d.urgent(&update) {
+				go d.handle(ctx, &update)
+
+				continue
+			}
+
+			select {
+			case queues[uint64(conversationId(&update))%uint64(d.workers)] <- update:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context, queue chan tgbotapi.Update) {
+	for {
+		select {
+		case update, ok := <-queue:
+			if !ok {
+				return
+			}
+
+			d.handle(ctx, &update)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// conversationId is the chat the update belongs to, or the user for updates without one, like inline queries.
+// In private chats both are the same.
+func conversationId(update *tgbotapi.Update) int64 {
+	// Buttons of inline messages come without the message, FromChat does not check.
+	if update.CallbackQuery != nil && update.CallbackQuery.Message == nil {
+		return update.CallbackQuery.From.ID
+	}
+
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+
+	return 0
+}
@@ -0,0 +1,80 @@
+package dispatcher
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TestRunKeepsConversationOrder sends the interleaved updates of many chats and checks that every
+// chat's updates are handled in the order they were sent, however long each of them takes.
+func TestRunKeepsConversationOrder(t *testing.T) {
+	const (
+		chats   = 10
+		perChat = 20
+	)
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[int64][]int)
+		wg      sync.WaitGroup
+	)
+
+	handle := func(_ context.Context, update *tgbotapi.Update) {
+		defer wg.Done()
+
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		chatId := update.Message.Chat.ID
+		handled[chatId] = append(handled[chatId], update.UpdateID)
+	}
+	notUrgent := func(*tgbotapi.Update) bool {
+		return false
+	}
+
+	updates := make(chan tgbotapi.Update)
+	stopped := make(chan struct{})
+
+	go func() {
+		New(4, handle, notUrgent).Run(context.Background(), updates)
+		close(stopped)
+	}()
+
+	wg.Add(chats * perChat)
+
+	for i := 0; i < chats*perChat; i++ {
+		updates <- tgbotapi.Update{
+			UpdateID: i,
+			Message:  &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: int64(-100 - i%chats)}},
+		}
+	}
+
+	close(updates)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the updates channel was closed")
+	}
+
+	wg.Wait()
+
+	for chatId, ids := range handled {
+		if len(ids) != perChat {
+			t.Errorf("chat %d got %d updates, want %d", chatId, len(ids), perChat)
+		}
+
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("chat %d handled update %d after %d", chatId, ids[i], ids[i-1])
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	// MaxSize is the largest document accepted, in bytes.
+	MaxSize = 10 << 20
+	// MaxPages is the largest number of pages accepted in a PDF document.
+	MaxPages = 100
+
+	pdfMimeType = "application/pdf"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported document type")
+	ErrEmpty       = errors.New("document has no text")
+
+	// textExtensions are plain text, Markdown and source code files, which Telegram
+	// often reports as application/octet-stream.
+	textExtensions = map[string]bool{
+		".txt": true, ".md": true, ".markdown": true, ".rst": true, ".log": true, ".csv": true, ".tsv": true,
+		".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".xml": true, ".html": true,
+		".css": true, ".sql": true, ".sh": true, ".go": true, ".py": true, ".js": true, ".ts": true,
+		".jsx": true, ".tsx": true, ".java": true, ".kt": true, ".c": true, ".h": true, ".cpp": true,
+		".hpp": true, ".cs": true, ".rs": true, ".rb": true, ".php": true, ".swift": true, ".scala": true,
+		".lua": true, ".r": true, ".dart": true, ".vue": true, ".proto": true, ".dockerfile": true,
+	}
+	textMimeTypes = []string{"text/", "application/json", "application/xml", "application/x-yaml", "application/x-sh"}
+)
+
+// TooManyPagesError rejects a PDF document longer than MaxPages.
+type TooManyPagesError struct {
+	Pages int
+	Limit int
+}
+
+func (e TooManyPagesError) Error() string {
+	return fmt.Sprintf("document has %d pages, the limit is %d", e.Pages, e.Limit)
+}
+
+// IsSupported reports whether text can be extracted from a document with the name and MIME type.
+func IsSupported(name string, mimeType string) bool {
+	return isPdf(name, mimeType) || isText(name, mimeType)
+}
+
+// Extract returns the text of a plain text, Markdown, source code or PDF document.
+func Extract(name string, mimeType string, data []byte) (string, error) {
+	var (
+		text string
+		err  error
+	)
+
+	switch {
+	case isPdf(name, mimeType):
+		text, err = extractPdf(data)
+	case isText(name, mimeType):
+		if !utf8.Valid(data) {
+			return "", ErrUnsupported
+		}
+
+		text = string(data)
+	default:
+		return "", ErrUnsupported
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+
+	if text == "" {
+		return "", ErrEmpty
+	}
+
+	return text, nil
+}
+
+func extractPdf(data []byte) (text string, err error) {
+	// The PDF reader panics on some malformed files.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		return "", err
+	}
+
+	if pages := reader.NumPage(); pages > MaxPages {
+		return "", TooManyPagesError{Pages: pages, Limit: MaxPages}
+	}
+
+	pages := make([]string, 0, reader.NumPage())
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+
+		if page.V.IsNull() {
+			continue
+		}
+
+		content, err := page.GetPlainText(nil)
+
+		if err != nil {
+			return "", err
+		}
+
+		if content = strings.TrimSpace(content); content != "" {
+			pages = append(pages, content)
+		}
+	}
+
+	return strings.Join(pages, "\n\n"), nil
+}
+
+func isPdf(name string, mimeType string) bool {
+	return mimeType == pdfMimeType || strings.EqualFold(filepath.Ext(name), ".pdf")
+}
+
+func isText(name string, mimeType string) bool {
+	if textExtensions[strings.ToLower(filepath.Ext(name))] {
+		return true
+	}
+
+	for _, prefix := range textMimeTypes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -10,15 +10,17 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
 	"ibuddy_bot/internal/storage"
 	"ibuddy_bot/internal/util"
-	"ibuddy_bot/pkg/openaiclient"
+	"ibuddy_bot/pkg/llm"
 	"ibuddy_bot/pkg/tgbotclient"
 )
 
 const (
 	UsersCommand = "users"
 	ChatsCommand = "chats"
+	TierCommand  = "tier"
 )
 
 const (
@@ -31,20 +33,23 @@ const (
 
 type Handler struct {
 	bot       *tgbotclient.TgBotClient
-	client    *openaiclient.OpenAiClient
+	client    llm.LLM
 	storage   storage.Storage
+	tiers     ratelimit.Tiers
 	adminUser string
 }
 
 func NewHandler(
 	bot *tgbotclient.TgBotClient,
-	client *openaiclient.OpenAiClient,
+	client llm.LLM,
 	storage storage.Storage,
+	tiers ratelimit.Tiers,
 ) *Handler {
 	return &Handler{
 		bot:     bot,
 		client:  client,
 		storage: storage,
+		tiers:   tiers,
 	}
 }
 
@@ -54,6 +59,10 @@ func (h *Handler) IsAdminUpdate(update *tgbotapi.Update) bool {
 		msg = update.CallbackQuery.Message
 	}
 
+	if msg == nil {
+		return false
+	}
+
 	if msg.IsCommand() && strings.HasPrefix(msg.Command(), "admin") {
 		return true
 	}
@@ -74,11 +83,15 @@ func (h *Handler) HandleUpdate(ctx context.Context, update *tgbotapi.Update) {
 }
 
 func (h *Handler) handleMessage(ctx context.Context, message *tgbotapi.Message) {
-	switch message.CommandArguments() {
+	command, args, _ := strings.Cut(message.CommandArguments(), " ")
+
+	switch command {
 	case UsersCommand:
 		h.handleUsersCommand(ctx, message)
 	case ChatsCommand:
 		h.handleAdminChatsCommand(ctx, message)
+	case TierCommand:
+		h.handleTierCommand(ctx, message, args)
 	default:
 		h.handleDefaultCommand(message)
 	}
@@ -114,7 +127,7 @@ func (h *Handler) handleUserChatsButton(ctx context.Context, callbackQuery *tgbo
 		return
 	}
 
-	chats, err := h.storage.ListUserChats(ctx, user.Id)
+	chats, err := h.storage.ListUserChats(ctx, user.Id, 0)
 
 	if err != nil {
 		h.newSystemReply(callbackQuery.Message, err.Error())
@@ -178,7 +191,7 @@ func (h *Handler) handleUserChatButton(ctx context.Context, callbackQuery *tgbot
 		}
 	}
 
-	_, err = h.newReplyWithFallback(callbackQuery.Message, strings.Join(items, "\n\n"), tgbotapi.ModeMarkdownV2)
+	_, err = h.newRepliesWithFallback(callbackQuery.Message, strings.Join(items, "\n\n"), tgbotclient.ModeCommonMark)
 
 	if err != nil {
 		log.Println(err)
@@ -260,12 +273,12 @@ func (h *Handler) newSystemReply(message *tgbotapi.Message, s string) (tgbotapi.
 	return h.bot.NewSystemReply(message, s)
 }
 
-func (h *Handler) newReplyWithFallback(
+func (h *Handler) newRepliesWithFallback(
 	message *tgbotapi.Message,
 	responseText string,
 	parseMode string,
-) (tgbotapi.Message, error) {
-	return h.bot.NewReplyWithFallback(message, responseText, parseMode)
+) ([]tgbotapi.Message, error) {
+	return h.bot.NewRepliesWithFallback(message, responseText, parseMode)
 }
 
 func (h *Handler) newSystemMessage(chatId int64, text string) tgbotapi.MessageConfig {
@@ -7,7 +7,7 @@ import (
 )
 
 func (h *Handler) handleDefaultCommand(message *tgbotapi.Message) {
-	text := fmt.Sprintf("`/admin users`\n`/admin chats`\n")
+	text := fmt.Sprintf("`/admin users`\n`/admin chats`\n`/admin tier <user id> [tier]`\n")
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	msg.ParseMode = tgbotapi.ModeMarkdownV2
 	h.bot.Send(msg)
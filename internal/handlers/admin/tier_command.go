@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/ratelimit"
+)
+
+// handleTierCommand sets the rate limit tier of a user, "/admin tier <user id>" resets it to the default.
+func (h *Handler) handleTierCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 || len(fields) > 2 {
+		h.newSystemReply(message, fmt.Sprintf("Usage: /admin tier <user id> [%s]", strings.Join(h.tierNames(), "|")))
+
+		return
+	}
+
+	userId, err := strconv.ParseInt(fields[0], 10, 64)
+
+	if err != nil {
+		h.newSystemReply(message, err.Error())
+
+		return
+	}
+
+	tier := ""
+
+	if len(fields) == 2 && fields[1] != ratelimit.DefaultTier {
+		tier = fields[1]
+
+		if _, ok := h.tiers[tier]; !ok {
+			h.newSystemReply(message, fmt.Sprintf("Unknown tier %s, known: %s", tier, strings.Join(h.tierNames(), ", ")))
+
+			return
+		}
+	}
+
+	user, err := h.storage.GetUserById(ctx, userId)
+
+	if err != nil {
+		h.newSystemReply(message, err.Error())
+
+		return
+	}
+
+	user.Tier = tier
+
+	_, err = h.storage.UpdateUser(ctx, &user)
+
+	if err != nil {
+		h.newSystemReply(message, err.Error())
+
+		return
+	}
+
+	if tier == "" {
+		tier = ratelimit.DefaultTier
+	}
+
+	h.newSystemReply(message, fmt.Sprintf("User @%s is on the %s tier", user.Username, tier))
+}
+
+func (h *Handler) tierNames() []string {
+	names := make([]string, 0, len(h.tiers))
+
+	for name := range h.tiers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,287 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// setAnswerKeyboard attaches the regenerate, listen and variant buttons to the last message of the answer.
+func (h *Handler) setAnswerKeyboard(tgChatId int64, lang string, answer *models.Message) {
+	parts := answerParts(tgChatId, answer)
+
+	_, err := h.bot.Send(
+		tgbotapi.NewEditMessageReplyMarkup(tgChatId, parts[len(parts)-1].MessageID, answerKeyboard(lang, answer)),
+	)
+
+	if err != nil && !tgbotclient.IsNotModifiedError(err) {
+		log.Println(err)
+	}
+}
+
+func answerKeyboard(lang string, answer *models.Message) tgbotapi.InlineKeyboardMarkup {
+	id := answer.ObjectId.Hex()
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				localization.GetLocalizedText(lang, localization.AnswerRegenerate),
+				RegenerateDataPrefix+id,
+			),
+			tgbotapi.NewInlineKeyboardButtonData(
+				localization.GetLocalizedText(lang, localization.AnswerListen),
+				SpeakDataPrefix+id,
+			),
+		),
+	}
+
+	if count := len(answer.Variants); count > 1 {
+		selected := answer.SelectedVariant
+
+		rows = append(
+			rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("◀", variantData(id, (selected+count-1)%count)),
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", selected+1, count), variantData(id, selected)),
+				tgbotapi.NewInlineKeyboardButtonData("▶", variantData(id, (selected+1)%count)),
+			),
+		)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func variantData(id string, index int) string {
+	return fmt.Sprintf("%s%s:%d", VariantDataPrefix, id, index)
+}
+
+// handleRegenerateButton answers the same prompt again, with the same history, and stores
+// the new answer as another variant of the turn.
+func (h *Handler) handleRegenerateButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	answer, ok := h.findAnswer(ctx, callbackQuery, strings.TrimPrefix(callbackQuery.Data, RegenerateDataPrefix))
+
+	if !ok {
+		return
+	}
+
+	chat, err := h.storage.GetChatById(ctx, answer.ChatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	history, err := h.threadHistory(ctx, answer, maxChatHistoryMessages+1)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if len(history) == 0 || history[len(history)-1].Role != models.RoleUser {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerRegenerating))
+	h.bot.SendChatTypingAction(callbackQuery.Message.Chat.ID)
+
+	prompt := history[len(history)-1]
+	stream := h.newStreamReply(promptMessage(callbackQuery.Message.Chat, &answer), "")
+	stream.resume(answerParts(callbackQuery.Message.Chat.ID, &answer))
+
+	result, err := h.answer(ctx, user, &chat, history[:len(history)-1], prompt, stream)
+
+	if result.Content == "" {
+		h.replyCompletionError(stream.message, user, err)
+
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	if len(answer.Variants) == 0 {
+		answer.Variants = []string{answer.Text}
+	}
+
+	answer.Variants = append(answer.Variants, result.Content)
+	answer.SelectedVariant = len(answer.Variants) - 1
+	answer.ToolCalls = stream.calls
+	answer.Additional = result
+
+	h.saveAnswerVariant(ctx, callbackQuery.Message.Chat.ID, &answer, stream)
+}
+
+// handleSpeakButton sends the selected variant of the answer as voice messages.
+func (h *Handler) handleSpeakButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	answer, ok := h.findAnswer(ctx, callbackQuery, strings.TrimPrefix(callbackQuery.Data, SpeakDataPrefix))
+
+	if !ok {
+		return
+	}
+
+	if text, ok := h.charge(ctx, speechCosts(answer.Text)); !ok {
+		h.answerCallback(callbackQuery, text)
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, "")
+
+	parts := answerParts(callbackQuery.Message.Chat.ID, &answer)
+
+	if err := h.speak(ctx, &parts[len(parts)-1], user, answer.Text); err != nil {
+		log.Println(err)
+		h.newSystemReply(callbackQuery.Message, modelErrorText(user.Lang, err))
+	}
+}
+
+// handleVariantButton shows another stored variant of the answer, making it the one used as context.
+func (h *Handler) handleVariantButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	id, value, _ := strings.Cut(strings.TrimPrefix(callbackQuery.Data, VariantDataPrefix), ":")
+	answer, ok := h.findAnswer(ctx, callbackQuery, id)
+
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(value)
+
+	if err != nil || index < 0 || index >= len(answer.Variants) {
+		h.answerCallback(callbackQuery, "")
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, "")
+
+	if index == answer.SelectedVariant {
+		return
+	}
+
+	stream := h.newStreamReply(promptMessage(callbackQuery.Message.Chat, &answer), "")
+	stream.resume(answerParts(callbackQuery.Message.Chat.ID, &answer))
+
+	answer.SelectedVariant = index
+
+	h.saveAnswerVariant(ctx, callbackQuery.Message.Chat.ID, &answer, stream)
+}
+
+// saveAnswerVariant shows the selected variant in the answer's messages and stores it as the answer text.
+func (h *Handler) saveAnswerVariant(
+	ctx context.Context,
+	tgChatId int64,
+	answer *models.Message,
+	stream *streamReply,
+) {
+	answer.Text = answer.Variants[answer.SelectedVariant]
+
+	if err := stream.finalize(answer.Text); err != nil {
+		log.Println(err)
+	}
+
+	if len(stream.replies) > 0 {
+		answer.Id = stream.replies[0].MessageID
+		answer.PartIds = messageIds(stream.replies)
+	}
+
+	if _, err := h.storage.UpdateMessage(ctx, answer); err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	h.invalidateSummary(ctx, answer.ChatId, answer.ObjectId)
+	h.setAnswerKeyboard(tgChatId, h.getCurrentUser().Lang, answer)
+}
+
+func (h *Handler) findAnswer(
+	ctx context.Context,
+	callbackQuery *tgbotapi.CallbackQuery,
+	id string,
+) (models.Message, bool) {
+	user := h.getCurrentUser()
+	objectId, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return models.Message{}, false
+	}
+
+	answer, err := h.storage.GetMessageById(ctx, objectId)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	if answer.Role != models.RoleAssistant || !h.ownsChat(ctx, user, answer.ChatId) {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return models.Message{}, false
+	}
+
+	return answer, true
+}
+
+// ownsChat tells whether the chat is one of the user's, in a group one of the group's or forum topic's.
+// Button data comes from the client, so ids in it are checked before acting on them.
+func (h *Handler) ownsChat(ctx context.Context, user *models.User, chatId primitive.ObjectID) bool {
+	chat, err := h.storage.GetChatById(ctx, chatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return false
+	}
+
+	return h.isUserChat(user, chat)
+}
+
+func (h *Handler) answerCallback(callbackQuery *tgbotapi.CallbackQuery, text string) {
+	if _, err := h.bot.Request(tgbotapi.NewCallback(callbackQuery.ID, text)); err != nil {
+		log.Println(err)
+	}
+}
+
+// answerParts restores the Telegram messages an answer was sent as.
+func answerParts(tgChatId int64, answer *models.Message) []tgbotapi.Message {
+	ids := answer.PartIds
+
+	if len(ids) == 0 {
+		ids = []int{answer.Id}
+	}
+
+	parts := make([]tgbotapi.Message, len(ids))
+
+	for i, id := range ids {
+		parts[i] = tgbotapi.Message{MessageID: id, Chat: &tgbotapi.Chat{ID: tgChatId}}
+	}
+
+	return parts
+}
+
+// promptMessage points at the user message the answer replies to.
+func promptMessage(chat *tgbotapi.Chat, answer *models.Message) *tgbotapi.Message {
+	message := &tgbotapi.Message{Chat: chat}
+
+	if answer.ReplyToId != nil {
+		message.MessageID = *answer.ReplyToId
+	}
+
+	return message
+}
@@ -3,28 +3,31 @@ package user
 import (
 	"context"
 	"log"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
 )
 
 func (h *Handler) handleChatsCommand(ctx context.Context, message *tgbotapi.Message) {
-	chats, _ := h.storage.ListUserChats(ctx, h.getCurrentUser().Id)
+	chats, _ := h.storage.ListUserChats(ctx, h.getCurrentUser().Id, h.threadId())
 
 	if len(chats) == 0 {
 		h.newSystemReply(message, "No chats found")
 		return
 	}
 
-	buttons := make([][]tgbotapi.InlineKeyboardButton, len(chats))
+	buttons := make([][]tgbotapi.InlineKeyboardButton, 0, len(chats))
 
-	for i, chat := range chats {
-		chatIdHex := chat.Id.Hex()
-		buttons[i] = []tgbotapi.InlineKeyboardButton{
+	for _, item := range chatTree(chats) {
+		chatIdHex := item.chat.Id.Hex()
+		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{
 			{
-				Text:         chat.Title,
+				Text:         forkMarker(item.depth) + item.chat.Title,
 				CallbackData: &chatIdHex,
 			},
-		}
+		})
 	}
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, "Click on chat you want to switch")
@@ -38,3 +41,53 @@ func (h *Handler) handleChatsCommand(ctx context.Context, message *tgbotapi.Mess
 		log.Println(err)
 	}
 }
+
+type chatTreeItem struct {
+	chat  models.Chat
+	depth int
+}
+
+// chatTree orders the chats so that every fork follows the chat it was forked from.
+func chatTree(chats []models.Chat) []chatTreeItem {
+	known := make(map[primitive.ObjectID]bool, len(chats))
+
+	for _, chat := range chats {
+		known[chat.Id] = true
+	}
+
+	roots := make([]models.Chat, 0)
+	children := make(map[primitive.ObjectID][]models.Chat)
+
+	for _, chat := range chats {
+		if chat.ParentId != nil && known[*chat.ParentId] {
+			children[*chat.ParentId] = append(children[*chat.ParentId], chat)
+		} else {
+			roots = append(roots, chat)
+		}
+	}
+
+	items := make([]chatTreeItem, 0, len(chats))
+
+	var walk func(chat models.Chat, depth int)
+	walk = func(chat models.Chat, depth int) {
+		items = append(items, chatTreeItem{chat: chat, depth: depth})
+
+		for _, child := range children[chat.Id] {
+			walk(child, depth+1)
+		}
+	}
+
+	for _, root := range roots {
+		walk(root, 0)
+	}
+
+	return items
+}
+
+func forkMarker(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+
+	return strings.Repeat("· ", depth-1) + "↳ "
+}
@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	maxChatHistoryMessages = 100
+	maxContextRetries      = 2
+)
+
+// errAnswerNotSent is returned when the answer was produced but none of its messages could be sent.
+var errAnswerNotSent = errors.New("the answer could not be sent")
+
+// answer streams the answer to the prompt, given the chat history before it (oldest first).
+// Messages that no longer fit are folded into the chat's rolling summary first, and since the
+// tokenizer estimate can be off, an overflow reported by the API is retried with a smaller window.
+// Turns with images in the context go to the vision model when the user's model cannot see them.
+func (h *Handler) answer(
+	ctx context.Context,
+	user *models.User,
+	chat *models.Chat,
+	history []models.Message,
+	prompt models.Message,
+	stream *streamReply,
+) (llm.Result, error) {
+	var result llm.Result
+
+	ctx, done := h.generations.start(ctx, h.conversation(stream.message), h.getCurrentMember().Id)
+	defer done()
+
+	model := user.GetModel()
+	images := make(map[primitive.ObjectID][]string)
+
+	if hasImages(prompt) || hasImages(history...) {
+		images = h.loadImages(history, prompt)
+	}
+
+	if len(images) > 0 && !h.client.SupportsVision(model) {
+		model = h.visionModel
+
+		text := localization.GetLocalizedText(user.Lang, localization.VisionModelUsed, user.GetModel(), model)
+
+		if _, err := h.newSystemReply(stream.message, text); err != nil {
+			log.Println(err)
+		}
+	}
+
+	builder, err := newContextBuilder(model, h.client.ContextWindow(model), h.completionMaxTokens(user, model), images)
+
+	if err != nil {
+		return result, err
+	}
+
+	// The summary of another branch would tell the model about turns this thread does not have.
+	if summaryOfOtherBranch(chat, history) {
+		chat.ResetSummary()
+	}
+
+	promptMessage := builder.message(prompt)
+	memories := h.memoryMessages(ctx, user)
+	documents := h.documentMessages(ctx, model, chat, prompt)
+
+	if _, first, err := builder.build(h.systemMessages(user, chat, memories, documents), history, promptMessage); err == nil {
+		if before, ok := summaryBoundary(chat, history, first, prompt); ok {
+			if err := h.updateSummary(ctx, user, chat, before); err != nil {
+				log.Println(err)
+			}
+
+			h.bot.SendChatTypingAction(stream.message.Chat.ID)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		messages, _, err := builder.build(h.systemMessages(user, chat, memories, documents), history, promptMessage)
+
+		if err != nil {
+			return result, err
+		}
+
+		result, err = h.streamCompletion(ctx, stream, user, h.chatCompletionRequest(user, model, messages))
+
+		if result.Content != "" || !isContextLengthError(err) || attempt == maxContextRetries {
+			return result, err
+		}
+
+		log.Println(err)
+		builder.shrink()
+	}
+}
+
+// respond answers the prompt in reply to the message and stores the answer in the prompt's chat.
+func (h *Handler) respond(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	user *models.User,
+	chat *models.Chat,
+	history []models.Message,
+	prompt models.Message,
+	prefix string,
+) {
+	stream := h.newStreamReply(message, prefix)
+	result, err := h.answer(ctx, user, chat, history, prompt, stream)
+
+	if result.Content == "" {
+		h.replyCompletionError(message, user, err)
+
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	if len(stream.replies) == 0 {
+		h.replyCompletionError(message, user, errAnswerNotSent)
+
+		return
+	}
+
+	answer := models.Message{
+		Id:         stream.replies[0].MessageID,
+		PartIds:    messageIds(stream.replies),
+		ChatId:     prompt.ChatId,
+		ReplyToId:  &message.MessageID,
+		ParentId:   &prompt.ObjectId,
+		UserId:     h.bot.Self.ID,
+		Username:   h.bot.Self.UserName,
+		Role:       models.RoleAssistant,
+		Text:       prefix + result.Content,
+		ToolCalls:  stream.calls,
+		Additional: result,
+	}
+
+	answerId, err := h.storage.InsertMessage(ctx, answer)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	answer.ObjectId = *answerId
+	h.setAnswerKeyboard(message.Chat.ID, user.Lang, &answer)
+
+	if user.VoiceReplies {
+		reply := &stream.replies[len(stream.replies)-1]
+
+		if text, ok := h.charge(ctx, speechCosts(result.Content)); !ok {
+			h.newSystemReply(reply, text)
+		} else if err := h.speak(ctx, reply, user, result.Content); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// replyCompletionError tells the user why no answer could be produced.
+func (h *Handler) replyCompletionError(message *tgbotapi.Message, user *models.User, err error) {
+	log.Println(err)
+
+	text := modelErrorText(user.Lang, err)
+
+	if errors.Is(err, errPromptTooLong) {
+		text = localization.GetLocalizedText(user.Lang, localization.TooLongMessage)
+	} else if errors.Is(err, context.Canceled) {
+		text = localization.GetLocalizedText(user.Lang, localization.StopDone)
+	}
+
+	if _, err := h.newSystemReply(message, text); err != nil {
+		log.Println(err)
+	}
+}
+
+// chatCompletionRequest applies the user's sampling settings to the messages.
+func (h *Handler) chatCompletionRequest(
+	user *models.User,
+	model string,
+	messages []llm.Message,
+) llm.ChatRequest {
+	return llm.ChatRequest{
+		Model:           model,
+		Messages:        messages,
+		MaxTokens:       h.completionMaxTokens(user, model),
+		Temperature:     user.GetTemperature(),
+		TopP:            user.GetTopP(),
+		PresencePenalty: user.GetPresencePenalty(),
+		User:            strconv.FormatInt(user.Id, 10),
+	}
+}
+
+// completionMaxTokens keeps the user's max tokens within the limit of a model the turn was routed to.
+func (h *Handler) completionMaxTokens(user *models.User, model string) int {
+	if limit := h.client.MaxTokensLimit(model); user.GetMaxTokens() > limit {
+		return limit
+	}
+
+	return user.GetMaxTokens()
+}
+
+// systemMessages returns the persona prompt, the remembered facts about the user,
+// the rolling summary of the chat and the document excerpts.
+func (h *Handler) systemMessages(
+	user *models.User,
+	chat *models.Chat,
+	memories []llm.Message,
+	documents []llm.Message,
+) []llm.Message {
+	messages := append(personaMessages(user, chat), memories...)
+	messages = append(messages, summaryMessages(chat)...)
+
+	return append(messages, documents...)
+}
+
+func messageIds(messages []tgbotapi.Message) []int {
+	ids := make([]int, len(messages))
+
+	for i, msg := range messages {
+		ids[i] = msg.MessageID
+	}
+
+	return ids
+}
+
+func isContextLengthError(err error) bool {
+	class, _ := llm.Classify(err)
+
+	return err != nil && class == llm.ErrorContextLength
+}
+
+// modelErrorText tells the user why a model call failed and, when it is known, how long to wait.
+func modelErrorText(lang string, err error) string {
+	class, retryAfter := llm.Classify(err)
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	switch class {
+	case llm.ErrorRateLimited:
+		if seconds > 0 {
+			return localization.GetLocalizedText(lang, localization.ModelRateLimitedRetry, seconds)
+		}
+
+		return localization.GetLocalizedText(lang, localization.ModelRateLimited)
+	case llm.ErrorUnavailable:
+		return localization.GetLocalizedText(lang, localization.ModelUnavailableRetry, seconds)
+	case llm.ErrorServer:
+		return localization.GetLocalizedText(lang, localization.ModelServerError)
+	case llm.ErrorTimeout:
+		return localization.GetLocalizedText(lang, localization.ModelTimeout)
+	case llm.ErrorContextLength:
+		return localization.GetLocalizedText(lang, localization.ModelContextLength)
+	case llm.ErrorContentPolicy:
+		return localization.GetLocalizedText(lang, localization.ModelContentPolicy)
+	}
+
+	return localization.GetLocalizedText(lang, localization.ModelFailed)
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tokenizer"
+)
+
+var errPromptTooLong = errors.New("prompt does not fit into the context window")
+
+// contextBuilder packs as many recent chat messages as fit into the model's context window,
+// keeping room for the completion.
+// Images are taken from the loaded data URLs, keyed by message.
+type contextBuilder struct {
+	tokenizer *tokenizer.Tokenizer
+	budget    int
+	images    map[primitive.ObjectID][]string
+}
+
+func newContextBuilder(
+	model string,
+	contextWindow int,
+	maxTokens int,
+	images map[primitive.ObjectID][]string,
+) (*contextBuilder, error) {
+	t, err := tokenizer.ForModel(model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextBuilder{
+		tokenizer: t,
+		budget:    contextWindow - maxTokens - tokenizer.ReplyTokens,
+		images:    images,
+	}, nil
+}
+
+// shrink halves the budget left for history, used when the API still reports a context overflow.
+func (b *contextBuilder) shrink() {
+	b.budget /= 2
+}
+
+// build returns the system messages, then the history messages that fit (oldest first), then the prompt.
+// History is expected in chronological order; the oldest messages are dropped first.
+// The returned index is the position of the first history message that made it into the context.
+func (b *contextBuilder) build(
+	system []llm.Message,
+	history []models.Message,
+	prompt llm.Message,
+) ([]llm.Message, int, error) {
+	left := b.budget - b.tokenizer.CountMessage(prompt)
+
+	for _, msg := range system {
+		left -= b.tokenizer.CountMessage(msg)
+	}
+
+	if left < 0 {
+		return nil, 0, errPromptTooLong
+	}
+
+	first := len(history)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		tokens := b.tokenizer.CountMessage(b.message(history[i]))
+
+		if tokens > left {
+			break
+		}
+
+		left -= tokens
+		first = i
+	}
+
+	messages := make([]llm.Message, 0, len(system)+len(history)-first+1)
+	messages = append(messages, system...)
+
+	for _, msg := range history[first:] {
+		messages = append(messages, b.message(msg))
+	}
+
+	return append(messages, prompt), first, nil
+}
+
+func (b *contextBuilder) message(msg models.Message) llm.Message {
+	return toLLMMessage(msg, b.images[msg.ObjectId])
+}
+
+func toLLMMessage(msg models.Message, images []string) llm.Message {
+	if len(images) > 0 {
+		return llm.Message{
+			Role:  msg.Role,
+			Parts: imageParts(msg, images),
+		}
+	}
+
+	return llm.Message{
+		Role:    msg.Role,
+		Content: textWithPlaceholders(msg, 0),
+	}
+}
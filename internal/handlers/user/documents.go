@@ -0,0 +1,289 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/documents"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/util"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
+	"ibuddy_bot/pkg/tokenizer"
+)
+
+const (
+	documentChunkLength = 2000
+	maxDocumentChunks   = 300
+	embeddingBatchSize  = 100
+	embeddingModel      = openai.SmallEmbedding3
+
+	// documentContextShare is the part of the context window given to document excerpts.
+	documentContextShare = 4
+)
+
+// documentLimitError returns the localized reason the document is rejected before downloading it.
+func documentLimitError(user *models.User, document *tgbotapi.Document) string {
+	if document.FileSize > documents.MaxSize {
+		return localization.GetLocalizedText(user.Lang, localization.DocumentTooLarge, documents.MaxSize>>20)
+	}
+
+	if !documents.IsSupported(document.FileName, document.MimeType) {
+		return localization.GetLocalizedText(user.Lang, localization.DocumentUnsupported)
+	}
+
+	return ""
+}
+
+// ingestDocument extracts the text of the document, splits it into chunks and stores them with
+// their embeddings in the chat. It returns the number of chunks, or false after telling the user what failed.
+func (h *Handler) ingestDocument(
+	ctx context.Context,
+	user *models.User,
+	message *tgbotapi.Message,
+	document *tgbotapi.Document,
+	chatId primitive.ObjectID,
+) (int, bool) {
+	fail := func(text string) (int, bool) {
+		if _, err := h.newSystemReply(message, text); err != nil {
+			log.Println(err)
+		}
+
+		return 0, false
+	}
+
+	fileUrl, err := h.bot.GetFileDirectURL(document.FileID)
+
+	if err != nil {
+		log.Println(err)
+
+		return fail("Failed, try again")
+	}
+
+	data, err := util.DownloadBytesByUrl(fileUrl)
+
+	if err != nil {
+		log.Println(err)
+
+		return fail("Failed, try again")
+	}
+
+	text, err := documents.Extract(document.FileName, document.MimeType, data)
+
+	var tooManyPages documents.TooManyPagesError
+
+	switch {
+	case errors.As(err, &tooManyPages):
+		return fail(
+			localization.GetLocalizedText(user.Lang, localization.DocumentTooManyPages, tooManyPages.Pages, tooManyPages.Limit),
+		)
+	case errors.Is(err, documents.ErrEmpty):
+		return fail(localization.GetLocalizedText(user.Lang, localization.DocumentEmpty))
+	case errors.Is(err, documents.ErrUnsupported):
+		return fail(localization.GetLocalizedText(user.Lang, localization.DocumentUnsupported))
+	case err != nil:
+		log.Println(err)
+
+		return fail("Failed, try again")
+	}
+
+	parts := tgbotclient.SplitText(text, documentChunkLength)
+
+	if len(parts) > maxDocumentChunks {
+		return fail(localization.GetLocalizedText(user.Lang, localization.DocumentTooLong, maxDocumentChunks*documentChunkLength))
+	}
+
+	h.bot.SendChatTypingAction(message.Chat.ID)
+
+	embeddings, err := h.embed(ctx, parts)
+
+	if err != nil {
+		log.Println(err)
+
+		return fail("Failed, try again")
+	}
+
+	chunks := make([]models.Chunk, len(parts))
+
+	for i, part := range parts {
+		chunks[i] = models.Chunk{
+			ChatId:    chatId,
+			Document:  document.FileName,
+			Index:     i,
+			Count:     len(parts),
+			Text:      part,
+			Embedding: embeddings[i],
+		}
+	}
+
+	if err := h.storage.InsertChunks(ctx, chunks); err != nil {
+		log.Println(err)
+
+		return fail("Failed, try again")
+	}
+
+	return len(chunks), true
+}
+
+func (h *Handler) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		batch, err := h.client.Embed(
+			ctx,
+			llm.EmbeddingRequest{
+				Input: texts[start:end],
+				Model: string(embeddingModel),
+			},
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(batch))
+		}
+
+		embeddings = append(embeddings, batch...)
+	}
+
+	return embeddings, nil
+}
+
+// documentMessages returns the excerpts of the chat's documents that fit the document share of the
+// context window. Small documents are included whole, otherwise the chunks closest to the prompt are picked.
+func (h *Handler) documentMessages(
+	ctx context.Context,
+	model string,
+	chat *models.Chat,
+	prompt models.Message,
+) []llm.Message {
+	chunks, err := h.storage.ListChatChunks(ctx, chat.Id)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	t, err := tokenizer.ForModel(model)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil
+	}
+
+	budget := h.client.ContextWindow(model) / documentContextShare
+	tokens := make([]int, len(chunks))
+	total := 0
+
+	for i, chunk := range chunks {
+		tokens[i] = t.Count(chunk.Text)
+		total += tokens[i]
+	}
+
+	order := make([]int, len(chunks))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	if total > budget && prompt.Text != "" {
+		embeddings, err := h.embed(ctx, []string{prompt.Text})
+
+		if err != nil {
+			log.Println(err)
+
+			return nil
+		}
+
+		scores := make([]float64, len(chunks))
+
+		for i, chunk := range chunks {
+			scores[i] = cosineSimilarity(embeddings[0], chunk.Embedding)
+		}
+
+		sort.SliceStable(order, func(a, b int) bool {
+			return scores[order[a]] > scores[order[b]]
+		})
+	}
+
+	picked := make([]int, 0)
+
+	for _, i := range order {
+		if tokens[i] > budget {
+			continue
+		}
+
+		budget -= tokens[i]
+		picked = append(picked, i)
+	}
+
+	if len(picked) == 0 {
+		return nil
+	}
+
+	// Excerpts read best in the order they appear in the documents.
+	sort.Ints(picked)
+
+	excerpts := make([]string, len(picked))
+
+	for j, i := range picked {
+		excerpts[j] = fmt.Sprintf(
+			"--- %s (part %d of %d) ---\n%s",
+			chunks[i].Document,
+			chunks[i].Index+1,
+			chunks[i].Count,
+			chunks[i].Text,
+		)
+	}
+
+	return []llm.Message{
+		{
+			Role: llm.RoleSystem,
+			Content: "Excerpts from documents the user shared in this conversation, " +
+				"use them to answer questions about the documents:\n\n" + strings.Join(excerpts, "\n\n"),
+		},
+	}
+}
+
+func cosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,292 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+)
+
+// handleEditedMessage answers the latest question of the active chat again when it is edited.
+// Earlier messages already have answers built on them, so for those forking is offered instead.
+func (h *Handler) handleEditedMessage(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+	text := strings.TrimSpace(message.Text)
+
+	if h.inGroup() {
+		text = strings.TrimSpace(h.stripBotMention(text))
+	}
+
+	if len(text) < 2 {
+		return
+	}
+
+	chatIds, err := h.userChatIds(ctx, user)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	prompt, err := h.storage.GetUserMessage(ctx, chatIds, message.From.ID, message.MessageID)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if prompt.Text == text {
+		return
+	}
+
+	var limit int64 = 2
+	latest, err := h.storage.ListChatMessages(ctx, prompt.ChatId, &limit)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	var previous *models.Message
+	isLatest := false
+
+	switch {
+	case len(latest) > 0 && latest[0].ObjectId == prompt.ObjectId:
+		isLatest = true
+	case len(latest) > 1 && latest[1].ObjectId == prompt.ObjectId && latest[0].Role == models.RoleAssistant:
+		isLatest = true
+		previous = &latest[0]
+	}
+
+	if !isLatest || user.ActiveChatId == nil || *user.ActiveChatId != prompt.ChatId {
+		h.offerFork(ctx, message, user, &prompt, text)
+
+		return
+	}
+
+	h.bot.SendChatTypingAction(message.Chat.ID)
+
+	prompt.Text = text
+	prompt.EditedText = ""
+
+	if _, err := h.storage.UpdateMessage(ctx, &prompt); err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	h.invalidateSummary(ctx, prompt.ChatId, prompt.ObjectId)
+
+	chat, err := h.storage.GetChatById(ctx, prompt.ChatId)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	history, err := h.threadHistory(ctx, prompt, maxChatHistoryMessages)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if previous == nil {
+		h.respond(ctx, message, user, &chat, history, prompt, "")
+
+		return
+	}
+
+	stream := h.newStreamReply(message, "")
+	stream.resume(answerParts(message.Chat.ID, previous))
+
+	result, err := h.answer(ctx, user, &chat, history, prompt, stream)
+
+	if result.Content == "" {
+		h.replyCompletionError(message, user, err)
+
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	if len(stream.replies) == 0 {
+		h.replyCompletionError(message, user, errAnswerNotSent)
+
+		return
+	}
+
+	// The old variants answered the old question.
+	previous.Text = result.Content
+	previous.Variants = nil
+	previous.SelectedVariant = 0
+	previous.Id = stream.replies[0].MessageID
+	previous.PartIds = messageIds(stream.replies)
+	previous.ToolCalls = stream.calls
+	previous.Additional = result
+
+	if _, err := h.storage.UpdateMessage(ctx, previous); err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	h.setAnswerKeyboard(message.Chat.ID, user.Lang, previous)
+}
+
+// offerFork keeps the edited text aside and asks whether to continue from it in a new chat.
+func (h *Handler) offerFork(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	user *models.User,
+	prompt *models.Message,
+	text string,
+) {
+	prompt.EditedText = text
+
+	if _, err := h.storage.UpdateMessage(ctx, prompt); err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	msg := h.newSystemMessage(message.Chat.ID, localization.GetLocalizedText(user.Lang, localization.EditForkOffer))
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				localization.GetLocalizedText(user.Lang, localization.EditForkButton),
+				ForkDataPrefix+prompt.ObjectId.Hex(),
+			),
+		),
+	)
+
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println(err)
+	}
+}
+
+// handleForkButton forks the chat right before the edited message and answers its new text there.
+func (h *Handler) handleForkButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	promptId, err := primitive.ObjectIDFromHex(strings.TrimPrefix(callbackQuery.Data, ForkDataPrefix))
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	prompt, err := h.storage.GetMessageById(ctx, promptId)
+
+	if err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	if prompt.UserId != h.getCurrentMember().Id {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	chat, err := h.storage.GetChatById(ctx, prompt.ChatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if !h.isUserChat(user, chat) {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	text := prompt.Text
+
+	if prompt.EditedText != "" {
+		text = prompt.EditedText
+	}
+
+	history, err := h.threadHistory(ctx, prompt, maxChatHistoryMessages)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	forked, history, err := h.forkChat(ctx, user, chat, history, prompt.ObjectId, text)
+
+	if err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, "Failed, try again")
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, forked.Title)
+
+	_, err = h.bot.Send(
+		tgbotapi.NewEditMessageReplyMarkup(
+			callbackQuery.Message.Chat.ID,
+			callbackQuery.Message.MessageID,
+			tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}},
+		),
+	)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	h.announceActiveChat(callbackQuery.Message.Chat.ID, forked)
+
+	forkedPrompt := models.Message{
+		Id:       prompt.Id,
+		ChatId:   forked.Id,
+		UserId:   prompt.UserId,
+		Username: prompt.Username,
+		Role:     models.RoleUser,
+		Text:     text,
+	}
+
+	if len(history) > 0 {
+		forkedPrompt.ParentId = &history[len(history)-1].ObjectId
+	}
+
+	if id, err := h.storage.InsertMessage(ctx, forkedPrompt); err != nil {
+		log.Println(err)
+
+		forkedPrompt.ObjectId = primitive.NewObjectID()
+	} else {
+		forkedPrompt.ObjectId = *id
+	}
+
+	message := callbackQuery.Message.ReplyToMessage
+
+	if message == nil {
+		message = &tgbotapi.Message{MessageID: prompt.Id, Chat: callbackQuery.Message.Chat}
+	}
+
+	h.bot.SendChatTypingAction(callbackQuery.Message.Chat.ID)
+	h.respond(ctx, message, user, &forked, history, forkedPrompt, "")
+}
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+)
+
+// forkChat starts a new chat with copies of the history (oldest first), keeping the thread links
+// between the copies, and makes it active. forkedAt is the message of the chat the fork diverges at.
+func (h *Handler) forkChat(
+	ctx context.Context,
+	user *models.User,
+	chat models.Chat,
+	history []models.Message,
+	forkedAt primitive.ObjectID,
+	title string,
+) (models.Chat, []models.Message, error) {
+	forked := models.Chat{
+		UserId:       user.Id,
+		ThreadId:     chat.ThreadId,
+		Username:     user.Username,
+		Title:        title,
+		Persona:      chat.Persona,
+		SystemPrompt: chat.SystemPrompt,
+		ParentId:     &chat.Id,
+		ForkedAt:     &forkedAt,
+	}
+
+	// The summary still fits when it only covers messages older than the copied history.
+	if len(history) > 0 && chat.SummarizedUntil != nil &&
+		bytes.Compare(history[0].ObjectId[:], chat.SummarizedUntil[:]) >= 0 {
+		forked.Summary = chat.Summary
+	}
+
+	res, err := h.storage.CreateChat(ctx, forked)
+
+	if err != nil {
+		return models.Chat{}, nil, err
+	}
+
+	forked.Id, _ = res.InsertedID.(primitive.ObjectID)
+	copies := make([]models.Message, len(history))
+
+	for i, msg := range history {
+		original := msg.ObjectId
+		msg.CopyOf = &original
+		msg.ObjectId = primitive.NilObjectID
+		msg.ChatId = forked.Id
+		msg.ParentId = nil
+
+		if i > 0 {
+			parentId := copies[i-1].ObjectId
+			msg.ParentId = &parentId
+		}
+
+		id, err := h.storage.InsertMessage(ctx, msg)
+
+		if err != nil {
+			return forked, nil, err
+		}
+
+		msg.ObjectId = *id
+		copies[i] = msg
+	}
+
+	if forked.Summary != "" {
+		forked.SummarizedUntil = &copies[0].ObjectId
+
+		if _, err := h.storage.UpdateChat(ctx, &forked); err != nil {
+			log.Println(err)
+		}
+	}
+
+	h.copyChunks(ctx, chat.Id, forked.Id)
+	h.changeUserActiveChat(ctx, user, forked.Id)
+
+	return forked, copies, nil
+}
+
+// copyChunks shares the documents of the chat with its fork.
+func (h *Handler) copyChunks(ctx context.Context, from primitive.ObjectID, to primitive.ObjectID) {
+	chunks, err := h.storage.ListChatChunks(ctx, from)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if len(chunks) == 0 {
+		return
+	}
+
+	for i := range chunks {
+		chunks[i].Id = primitive.NilObjectID
+		chunks[i].ChatId = to
+	}
+
+	if err := h.storage.InsertChunks(ctx, chunks); err != nil {
+		log.Println(err)
+	}
+}
+
+// announceActiveChat posts the name of the chat that became active and pins it outside of groups.
+func (h *Handler) announceActiveChat(tgChatId int64, chat models.Chat) {
+	msg, err := h.bot.Send(h.newSystemMessage(tgChatId, fmt.Sprintf("Active chat: %s", chat.Title)))
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if !h.inGroup() {
+		h.bot.PinMessage(msg.Chat.ID, msg.MessageID)
+	}
+}
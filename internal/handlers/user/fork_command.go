@@ -0,0 +1,76 @@
+package user
+
+import (
+	"context"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+)
+
+// handleForkCommand forks the chat from the message the command replies to,
+// or from the latest message of the active chat.
+func (h *Handler) handleForkCommand(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+
+	var from models.Message
+
+	if reply := message.ReplyToMessage; reply != nil {
+		found, err := h.findChatMessage(ctx, user, reply.MessageID)
+
+		if err != nil {
+			log.Println(err)
+			h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.ForkNotFound))
+
+			return
+		}
+
+		from = found
+	} else {
+		if user.ActiveChatId == nil {
+			h.newSystemReply(message, "There is no active chat")
+
+			return
+		}
+
+		var limit int64 = 1
+		latest, err := h.storage.ListChatMessages(ctx, *user.ActiveChatId, &limit)
+
+		if err != nil || len(latest) == 0 {
+			log.Println(err)
+			h.newSystemReply(message, "There is no active chat")
+
+			return
+		}
+
+		from = latest[0]
+	}
+
+	chat, err := h.storage.GetChatById(ctx, from.ChatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	history, err := h.threadHistory(ctx, from, maxChatHistoryMessages-1)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	forked, _, err := h.forkChat(ctx, user, chat, append(history, from), from.ObjectId, chat.Title)
+
+	if err != nil {
+		log.Println(err)
+		h.newSystemReply(message, "Failed, try again")
+
+		return
+	}
+
+	h.announceActiveChat(message.Chat.ID, forked)
+}
@@ -0,0 +1,49 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
+)
+
+func TestForkChatMarksCopies(t *testing.T) {
+	store := newMemStorage()
+	user := &models.User{Id: 1000, MemoryDisabled: true}
+	handler := NewHandler(nil, nil, store, "", nil).withRequest(&request.Request{User: user})
+
+	chat := models.Chat{UserId: user.Id}
+	res, _ := store.CreateChat(context.Background(), chat)
+	chat.Id = res.InsertedID.(primitive.ObjectID)
+
+	var history []models.Message
+
+	for i, role := range []string{models.RoleUser, models.RoleAssistant} {
+		message := models.Message{Id: i + 1, ChatId: chat.Id, Role: role}
+		id, _ := store.InsertMessage(context.Background(), message)
+		message.ObjectId = *id
+		history = append(history, message)
+	}
+
+	forked, copies, err := handler.forkChat(context.Background(), user, chat, history, history[1].ObjectId, "fork")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, message := range copies {
+		if message.ChatId != forked.Id || message.CopyOf == nil || *message.CopyOf != history[i].ObjectId {
+			t.Errorf("copy %d of %s is not marked as a copy", i, history[i].ObjectId.Hex())
+		}
+
+		if message.Id != history[i].Id {
+			t.Errorf("copy %d has Telegram id %d, want %d", i, message.Id, history[i].Id)
+		}
+	}
+
+	if user.ActiveChatId == nil || *user.ActiveChatId != forked.Id {
+		t.Errorf("the fork is not the active chat")
+	}
+}
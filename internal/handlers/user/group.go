@@ -0,0 +1,164 @@
+package user
+
+import (
+	"context"
+	"log"
+	"regexp"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+)
+
+var (
+	// groupAdminCommands change the persona and model the whole group talks to.
+	groupAdminCommands = map[string]bool{"persona": true, "settings": true}
+	// privateCommands manage what is remembered about a single user, which groups do not use.
+	privateCommands = map[string]bool{"memory": true}
+)
+
+// enterGroup switches the handler to the conversation state of the group or forum topic the update
+// comes from. The current user becomes the member as seen in the group, see models.Group.UserInGroup.
+func (h *Handler) enterGroup(ctx context.Context, chat *tgbotapi.Chat, message *tgbotapi.Message, member *models.User) bool {
+	threadId := h.bot.MessageThreadId(message)
+	group, err := h.storage.GetOrCreateGroup(
+		ctx,
+		chat.ID,
+		threadId,
+		&models.Group{ChatId: chat.ID, ThreadId: threadId, Title: chat.Title},
+	)
+
+	if err != nil {
+		log.Println(err)
+
+		return false
+	}
+
+	if group.Title != chat.Title {
+		group.Title = chat.Title
+
+		if _, err := h.storage.UpdateGroup(ctx, &group); err != nil {
+			log.Println(err)
+		}
+	}
+
+	user := group.UserInGroup(*member)
+	h.request.EnterGroup(&group, &user)
+
+	return true
+}
+
+// saveUser stores the current user, in a group its conversation state and settings go to the group.
+func (h *Handler) saveUser(ctx context.Context, user *models.User) error {
+	if !h.request.InGroup() {
+		_, err := h.storage.UpdateUser(ctx, user)
+
+		return err
+	}
+
+	member := h.request.Group.Split(*user, *h.request.Member)
+
+	if _, err := h.storage.UpdateGroup(ctx, h.request.Group); err != nil {
+		return err
+	}
+
+	*h.request.Member = member
+	_, err := h.storage.UpdateUser(ctx, h.request.Member)
+
+	return err
+}
+
+// threadId returns the forum topic the update comes from, 0 outside of topics.
+func (h *Handler) threadId() int {
+	if h.request.Group == nil {
+		return 0
+	}
+
+	return h.request.Group.ThreadId
+}
+
+// isUserChat tells whether the chat is a conversation of the user in the Telegram chat or forum
+// topic the update comes from. The topics of a group share its user, so their chats differ by thread.
+func (h *Handler) isUserChat(user *models.User, chat models.Chat) bool {
+	return chat.UserId == user.Id && chat.ThreadId == h.threadId()
+}
+
+func (h *Handler) inGroup() bool {
+	return h.request.InGroup()
+}
+
+// getCurrentMember returns the user who sent the update, unlike getCurrentUser also in groups.
+func (h *Handler) getCurrentMember() *models.User {
+	return h.request.Sender()
+}
+
+// checkGroupCommand tells whether the member may use the command in the current chat
+// and explains why not otherwise.
+func (h *Handler) checkGroupCommand(message *tgbotapi.Message) bool {
+	if !h.inGroup() {
+		return true
+	}
+
+	user := h.getCurrentUser()
+	command := message.Command()
+
+	if privateCommands[command] {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.GroupPrivateOnly))
+
+		return false
+	}
+
+	if groupAdminCommands[command] && !h.isGroupAdmin(message.Chat.ID, message.From.ID) {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.GroupAdminOnly))
+
+		return false
+	}
+
+	return true
+}
+
+// checkGroupButton is checkGroupCommand for the buttons of admin-only commands.
+func (h *Handler) checkGroupButton(callbackQuery *tgbotapi.CallbackQuery) bool {
+	if !h.inGroup() || h.isGroupAdmin(callbackQuery.Message.Chat.ID, callbackQuery.From.ID) {
+		return true
+	}
+
+	user := h.getCurrentUser()
+	callback := tgbotapi.NewCallbackWithAlert(
+		callbackQuery.ID,
+		localization.GetLocalizedText(user.Lang, localization.GroupAdminOnly),
+	)
+
+	if _, err := h.bot.Request(callback); err != nil {
+		log.Println(err)
+	}
+
+	return false
+}
+
+func (h *Handler) isGroupAdmin(chatId int64, userId int64) bool {
+	member, err := h.bot.GetChatMember(
+		tgbotapi.GetChatMemberConfig{
+			ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatId, UserID: userId},
+		},
+	)
+
+	if err != nil {
+		log.Println(err)
+
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// stripBotMention removes the mention that addressed the bot from the prompt.
+func (h *Handler) stripBotMention(text string) string {
+	if h.bot.Self.UserName == "" {
+		return text
+	}
+
+	mention := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(h.bot.Self.UserName) + `\b`)
+
+	return mention.ReplaceAllString(text, "")
+}
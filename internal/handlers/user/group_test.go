@@ -0,0 +1,43 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
+)
+
+func TestForumTopicsKeepTheirChats(t *testing.T) {
+	store := newMemStorage()
+	member := models.User{Id: 1000}
+	handlers := make([]*Handler, 2)
+	users := make([]*models.User, 2)
+
+	for i := range handlers {
+		group := &models.Group{ChatId: -100500, ThreadId: i + 1, Title: "forum"}
+		user := group.UserInGroup(member)
+		users[i] = &user
+		handlers[i] = NewHandler(nil, nil, store, "", nil).withRequest(
+			&request.Request{User: users[i], Member: &models.User{Id: member.Id}, Group: group},
+		)
+		handlers[i].createActiveChat(context.Background(), users[i], nil, "topic chat")
+	}
+
+	for i, handler := range handlers {
+		other := *users[1-i].ActiveChatId
+		chatIds, err := handler.userChatIds(context.Background(), users[i])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(chatIds) != 1 || chatIds[0] != *users[i].ActiveChatId {
+			t.Errorf("topic %d lists the chats %v", i+1, chatIds)
+		}
+
+		if handler.ownsChat(context.Background(), users[i], other) {
+			t.Errorf("topic %d owns the chat of the other topic", i+1)
+		}
+	}
+}
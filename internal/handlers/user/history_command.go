@@ -9,6 +9,7 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"ibuddy_bot/internal/models"
 	"ibuddy_bot/internal/util"
+	"ibuddy_bot/pkg/tgbotclient"
 )
 
 func (h *Handler) handleHistoryCommand(ctx context.Context, message *tgbotapi.Message) {
@@ -27,7 +28,7 @@ func (h *Handler) handleHistoryCommand(ctx context.Context, message *tgbotapi.Me
 	items := make([]string, len(messages))
 	for i, msg := range messages {
 		if msg.Role == models.RoleUser {
-			items[i] = fmt.Sprintf("*Your message*:\n%s", msg.Text)
+			items[i] = fmt.Sprintf("**Your message**:\n%s", textWithPlaceholders(msg, 0))
 		} else {
 			items[i] = fmt.Sprintf("`Assistant's answer`:\n%s", msg.Text)
 		}
@@ -40,7 +41,7 @@ func (h *Handler) handleHistoryCommand(ctx context.Context, message *tgbotapi.Me
 	} else {
 		text = strings.Join(items, "\n\n")
 	}
-	_, err := h.newReplyWithFallback(message, text, tgbotapi.ModeMarkdownV2)
+	_, err := h.newRepliesWithFallback(message, text, tgbotclient.ModeCommonMark)
 
 	if err != nil {
 		log.Println(err)
@@ -2,49 +2,526 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
 )
 
+const (
+	imageActionAgain = "again"
+	imageActionVary  = "vary"
+	imageActionBase  = "base"
+
+	generatedImagePlaceholder = "[generated image: %s]"
+	maxCaptionLength          = 1024
+)
+
+// handleImageCommand generates images for "/image [--option value]... {description}" and stores
+// the description and the images as a turn of the active chat. "/image edit" and "/image variation"
+// change an existing image instead.
 func (h *Handler) handleImageCommand(ctx context.Context, message *tgbotapi.Message) {
-	prompt := strings.TrimSpace(strings.ReplaceAll(message.Text, "/image", ""))
+	user := h.getCurrentUser()
+	args := strings.TrimSpace(message.CommandArguments())
+
+	if operation, rest, _ := strings.Cut(args, " "); operation == imageOperationEdit || operation == imageOperationVariation {
+		h.handleImageEditCommand(ctx, message, operation, rest)
+
+		return
+	}
+
+	prompt, options, err := parseImageCommand(args)
+
+	if err != nil {
+		h.replyImageOptionError(message, user, err)
+
+		return
+	}
 
 	if len(prompt) < 3 {
 		msg := h.newSystemMessage(message.Chat.ID, "Please write more information")
 		msg.ReplyToMessageID = message.MessageID
 		h.bot.Send(msg)
-	} else {
-		resp, err := h.client.CreateImage(
-			ctx,
-			openai.ImageRequest{
-				Prompt:         prompt,
-				Size:           openai.CreateImageSize256x256,
-				ResponseFormat: openai.CreateImageResponseFormatURL,
-				N:              2,
-				User:           strconv.FormatInt(message.From.ID, 10),
-			},
+
+		return
+	}
+
+	if text, ok := h.charge(ctx, imageCosts(options)); !ok {
+		h.newSystemReply(message, text)
+
+		return
+	}
+
+	request := h.storeImageRequest(ctx, user, message, prompt)
+	h.generateImages(ctx, message, user, request, options)
+}
+
+func (h *Handler) replyImageOptionError(message *tgbotapi.Message, user *models.User, err error) {
+	var invalid imageOptionError
+
+	if errors.As(err, &invalid) {
+		h.newSystemReply(
+			message,
+			localization.GetLocalizedText(user.Lang, localization.ImageOptionInvalid, invalid.option, invalid.value, invalid.model),
 		)
 
+		return
+	}
+
+	h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.ImageUsage))
+}
+
+// storeImageRequest stores the text of an image command as a user turn of the active chat, the way
+// handleMessage stores prompts. The returned message has no ObjectId when it could not be stored.
+func (h *Handler) storeImageRequest(
+	ctx context.Context,
+	user *models.User,
+	message *tgbotapi.Message,
+	text string,
+) models.Message {
+	parent, err := h.promptParent(ctx, user, message)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	if parent != nil && (user.ActiveChatId == nil || *user.ActiveChatId != parent.ChatId) {
+		h.changeUserActiveChat(ctx, user, parent.ChatId)
+	}
+
+	if user.ActiveChatId == nil {
+		h.createActiveChat(ctx, user, message, text)
+	}
+
+	request := models.Message{
+		Id:       message.MessageID,
+		UserId:   message.From.ID,
+		Username: message.From.UserName,
+		Role:     models.RoleUser,
+		Text:     text,
+	}
+
+	if parent != nil {
+		request.ParentId = &parent.ObjectId
+	}
+
+	if user.ActiveChatId != nil {
+		request.ChatId = *user.ActiveChatId
+
+		if requestId, err := h.storage.InsertMessage(ctx, request); err != nil {
+			log.Println(err)
+		} else {
+			request.ObjectId = *requestId
+		}
+	}
+
+	return request
+}
+
+// handleImageButton handles "image:{answerId}:{option}:{value}" and "image:{answerId}:again" callbacks,
+// generating the images of the answer again with the option changed, and "image:{answerId}:vary:{index}"
+// and "image:{answerId}:base:{index}" callbacks for a single image of the answer.
+func (h *Handler) handleImageButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	fields := strings.SplitN(strings.TrimPrefix(callbackQuery.Data, ImageDataPrefix), ":", 3)
+	answerId, err := primitive.ObjectIDFromHex(fields[0])
+
+	if err != nil || len(fields) < 2 {
+		h.answerCallback(callbackQuery, "")
+
+		return
+	}
+
+	answer, err := h.findImageAnswer(ctx, user, answerId)
+
+	if err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	if fields[1] == imageActionVary || fields[1] == imageActionBase {
+		h.handleImageResultButton(ctx, callbackQuery, user, answer, fields)
+
+		return
+	}
+
+	if answer.ImageOptions.Operation != "" {
+		h.answerCallback(callbackQuery, "")
+
+		return
+	}
+
+	options := *answer.ImageOptions
+
+	if fields[1] != imageActionAgain && len(fields) == 3 {
+		changed, err := withImageOption(options, fields[1], fields[2])
+
 		if err != nil {
-			fmt.Printf("ChatCompletion error: %v\n", err)
+			h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.SettingsInvalid))
 
-			msg := h.newSystemMessage(message.Chat.ID, "Failed, try again")
-			msg.ReplyToMessageID = message.MessageID
-			h.bot.Send(msg)
 			return
 		}
 
-		files := make([]interface{}, len(resp.Data))
-		for i, url := range resp.Data {
-			files[i] = tgbotapi.NewInputMediaPhoto(tgbotapi.FileURL(url.URL))
+		options = changed
+	}
+
+	request, err := h.storage.GetMessageById(ctx, *answer.ParentId)
+
+	if err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
+
+	if text, ok := h.charge(ctx, imageCosts(options)); !ok {
+		h.answerCallback(callbackQuery, text)
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, formatImageOptions(options))
+	h.bot.SendChatTypingAction(callbackQuery.Message.Chat.ID)
+	h.generateImages(ctx, promptMessage(callbackQuery.Message.Chat, &answer), user, request, options)
+}
+
+// handleImageResultButton makes variations of a single image of the answer or keeps it as the base image.
+func (h *Handler) handleImageResultButton(
+	ctx context.Context,
+	callbackQuery *tgbotapi.CallbackQuery,
+	user *models.User,
+	answer models.Message,
+	fields []string,
+) {
+	index := -1
+
+	if len(fields) == 3 {
+		if value, err := strconv.Atoi(fields[2]); err == nil {
+			index = value
 		}
+	}
+
+	if index < 0 || index >= len(answer.GeneratedImages) || answer.GeneratedImages[index].FileId == "" {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.AnswerNotFound))
+
+		return
+	}
 
-		mediaGroup := tgbotapi.NewMediaGroup(message.Chat.ID, files)
+	image := answer.GeneratedImages[index]
+
+	if fields[1] == imageActionBase {
+		user.BaseImage = &models.Image{FileId: image.FileId, MimeType: photoMimeType}
+
+		if err := h.saveUser(ctx, user); err != nil {
+			log.Println(err)
+			h.answerCallback(callbackQuery, "Failed, try again")
+
+			return
+		}
+
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(user.Lang, localization.ImageBaseSet))
+
+		return
+	}
+
+	options, _ := defaultImageOptions(openai.CreateImageModelDallE2)
+	options.Operation = imageOperationVariation
+
+	if containsString(imageModels[options.Model].sizes, answer.ImageOptions.Size) {
+		options.Size = answer.ImageOptions.Size
+	}
+
+	if text, ok := h.charge(ctx, imageCosts(options)); !ok {
+		h.answerCallback(callbackQuery, text)
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, "")
+	h.bot.SendChatTypingAction(callbackQuery.Message.Chat.ID)
+
+	parts := answerParts(callbackQuery.Message.Chat.ID, &answer)
+	message := &parts[0]
+
+	if index < len(parts) {
+		message = &parts[index]
+	}
+
+	h.transformImage(ctx, message, user, answer, image.FileId, "", options)
+}
+
+// findImageAnswer loads an answer with images of the user.
+func (h *Handler) findImageAnswer(
+	ctx context.Context,
+	user *models.User,
+	answerId primitive.ObjectID,
+) (models.Message, error) {
+	answer, err := h.storage.GetMessageById(ctx, answerId)
+
+	if err != nil {
+		return answer, err
+	}
 
-		h.bot.SendMediaGroup(mediaGroup)
+	if answer.ImageOptions == nil || answer.ParentId == nil {
+		return answer, fmt.Errorf("message %s has no generated images", answerId.Hex())
 	}
+
+	chat, err := h.storage.GetChatById(ctx, answer.ChatId)
+
+	if err != nil {
+		return answer, err
+	}
+
+	if !h.isUserChat(user, chat) {
+		return answer, fmt.Errorf("message %s does not belong to user %d", answerId.Hex(), user.Id)
+	}
+
+	return answer, nil
+}
+
+// generateImages generates images from the description of the request and sends them as its answer.
+func (h *Handler) generateImages(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	user *models.User,
+	request models.Message,
+	options models.ImageOptions,
+) {
+	images, err := h.client.Image(
+		ctx,
+		llm.ImageRequest{
+			Prompt:  request.Text,
+			Model:   options.Model,
+			Size:    options.Size,
+			N:       options.N,
+			Quality: options.Quality,
+			Style:   options.Style,
+			User:    strconv.FormatInt(user.Id, 10),
+		},
+	)
+
+	if err != nil {
+		log.Println(err)
+		h.newSystemReply(message, modelErrorText(user.Lang, err))
+
+		return
+	}
+
+	h.sendImageAnswer(ctx, message, user, request, options, images)
+}
+
+// sendImageAnswer sends the images in reply to the message, followed by a keyboard to adjust the options
+// or continue from one of the images, and stores them as the answer to the parent when it is part of a chat.
+func (h *Handler) sendImageAnswer(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	user *models.User,
+	parent models.Message,
+	options models.ImageOptions,
+	images []llm.Image,
+) {
+	sent, err := h.sendImages(message, images)
+
+	if err != nil || len(sent) == 0 {
+		log.Println(err)
+		h.newSystemReply(message, "Failed, try again")
+
+		return
+	}
+
+	answer := models.Message{
+		Id:           sent[0].MessageID,
+		PartIds:      messageIds(sent),
+		ChatId:       parent.ChatId,
+		ReplyToId:    &message.MessageID,
+		ParentId:     &parent.ObjectId,
+		UserId:       h.bot.Self.ID,
+		Username:     h.bot.Self.UserName,
+		Role:         models.RoleAssistant,
+		ImageOptions: &options,
+	}
+
+	for i, msg := range sent {
+		image := models.GeneratedImage{}
+
+		if len(msg.Photo) > 0 {
+			image.FileId = msg.Photo[len(msg.Photo)-1].FileID
+		}
+
+		if i < len(images) {
+			image.RevisedPrompt = images[i].RevisedPrompt
+		}
+
+		answer.GeneratedImages = append(answer.GeneratedImages, image)
+	}
+
+	answer.Text = generatedImagesText(answer.GeneratedImages)
+
+	if parent.ObjectId.IsZero() {
+		return
+	}
+
+	answerId, err := h.storage.InsertMessage(ctx, answer)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	text := localization.GetLocalizedText(user.Lang, localization.ImageResults)
+
+	if options.Operation == "" {
+		text = localization.GetLocalizedText(user.Lang, localization.ImageOptions, formatImageOptions(options))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = sent[0].MessageID
+	msg.ReplyMarkup = imageAnswerKeyboard(answerId.Hex(), options, len(sent))
+
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println(err)
+	}
+}
+
+// sendImages sends a single image as a photo and several as an album, with the revised prompt as the caption.
+func (h *Handler) sendImages(message *tgbotapi.Message, images []llm.Image) ([]tgbotapi.Message, error) {
+	caption := ""
+
+	if len(images) > 0 {
+		caption = tgbotclient.TruncateText(images[0].RevisedPrompt, maxCaptionLength)
+	}
+
+	if len(images) == 1 {
+		photo := tgbotapi.NewPhoto(message.Chat.ID, tgbotapi.FileURL(images[0].URL))
+		photo.Caption = caption
+		photo.ReplyToMessageID = message.MessageID
+
+		sent, err := h.bot.Send(photo)
+
+		return []tgbotapi.Message{sent}, err
+	}
+
+	files := make([]interface{}, len(images))
+
+	for i, image := range images {
+		photo := tgbotapi.NewInputMediaPhoto(tgbotapi.FileURL(image.URL))
+
+		if i == 0 {
+			photo.Caption = caption
+		}
+
+		files[i] = photo
+	}
+
+	mediaGroup := tgbotapi.NewMediaGroup(message.Chat.ID, files)
+	mediaGroup.ReplyToMessageID = message.MessageID
+
+	return h.bot.SendMediaGroup(mediaGroup)
+}
+
+// imageAnswerKeyboard offers the values of every option the model supports, tapping one generates again,
+// and buttons to vary each of the images or to use it as the base for edits.
+func imageAnswerKeyboard(answerId string, options models.ImageOptions, count int) tgbotapi.InlineKeyboardMarkup {
+	spec := imageModels[options.Model]
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+
+	if options.Operation == "" {
+		rows = append(
+			rows,
+			imageOptionRow(answerId, imageOptionSize, spec.sizes, options.Size),
+			imageOptionRow(answerId, imageOptionModel, imageModelNames, options.Model),
+		)
+
+		if spec.maxN > 1 {
+			counts := make([]string, len(imageCountButtons))
+
+			for i, n := range imageCountButtons {
+				counts[i] = strconv.Itoa(n)
+			}
+
+			rows = append(rows, imageOptionRow(answerId, imageOptionN, counts, strconv.Itoa(options.N)))
+		}
+
+		if len(spec.qualities) > 0 {
+			rows = append(rows, imageOptionRow(answerId, imageOptionQuality, spec.qualities, options.Quality))
+		}
+
+		if len(spec.styles) > 0 {
+			rows = append(rows, imageOptionRow(answerId, imageOptionStyle, spec.styles, options.Style))
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		vary, base := "🔀 More variations", "🖼 Use as base"
+
+		if count > 1 {
+			vary, base = fmt.Sprintf("🔀 More like %d", i+1), fmt.Sprintf("🖼 Use %d as base", i+1)
+		}
+
+		rows = append(
+			rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(vary, fmt.Sprintf("%s%s:%s:%d", ImageDataPrefix, answerId, imageActionVary, i)),
+				tgbotapi.NewInlineKeyboardButtonData(base, fmt.Sprintf("%s%s:%s:%d", ImageDataPrefix, answerId, imageActionBase, i)),
+			),
+		)
+	}
+
+	if options.Operation == "" {
+		rows = append(
+			rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔁 Generate again", ImageDataPrefix+answerId+":"+imageActionAgain),
+			),
+		)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func imageOptionRow(answerId string, option string, values []string, current string) []tgbotapi.InlineKeyboardButton {
+	row := make([]tgbotapi.InlineKeyboardButton, len(values))
+
+	for i, value := range values {
+		text := value
+
+		if option == imageOptionN {
+			text = "×" + value
+		}
+
+		if value == current {
+			text = fmt.Sprintf("✅ %s", text)
+		}
+
+		row[i] = tgbotapi.NewInlineKeyboardButtonData(text, fmt.Sprintf("%s%s:%s:%s", ImageDataPrefix, answerId, option, value))
+	}
+
+	return row
+}
+
+// generatedImagesText describes the generated images in the chat history.
+func generatedImagesText(images []models.GeneratedImage) string {
+	lines := make([]string, len(images))
+
+	for i, image := range images {
+		if image.RevisedPrompt == "" {
+			lines[i] = imagePlaceholder
+		} else {
+			lines[i] = fmt.Sprintf(generatedImagePlaceholder, image.RevisedPrompt)
+		}
+	}
+
+	return strings.Join(lines, "\n")
 }
@@ -0,0 +1,195 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/util"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	imageOperationEdit      = llm.ImageEdit
+	imageOperationVariation = llm.ImageVariation
+
+	imageVariationText = "[image variation]"
+
+	// maxImageEditSize is the largest PNG the edit and variation APIs accept.
+	maxImageEditSize = 4 << 20
+)
+
+// imageEditSides are the square sizes tried, largest first, until the PNG fits maxImageEditSize.
+var imageEditSides = []int{1024, 512, 256}
+
+// handleImageEditCommand handles "/image edit [--option value]... {description}" and
+// "/image variation [--option value]..." sent in reply to a photo, or without a reply to
+// change the base image picked with "Use as base".
+func (h *Handler) handleImageEditCommand(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	operation string,
+	args string,
+) {
+	user := h.getCurrentUser()
+	prompt, options, err := parseImageCommand(args)
+
+	if err == nil && options.Model != openai.CreateImageModelDallE2 {
+		err = imageOptionError{option: imageOptionModel, value: options.Model, model: "/image " + operation}
+	}
+
+	if err != nil {
+		h.replyImageOptionError(message, user, err)
+
+		return
+	}
+
+	source := imageEditSource(message, user)
+
+	if source == nil || (operation == imageOperationEdit && len(prompt) < 3) {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.ImageEditUsage))
+
+		return
+	}
+
+	text := prompt
+
+	if operation == imageOperationVariation {
+		text = imageVariationText
+		prompt = ""
+	}
+
+	if text, ok := h.charge(ctx, imageCosts(options)); !ok {
+		h.newSystemReply(message, text)
+
+		return
+	}
+
+	options.Operation = operation
+	request := h.storeImageRequest(ctx, user, message, text)
+	h.transformImage(ctx, message, user, request, source.FileId, prompt, options)
+}
+
+// imageEditSource returns the replied-to photo or image document, or else the user's base image.
+func imageEditSource(message *tgbotapi.Message, user *models.User) *models.Image {
+	if message.ReplyToMessage != nil {
+		if images := messageImages(message.ReplyToMessage); len(images) > 0 {
+			return &images[0]
+		}
+	}
+
+	return user.BaseImage
+}
+
+// transformImage edits the image with the prompt, or makes variations of it when the prompt is empty,
+// and sends the results as the answer to the parent.
+func (h *Handler) transformImage(
+	ctx context.Context,
+	message *tgbotapi.Message,
+	user *models.User,
+	parent models.Message,
+	fileId string,
+	prompt string,
+	options models.ImageOptions,
+) {
+	images, err := h.requestImageTransform(ctx, fileId, prompt, options)
+
+	if err != nil {
+		log.Println(err)
+		h.newSystemReply(message, modelErrorText(user.Lang, err))
+
+		return
+	}
+
+	h.sendImageAnswer(ctx, message, user, parent, options, images)
+}
+
+func (h *Handler) requestImageTransform(
+	ctx context.Context,
+	fileId string,
+	prompt string,
+	options models.ImageOptions,
+) ([]llm.Image, error) {
+	fileUrl, err := h.bot.GetFileDirectURL(fileId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := util.DownloadBytesByUrl(fileUrl)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", fileId, err)
+	}
+
+	imagePNG, transparent, err := editableImage(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := util.WriteTempFile("image*.png", imagePNG)
+
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(image.Name())
+	image.Close()
+
+	request := llm.ImageRequest{
+		Operation: options.Operation,
+		Model:     options.Model,
+		N:         options.N,
+		Size:      options.Size,
+		ImagePath: image.Name(),
+	}
+
+	if options.Operation == imageOperationVariation {
+		return h.client.Image(ctx, request)
+	}
+
+	request.Prompt = prompt
+
+	// Transparent pixels mark the area to change, an opaque photo is changed as a whole.
+	if !transparent {
+		maskPNG, err := util.TransparentMask(imagePNG)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mask, err := util.WriteTempFile("mask*.png", maskPNG)
+
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(mask.Name())
+		mask.Close()
+
+		request.MaskPath = mask.Name()
+	}
+
+	return h.client.Image(ctx, request)
+}
+
+// editableImage converts the image to the largest square PNG within the API size limit.
+func editableImage(data []byte) ([]byte, bool, error) {
+	for _, side := range imageEditSides {
+		imagePNG, transparent, err := util.SquarePNG(data, side)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if len(imagePNG) <= maxImageEditSize {
+			return imagePNG, transparent, nil
+		}
+	}
+
+	return nil, false, fmt.Errorf("image does not fit %d bytes", maxImageEditSize)
+}
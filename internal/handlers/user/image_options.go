@@ -0,0 +1,236 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
+)
+
+const (
+	imageOptionModel   = "model"
+	imageOptionSize    = "size"
+	imageOptionN       = "n"
+	imageOptionQuality = "quality"
+	imageOptionStyle   = "style"
+
+	defaultImageModel = openai.CreateImageModelDallE2
+)
+
+// imageModel lists what the image API accepts for a model, the first value of each list is the default.
+type imageModel struct {
+	sizes     []string
+	n         int
+	maxN      int
+	qualities []string
+	styles    []string
+}
+
+var (
+	imageModelNames = []string{openai.CreateImageModelDallE2, openai.CreateImageModelDallE3}
+
+	imageModels = map[string]imageModel{
+		openai.CreateImageModelDallE2: {
+			sizes: []string{
+				openai.CreateImageSize256x256,
+				openai.CreateImageSize512x512,
+				openai.CreateImageSize1024x1024,
+			},
+			n:    2,
+			maxN: 10,
+		},
+		openai.CreateImageModelDallE3: {
+			sizes: []string{
+				openai.CreateImageSize1024x1024,
+				openai.CreateImageSize1792x1024,
+				openai.CreateImageSize1024x1792,
+			},
+			n:         1,
+			maxN:      1,
+			qualities: []string{openai.CreateImageQualityStandard, openai.CreateImageQualityHD},
+			styles:    []string{openai.CreateImageStyleVivid, openai.CreateImageStyleNatural},
+		},
+	}
+
+	// imageCountButtons are the numbers of images offered on the keyboard of models generating several.
+	imageCountButtons = []int{1, 2, 4}
+
+	errUnknownImageOption = errors.New("unknown image option")
+)
+
+// imageOptionError rejects an option value the model does not support.
+type imageOptionError struct {
+	option string
+	value  string
+	model  string
+}
+
+func (e imageOptionError) Error() string {
+	return fmt.Sprintf("%s %s is not supported by %s", e.option, e.value, e.model)
+}
+
+// parseImageCommand separates "--option value" and "--option=value" pairs from the prompt and
+// applies them over the defaults of the chosen model.
+func parseImageCommand(args string) (string, models.ImageOptions, error) {
+	values := make(map[string]string)
+	words := make([]string, 0)
+	fields := strings.Fields(args)
+
+	for i := 0; i < len(fields); i++ {
+		if !strings.HasPrefix(fields[i], "--") {
+			words = append(words, fields[i])
+
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(fields[i], "--"), "=")
+
+		if !ok {
+			if i+1 == len(fields) {
+				return "", models.ImageOptions{}, errUnknownImageOption
+			}
+
+			i++
+			value = fields[i]
+		}
+
+		values[strings.ToLower(name)] = strings.ToLower(value)
+	}
+
+	model := defaultImageModel
+
+	if value, ok := values[imageOptionModel]; ok {
+		model = value
+		delete(values, imageOptionModel)
+	}
+
+	options, err := defaultImageOptions(model)
+
+	if err != nil {
+		return "", options, err
+	}
+
+	for _, name := range []string{imageOptionSize, imageOptionN, imageOptionQuality, imageOptionStyle} {
+		if value, ok := values[name]; ok {
+			if options, err = withImageOption(options, name, value); err != nil {
+				return "", options, err
+			}
+
+			delete(values, name)
+		}
+	}
+
+	if len(values) > 0 {
+		return "", options, errUnknownImageOption
+	}
+
+	return strings.Join(words, " "), options, nil
+}
+
+func defaultImageOptions(model string) (models.ImageOptions, error) {
+	spec, ok := imageModels[model]
+
+	if !ok {
+		return models.ImageOptions{}, imageOptionError{option: imageOptionModel, value: model, model: "the image API"}
+	}
+
+	options := models.ImageOptions{Model: model, Size: spec.sizes[0], N: spec.n}
+
+	if len(spec.qualities) > 0 {
+		options.Quality = spec.qualities[0]
+	}
+
+	if len(spec.styles) > 0 {
+		options.Style = spec.styles[0]
+	}
+
+	return options, nil
+}
+
+// withImageOption changes a single option. Switching the model keeps the size when the new model supports it.
+func withImageOption(options models.ImageOptions, name string, value string) (models.ImageOptions, error) {
+	spec := imageModels[options.Model]
+	invalid := imageOptionError{option: name, value: value, model: options.Model}
+
+	switch name {
+	case imageOptionModel:
+		changed, err := defaultImageOptions(value)
+
+		if err != nil {
+			return options, err
+		}
+
+		if containsString(imageModels[value].sizes, options.Size) {
+			changed.Size = options.Size
+		}
+
+		return changed, nil
+	case imageOptionSize:
+		if !containsString(spec.sizes, value) {
+			return options, invalid
+		}
+
+		options.Size = value
+	case imageOptionN:
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 || n > spec.maxN {
+			return options, invalid
+		}
+
+		options.N = n
+	case imageOptionQuality:
+		if !containsString(spec.qualities, value) {
+			return options, invalid
+		}
+
+		options.Quality = value
+	case imageOptionStyle:
+		if !containsString(spec.styles, value) {
+			return options, invalid
+		}
+
+		options.Style = value
+	default:
+		return options, errUnknownImageOption
+	}
+
+	return options, nil
+}
+
+// imageCosts returns what generating the images of the options takes from the rate limits.
+func imageCosts(options models.ImageOptions) map[string]float64 {
+	return map[string]float64{ratelimit.Images: float64(options.N) * ratelimit.ImageCost(options.Model, options.Quality)}
+}
+
+func formatImageOptions(options models.ImageOptions) string {
+	parts := []string{options.Model, options.Size}
+
+	if options.N > 1 {
+		parts = append(parts, fmt.Sprintf("n=%d", options.N))
+	}
+
+	if options.Quality != "" {
+		parts = append(parts, options.Quality)
+	}
+
+	if options.Style != "" {
+		parts = append(parts, options.Style)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/util"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	// maxContextImages bounds how many of the latest images are sent along with the context,
+	// older ones are only mentioned by imagePlaceholder.
+	maxContextImages = 4
+	imagePlaceholder = "[image]"
+
+	documentPlaceholder = "[document: %s]"
+
+	photoMimeType = "image/jpeg"
+)
+
+// imageMimeTypes are the image formats the vision models accept.
+var imageMimeTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// messageImages returns the image attached to the message: the largest size of a photo or an image document.
+func messageImages(message *tgbotapi.Message) []models.Image {
+	if len(message.Photo) > 0 {
+		return []models.Image{{FileId: message.Photo[len(message.Photo)-1].FileID, MimeType: photoMimeType}}
+	}
+
+	if message.Document != nil && isImageMimeType(message.Document.MimeType) {
+		return []models.Image{{FileId: message.Document.FileID, MimeType: message.Document.MimeType}}
+	}
+
+	return nil
+}
+
+// loadImages downloads the latest images of the prompt and its history, keyed by message.
+// Telegram file URLs contain the bot token, so the images are inlined as data URLs instead of linked.
+func (h *Handler) loadImages(history []models.Message, prompt models.Message) map[primitive.ObjectID][]string {
+	images := make(map[primitive.ObjectID][]string)
+	left := maxContextImages
+
+	load := func(msg models.Message) {
+		for _, image := range msg.Images {
+			if left == 0 {
+				return
+			}
+
+			dataUrl, err := h.imageDataUrl(image)
+
+			if err != nil {
+				log.Println(err)
+
+				continue
+			}
+
+			images[msg.ObjectId] = append(images[msg.ObjectId], dataUrl)
+			left--
+		}
+	}
+
+	load(prompt)
+
+	for i := len(history) - 1; i >= 0 && left > 0; i-- {
+		load(history[i])
+	}
+
+	return images
+}
+
+func (h *Handler) imageDataUrl(image models.Image) (string, error) {
+	fileUrl, err := h.bot.GetFileDirectURL(image.FileId)
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := util.DownloadBytesByUrl(fileUrl)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to download image %s: %w", image.FileId, err)
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", image.MimeType, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// imageParts turns the message into text and image content parts.
+func imageParts(msg models.Message, images []string) []llm.Part {
+	text := textWithPlaceholders(msg, len(images))
+	parts := make([]llm.Part, 0, len(images)+1)
+
+	if text != "" {
+		parts = append(parts, llm.Part{Text: text})
+	}
+
+	for _, image := range images {
+		parts = append(parts, llm.Part{ImageURL: image})
+	}
+
+	return parts
+}
+
+// textWithPlaceholders mentions the shared document and the images of the message beyond
+// the first loaded ones in its text.
+func textWithPlaceholders(msg models.Message, loaded int) string {
+	text := msg.Text
+
+	if msg.Document != "" {
+		text = strings.TrimSpace(fmt.Sprintf(documentPlaceholder, msg.Document) + "\n" + text)
+	}
+
+	if missing := len(msg.Images) - loaded; missing > 0 {
+		text = strings.TrimSpace(text + "\n" + strings.Repeat(imagePlaceholder, missing))
+	}
+
+	return text
+}
+
+func hasImages(messages ...models.Message) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isImageMimeType(mimeType string) bool {
+	for _, t := range imageMimeTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,435 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+const (
+	// inlineDebounce is how long the user has to stop typing before the query is answered,
+	// Telegram sends a new inline query on almost every keystroke.
+	inlineDebounce = 700 * time.Millisecond
+	// inlineTimeout keeps the answer within the about 10 seconds Telegram waits for inline results,
+	// leaving room for inlineDebounce and sending the results.
+	inlineTimeout        = 6 * time.Second
+	inlineMaxTokens      = 600
+	inlineMinQueryLength = 3
+	inlineCacheTTL       = 30 * time.Minute
+	inlineCacheSize      = 1000
+	inlineRateLimit      = 10
+	inlineRateWindow     = time.Minute
+	// inlineCacheTime is how long Telegram may show the same results again without asking the bot.
+	inlineCacheTime = 300
+
+	inlineResultAnswer      = "answer"
+	inlineResultShort       = "short"
+	inlineResultTranslation = "translation"
+
+	inlineInstructions = "The user is about to send your answer to their question to another chat. " +
+		"Reply only with a JSON object with the keys \"answer\" (a complete but concise answer), " +
+		"\"short\" (the answer in one sentence) and \"translation\" (the complete answer translated " +
+		"into the language with the code %q, or into English when the question is already in that language). " +
+		"The values may use Markdown."
+)
+
+var errInlineRateLimited = errors.New("too many inline queries")
+
+// inlineAnswers are the results generated for an inline query.
+type inlineAnswers struct {
+	Answer      string `json:"answer"`
+	Short       string `json:"short"`
+	Translation string `json:"translation"`
+	createdAt   time.Time
+}
+
+// text returns the text of the result with the id, as sent by Telegram when a result is chosen.
+func (a inlineAnswers) text(resultId string) string {
+	switch resultId {
+	case inlineResultAnswer:
+		return a.Answer
+	case inlineResultShort:
+		return a.Short
+	case inlineResultTranslation:
+		return a.Translation
+	}
+
+	return ""
+}
+
+// inlineState is shared by all the workers: the query each user typed last, the recent
+// completions of each user for rate limiting and the answers cached by query text.
+type inlineState struct {
+	mu       sync.Mutex
+	latest   map[int64]string
+	requests map[int64][]time.Time
+	answers  map[string]inlineAnswers
+	order    []string
+}
+
+func newInlineState() *inlineState {
+	return &inlineState{
+		latest:   make(map[int64]string),
+		requests: make(map[int64][]time.Time),
+		answers:  make(map[string]inlineAnswers),
+	}
+}
+
+func (s *inlineState) setLatest(userId int64, queryId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latest[userId] = queryId
+}
+
+// isLatest tells whether the query is still the last one the user typed.
+func (s *inlineState) isLatest(userId int64, queryId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.latest[userId] == queryId
+}
+
+// allow records a completion for the user unless they already made inlineRateLimit of them
+// within inlineRateWindow.
+func (s *inlineState) allow(userId int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	recent := make([]time.Time, 0, len(s.requests[userId])+1)
+
+	for _, at := range s.requests[userId] {
+		if now.Sub(at) < inlineRateWindow {
+			recent = append(recent, at)
+		}
+	}
+
+	if len(recent) >= inlineRateLimit {
+		s.requests[userId] = recent
+
+		return false
+	}
+
+	s.requests[userId] = append(recent, now)
+
+	return true
+}
+
+func (s *inlineState) get(key string) (inlineAnswers, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	answers, ok := s.answers[key]
+
+	if !ok || time.Since(answers.createdAt) > inlineCacheTTL {
+		return inlineAnswers{}, false
+	}
+
+	return answers, true
+}
+
+// put caches the answers, dropping the oldest ones once there are more than inlineCacheSize.
+func (s *inlineState) put(key string, answers inlineAnswers) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.answers[key]; !ok {
+		s.order = append(s.order, key)
+	}
+
+	answers.createdAt = time.Now()
+	s.answers[key] = answers
+
+	for len(s.order) > inlineCacheSize {
+		delete(s.answers, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// inlineCacheKey identifies the answers to a query, they depend on the model and the language too.
+func inlineCacheKey(user *models.User, query string) string {
+	return strings.Join([]string{user.Lang, user.GetModel(), strings.ToLower(strings.TrimSpace(query))}, "\n")
+}
+
+// handleInlineQuery answers "@bot question" typed in any chat. The completion only starts once the
+// user stopped typing for inlineDebounce, so the workers are not blocked and superseded queries are dropped.
+// Inline mode has to be enabled for the bot with /setinline in @BotFather.
+func (h *Handler) handleInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	user := *h.getCurrentUser()
+
+	if len([]rune(strings.TrimSpace(query.Query))) < inlineMinQueryLength {
+		return
+	}
+
+	key := inlineCacheKey(&user, query.Query)
+
+	if answers, ok := h.inline.get(key); ok {
+		h.answerInlineQuery(query, &user, answers)
+
+		return
+	}
+
+	h.inline.setLatest(user.Id, query.ID)
+
+	go func() {
+		time.Sleep(inlineDebounce)
+
+		if !h.inline.isLatest(user.Id, query.ID) {
+			return
+		}
+
+		answers, err := h.inlineAnswers(ctx, &user, query.Query)
+
+		if errors.Is(err, errInlineRateLimited) {
+			h.answerInlineRateLimited(query, &user)
+
+			return
+		}
+
+		if err != nil {
+			log.Println(err)
+
+			return
+		}
+
+		h.inline.put(key, answers)
+		h.answerInlineQuery(query, &user, answers)
+	}()
+}
+
+// inlineAnswers asks the user's model for the answer, a shorter answer and a translated answer at once.
+func (h *Handler) inlineAnswers(ctx context.Context, user *models.User, query string) (inlineAnswers, error) {
+	if !h.inline.allow(user.Id) {
+		return inlineAnswers{}, errInlineRateLimited
+	}
+
+	if ok, _ := h.request.Take(ctx, map[string]float64{ratelimit.Messages: 1}); !ok {
+		return inlineAnswers{}, errInlineRateLimited
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, inlineTimeout)
+	defer cancel()
+
+	model := user.GetModel()
+	maxTokens := h.completionMaxTokens(user, model)
+
+	if maxTokens > inlineMaxTokens {
+		maxTokens = inlineMaxTokens
+	}
+
+	lang := user.Lang
+
+	if lang == "" {
+		lang = "en"
+	}
+
+	resp, err := h.client.Chat(
+		ctx,
+		llm.ChatRequest{
+			Model: model,
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: fmt.Sprintf(inlineInstructions, lang)},
+				{Role: llm.RoleUser, Content: query},
+			},
+			MaxTokens:   maxTokens,
+			Temperature: user.GetTemperature(),
+			User:        strconv.FormatInt(user.Id, 10),
+		},
+	)
+
+	if err != nil {
+		return inlineAnswers{}, err
+	}
+
+	return parseInlineAnswers(resp.Content)
+}
+
+// parseInlineAnswers reads the JSON object of answers, ignoring any text the model put around it.
+// When the model answered without JSON its reply is used as the answer.
+func parseInlineAnswers(content string) (inlineAnswers, error) {
+	var answers inlineAnswers
+
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+
+	if start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(content[start:end+1]), &answers); err != nil {
+			log.Println(err)
+		}
+	}
+
+	answers.Answer = strings.TrimSpace(answers.Answer)
+	answers.Short = strings.TrimSpace(answers.Short)
+	answers.Translation = strings.TrimSpace(answers.Translation)
+
+	if answers.Answer == "" {
+		answers = inlineAnswers{Answer: strings.TrimSpace(content)}
+	}
+
+	if answers.Answer == "" {
+		return answers, errors.New("empty inline answer")
+	}
+
+	return answers, nil
+}
+
+func (h *Handler) answerInlineQuery(query *tgbotapi.InlineQuery, user *models.User, answers inlineAnswers) {
+	results := make([]interface{}, 0, 3)
+
+	for _, result := range []struct {
+		id    string
+		title string
+	}{
+		{inlineResultAnswer, localization.InlineAnswer},
+		{inlineResultShort, localization.InlineShortAnswer},
+		{inlineResultTranslation, localization.InlineTranslation},
+	} {
+		text := answers.text(result.id)
+
+		if text == "" || (result.id != inlineResultAnswer && text == answers.Answer) {
+			continue
+		}
+
+		article := tgbotapi.NewInlineQueryResultArticleHTML(
+			result.id,
+			localization.GetLocalizedText(user.Lang, result.title),
+			tgbotclient.RenderHTML(tgbotclient.SplitMarkdown(text, tgbotclient.MaxMessageLength)[0]),
+		)
+		article.Description = tgbotclient.TruncateText(tgbotclient.RenderPlainText(text), 100)
+		results = append(results, article)
+	}
+
+	_, err := h.bot.Request(tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// answerInlineRateLimited shows no results but a button to the private chat with the bot instead.
+func (h *Handler) answerInlineRateLimited(query *tgbotapi.InlineQuery, user *models.User) {
+	_, err := h.bot.Request(tgbotapi.InlineConfig{
+		InlineQueryID:     query.ID,
+		Results:           []interface{}{},
+		IsPersonal:        true,
+		SwitchPMText:      localization.GetLocalizedText(user.Lang, localization.InlineRateLimited),
+		SwitchPMParameter: "inline",
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// handleChosenInlineResult logs the query and the answer the user sent to the user's inline chat.
+// Telegram only reports chosen results with inline feedback enabled, see /setinlinefeedback in @BotFather.
+func (h *Handler) handleChosenInlineResult(ctx context.Context, result *tgbotapi.ChosenInlineResult) {
+	user := h.getCurrentUser()
+	answers, ok := h.inline.get(inlineCacheKey(user, result.Query))
+
+	if !ok || answers.text(result.ResultID) == "" {
+		return
+	}
+
+	chat, err := h.inlineChat(ctx, user)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	var parentId *primitive.ObjectID
+	limit := int64(1)
+	last, err := h.storage.ListChatMessages(ctx, chat.Id, &limit)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if len(last) > 0 {
+		parentId = &last[0].ObjectId
+	}
+
+	promptId, err := h.storage.InsertMessage(ctx, models.Message{
+		ChatId:   chat.Id,
+		ParentId: parentId,
+		UserId:   user.Id,
+		Username: user.Username,
+		Role:     models.RoleUser,
+		Text:     result.Query,
+	})
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	_, err = h.storage.InsertMessage(ctx, models.Message{
+		ChatId:   chat.Id,
+		ParentId: promptId,
+		UserId:   h.bot.Self.ID,
+		Username: h.bot.Self.UserName,
+		Role:     models.RoleAssistant,
+		Text:     answers.text(result.ResultID),
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// inlineChat returns the user's chat of inline answers, creating it on the first chosen result.
+// It is not made the active chat, the user keeps talking to the bot where they were.
+func (h *Handler) inlineChat(ctx context.Context, user *models.User) (models.Chat, error) {
+	chats, err := h.storage.ListUserChats(ctx, user.Id, 0)
+
+	if err != nil {
+		return models.Chat{}, err
+	}
+
+	for _, chat := range chats {
+		if chat.Inline {
+			return chat, nil
+		}
+	}
+
+	chat := models.Chat{
+		UserId:   user.Id,
+		Username: user.Username,
+		Title:    localization.GetLocalizedText(user.Lang, localization.InlineChatTitle),
+		Inline:   true,
+	}
+	res, err := h.storage.CreateChat(ctx, chat)
+
+	if err != nil {
+		return models.Chat{}, err
+	}
+
+	chat.Id, _ = res.InsertedID.(primitive.ObjectID)
+
+	return chat, nil
+}
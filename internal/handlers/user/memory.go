@@ -0,0 +1,209 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tokenizer"
+)
+
+const (
+	maxMemories      = 50
+	maxMemoryLength  = 200
+	memoryMaxTokens  = 300
+	memoryTranscript = 3000
+
+	memoryInstructions = "You keep a list of durable facts about the user: who they are, what they work on, " +
+		"their preferences for answers (language, tone, format) and anything they asked to remember. " +
+		"Read the conversation and reply with a JSON array of strings holding only new facts that are not in " +
+		"the known facts and will still matter in future conversations. Skip facts about the current task, " +
+		"one-off requests and anything about the assistant. Write each fact as a short sentence about the user. " +
+		"Reply with [] when there is nothing new."
+	memorySystemMessage = "Facts about the user from earlier conversations, take them into account:\n%s"
+)
+
+// memoryMessages returns the system messages that carry the user's remembered facts into the context.
+func (h *Handler) memoryMessages(ctx context.Context, user *models.User) []llm.Message {
+	if user.MemoryDisabled {
+		return nil
+	}
+
+	memories, err := h.storage.ListUserMemories(ctx, user.Id)
+
+	if err != nil {
+		log.Println(err)
+
+		return nil
+	}
+
+	if len(memories) == 0 {
+		return nil
+	}
+
+	return []llm.Message{
+		{
+			Role:    llm.RoleSystem,
+			Content: fmt.Sprintf(memorySystemMessage, memoryList(memories)),
+		},
+	}
+}
+
+// rememberChat looks through the messages of the chat that were not seen yet for facts worth
+// remembering about the user. It runs in the background, the user gets nothing to wait for.
+func (h *Handler) rememberChat(ctx context.Context, user models.User, chatId primitive.ObjectID) {
+	if user.MemoryDisabled {
+		return
+	}
+
+	go func() {
+		if err := h.extractMemories(ctx, &user, chatId); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+func (h *Handler) extractMemories(ctx context.Context, user *models.User, chatId primitive.ObjectID) error {
+	chat, err := h.storage.GetChatById(ctx, chatId)
+
+	if err != nil {
+		return err
+	}
+
+	messages, err := h.storage.ListChatMessagesBetween(ctx, chatId, chat.MemorizedUntil, primitive.NewObjectID())
+
+	if err != nil || len(messages) == 0 {
+		return err
+	}
+
+	memories, err := h.storage.ListUserMemories(ctx, user.Id)
+
+	if err != nil {
+		return err
+	}
+
+	if left := maxMemories - len(memories); left > 0 {
+		facts, err := h.extractFacts(ctx, user, memories, messages)
+
+		if err != nil {
+			return err
+		}
+
+		if len(facts) > left {
+			facts = facts[:left]
+		}
+
+		for _, fact := range facts {
+			if _, err := h.storage.InsertMemory(ctx, models.Memory{UserId: user.Id, Text: fact}); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The chat may have changed while the model was answering.
+	chat, err = h.storage.GetChatById(ctx, chatId)
+
+	if err != nil {
+		return err
+	}
+
+	chat.MemorizedUntil = &messages[len(messages)-1].ObjectId
+	_, err = h.storage.UpdateChat(ctx, &chat)
+
+	return err
+}
+
+// extractFacts asks the model for new facts in the latest part of the messages that fits the transcript budget.
+func (h *Handler) extractFacts(
+	ctx context.Context,
+	user *models.User,
+	memories []models.Memory,
+	messages []models.Message,
+) ([]string, error) {
+	t, err := tokenizer.ForModel(user.GetModel())
+
+	if err != nil {
+		return nil, err
+	}
+
+	budget := memoryTranscript
+	lines := make([]string, 0)
+
+	for i := len(messages) - 1; i >= 0 && budget > 0; i-- {
+		line := t.Truncate(transcriptLine(messages[i]), budget)
+		budget -= t.Count(line)
+		lines = append([]string{line}, lines...)
+	}
+
+	known := memoryList(memories)
+
+	if known == "" {
+		known = "none"
+	}
+
+	resp, err := h.client.Chat(
+		ctx,
+		llm.ChatRequest{
+			Model: user.GetModel(),
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: memoryInstructions},
+				{
+					Role:    llm.RoleUser,
+					Content: fmt.Sprintf("Known facts:\n%s\n\nConversation:\n%s", known, strings.Join(lines, "\n")),
+				},
+			},
+			MaxTokens: memoryMaxTokens,
+			User:      strconv.FormatInt(user.Id, 10),
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFacts(resp.Content), nil
+}
+
+// parseFacts reads the JSON array of facts, ignoring any text the model put around it.
+func parseFacts(content string) []string {
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var values []string
+
+	if err := json.Unmarshal([]byte(content[start:end+1]), &values); err != nil {
+		log.Println(err)
+
+		return nil
+	}
+
+	facts := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" && len([]rune(value)) <= maxMemoryLength {
+			facts = append(facts, value)
+		}
+	}
+
+	return facts
+}
+
+func memoryList(memories []models.Memory) string {
+	lines := make([]string, len(memories))
+
+	for i, memory := range memories {
+		lines[i] = fmt.Sprintf("- %s", memory.Text)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,257 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+const (
+	memoryActionDelete = "delete"
+	memoryActionToggle = "toggle"
+	memoryActionClear  = "clear"
+
+	memoryEditArgument = "edit"
+	memoryAddArgument  = "add"
+
+	memoryDeleteButtonsPerRow = 5
+)
+
+// handleMemoryCommand shows the remembered facts, "/memory [add] <fact>" adds one
+// and "/memory edit <number> <fact>" replaces one.
+func (h *Handler) handleMemoryCommand(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+	args := strings.TrimSpace(message.CommandArguments())
+
+	if args == "" {
+		text, markup, err := h.memoryView(ctx, user)
+
+		if err != nil {
+			log.Println(err)
+			h.newSystemReply(message, "Failed, try again")
+
+			return
+		}
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ReplyMarkup = markup
+		msg.ReplyToMessageID = message.MessageID
+
+		if _, err := h.bot.Send(msg); err != nil {
+			log.Println(err)
+		}
+
+		return
+	}
+
+	memories, err := h.storage.ListUserMemories(ctx, user.Id)
+
+	if err != nil {
+		log.Println(err)
+		h.newSystemReply(message, "Failed, try again")
+
+		return
+	}
+
+	var reply string
+
+	if command, rest, _ := strings.Cut(args, " "); command == memoryEditArgument {
+		reply = h.editMemory(ctx, user, memories, strings.TrimSpace(rest))
+	} else {
+		reply = h.addMemory(ctx, user, memories, strings.TrimSpace(strings.TrimPrefix(args, memoryAddArgument+" ")))
+	}
+
+	h.newSystemReply(message, reply)
+}
+
+func (h *Handler) addMemory(ctx context.Context, user *models.User, memories []models.Memory, text string) string {
+	if len(memories) >= maxMemories {
+		return localization.GetLocalizedText(user.Lang, localization.MemoryFull, maxMemories)
+	}
+
+	if len([]rune(text)) > maxMemoryLength {
+		return localization.GetLocalizedText(user.Lang, localization.MemoryTooLong, maxMemoryLength)
+	}
+
+	if _, err := h.storage.InsertMemory(ctx, models.Memory{UserId: user.Id, Text: text}); err != nil {
+		log.Println(err)
+
+		return "Failed, try again"
+	}
+
+	return localization.GetLocalizedText(user.Lang, localization.MemoryAdded)
+}
+
+func (h *Handler) editMemory(ctx context.Context, user *models.User, memories []models.Memory, args string) string {
+	value, text, _ := strings.Cut(args, " ")
+	number, err := strconv.Atoi(value)
+	text = strings.TrimSpace(text)
+
+	if err != nil || text == "" {
+		return localization.GetLocalizedText(user.Lang, localization.MemoryUsage)
+	}
+
+	if number < 1 || number > len(memories) {
+		return localization.GetLocalizedText(user.Lang, localization.MemoryNotFound, number)
+	}
+
+	if len([]rune(text)) > maxMemoryLength {
+		return localization.GetLocalizedText(user.Lang, localization.MemoryTooLong, maxMemoryLength)
+	}
+
+	memory := memories[number-1]
+	memory.Text = text
+
+	if _, err := h.storage.UpdateMemory(ctx, &memory); err != nil {
+		log.Println(err)
+
+		return "Failed, try again"
+	}
+
+	return localization.GetLocalizedText(user.Lang, localization.MemoryUpdated, number)
+}
+
+// handleMemoryButton handles "memory:delete:{id}", "memory:toggle" and "memory:clear" callbacks
+// and shows the updated list in the same message.
+func (h *Handler) handleMemoryButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	action, value, _ := strings.Cut(strings.TrimPrefix(callbackQuery.Data, MemoryDataPrefix), ":")
+
+	var err error
+
+	switch action {
+	case memoryActionDelete:
+		err = h.deleteMemory(ctx, user, value)
+	case memoryActionToggle:
+		user.MemoryDisabled = !user.MemoryDisabled
+		err = h.saveUser(ctx, user)
+	case memoryActionClear:
+		err = h.storage.DeleteUserMemories(ctx, user.Id)
+	default:
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, "Failed, try again")
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, "")
+
+	text, markup, err := h.memoryView(ctx, user)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	_, err = h.bot.Send(
+		tgbotapi.NewEditMessageTextAndMarkup(
+			callbackQuery.Message.Chat.ID,
+			callbackQuery.Message.MessageID,
+			text,
+			markup,
+		),
+	)
+
+	if err != nil && !tgbotclient.IsNotModifiedError(err) {
+		log.Println(err)
+	}
+}
+
+func (h *Handler) deleteMemory(ctx context.Context, user *models.User, id string) error {
+	memoryId, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return err
+	}
+
+	memory, err := h.storage.GetMemoryById(ctx, memoryId)
+
+	if err != nil {
+		return err
+	}
+
+	if memory.UserId != user.Id {
+		return fmt.Errorf("memory %s does not belong to user %d", id, user.Id)
+	}
+
+	return h.storage.DeleteMemory(ctx, memoryId)
+}
+
+// memoryView renders the numbered list of facts with a delete button for each of them.
+func (h *Handler) memoryView(
+	ctx context.Context,
+	user *models.User,
+) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	memories, err := h.storage.ListUserMemories(ctx, user.Id)
+
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	title := localization.MemoryOn
+	toggle := "🔕 Turn memory off"
+
+	if user.MemoryDisabled {
+		title = localization.MemoryOff
+		toggle = "🔔 Turn memory on"
+	}
+
+	lines := []string{localization.GetLocalizedText(user.Lang, title), ""}
+
+	if len(memories) == 0 {
+		lines = append(lines, localization.GetLocalizedText(user.Lang, localization.MemoryEmpty))
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	row := make([]tgbotapi.InlineKeyboardButton, 0, memoryDeleteButtonsPerRow)
+
+	for i, memory := range memories {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, memory.Text))
+		row = append(
+			row,
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("🗑 %d", i+1),
+				fmt.Sprintf("%s%s:%s", MemoryDataPrefix, memoryActionDelete, memory.Id.Hex()),
+			),
+		)
+
+		if len(row) == memoryDeleteButtonsPerRow {
+			rows = append(rows, row)
+			row = make([]tgbotapi.InlineKeyboardButton, 0, memoryDeleteButtonsPerRow)
+		}
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	lines = append(lines, "", localization.GetLocalizedText(user.Lang, localization.MemoryUsage))
+	controls := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(toggle, MemoryDataPrefix+memoryActionToggle),
+	)
+
+	if len(memories) > 0 {
+		controls = append(
+			controls,
+			tgbotapi.NewInlineKeyboardButtonData("🧹 Forget everything", MemoryDataPrefix+memoryActionClear),
+		)
+	}
+
+	rows = append(rows, controls)
+	text := tgbotclient.TruncateText(strings.Join(lines, "\n"), tgbotclient.MaxMessageLength)
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
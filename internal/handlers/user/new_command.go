@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"log"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -9,14 +10,25 @@ import (
 func (h *Handler) handleNewCommand(ctx context.Context, message *tgbotapi.Message) {
 	user := h.getCurrentUser()
 
+	if user.ActiveChatId != nil {
+		h.rememberChat(ctx, *user, *user.ActiveChatId)
+	}
+
 	user.ActiveChatId = nil
 
-	h.storage.UpdateUser(ctx, user)
+	if err := h.saveUser(ctx, user); err != nil {
+		log.Println(err)
+	}
 
 	msg := h.newSystemMessage(message.Chat.ID, "New context started")
 	msg.ReplyToMessageID = message.MessageID
 
 	h.bot.Send(msg)
+
+	if h.inGroup() {
+		return
+	}
+
 	h.bot.Send(
 		tgbotapi.UnpinAllChatMessagesConfig{
 			ChatID: message.Chat.ID,
@@ -0,0 +1,159 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/persona"
+	"ibuddy_bot/pkg/llm"
+)
+
+func (h *Handler) handlePersonaCommand(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+	customPrompt := strings.TrimSpace(message.CommandArguments())
+
+	if customPrompt != "" {
+		h.applyPersona(ctx, user, persona.CustomId, customPrompt)
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.PersonaCustomSet))
+
+		return
+	}
+
+	current := user.Persona
+
+	if user.ActiveChatId != nil {
+		if chat, err := h.storage.GetChatById(ctx, *user.ActiveChatId); err == nil {
+			current = chat.Persona
+		}
+	}
+
+	personas := persona.List()
+	buttons := make([][]tgbotapi.InlineKeyboardButton, 0, len(personas)+1)
+
+	for _, p := range personas {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(personaButton(p.Id, p.Name, current)))
+	}
+
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(personaButton(persona.NoneId, "🚫 No persona", current)))
+
+	msg := tgbotapi.NewMessage(
+		message.Chat.ID,
+		localization.GetLocalizedText(user.Lang, localization.PersonaChoose),
+	)
+	msg.ParseMode = tgbotapi.ModeMarkdown
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	msg.ReplyToMessageID = message.MessageID
+
+	_, err := h.bot.Send(msg)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func personaButton(id string, name string, current string) tgbotapi.InlineKeyboardButton {
+	if id == current || (id == persona.NoneId && current == "") {
+		name = fmt.Sprintf("✅ %s", name)
+	}
+
+	return tgbotapi.NewInlineKeyboardButtonData(name, PersonaDataPrefix+id)
+}
+
+func (h *Handler) handlePersonaButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	id := strings.TrimPrefix(callbackQuery.Data, PersonaDataPrefix)
+	name := "🚫 No persona"
+
+	if p, ok := persona.Get(id); ok {
+		name = p.Name
+	} else if id != persona.NoneId {
+		return
+	}
+
+	user := h.getCurrentUser()
+	h.applyPersona(ctx, user, id, "")
+
+	if _, err := h.bot.Request(tgbotapi.NewCallback(callbackQuery.ID, name)); err != nil {
+		log.Println(err)
+	}
+
+	_, err := h.bot.Send(
+		tgbotapi.NewEditMessageText(
+			callbackQuery.Message.Chat.ID,
+			callbackQuery.Message.MessageID,
+			localization.GetLocalizedText(user.Lang, localization.PersonaSelected, name),
+		),
+	)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// applyPersona sets the persona for the active chat and makes it the default for new chats.
+func (h *Handler) applyPersona(ctx context.Context, user *models.User, id string, customPrompt string) {
+	if id == persona.NoneId {
+		id = ""
+	}
+
+	user.Persona = id
+	user.SystemPrompt = customPrompt
+
+	if err := h.saveUser(ctx, user); err != nil {
+		log.Println(err)
+	}
+
+	if user.ActiveChatId == nil {
+		return
+	}
+
+	chat, err := h.storage.GetChatById(ctx, *user.ActiveChatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	chat.Persona = id
+	chat.SystemPrompt = customPrompt
+
+	if _, err := h.storage.UpdateChat(ctx, &chat); err != nil {
+		log.Println(err)
+	}
+}
+
+// personaMessages returns the chat's system prompt with variables expanded for the current request.
+func personaMessages(user *models.User, chat *models.Chat) []llm.Message {
+	prompt := persona.Resolve(chat.Persona, chat.SystemPrompt)
+
+	if prompt == "" {
+		return nil
+	}
+
+	name := user.Username
+
+	if name == "" {
+		name = "the user"
+	}
+
+	return []llm.Message{
+		{
+			Role: llm.RoleSystem,
+			Content: persona.Expand(
+				prompt,
+				persona.Variables{
+					Date:     time.Now(),
+					Timezone: user.Timezone,
+					UserName: name,
+					Language: user.Lang,
+				},
+			),
+		},
+	}
+}
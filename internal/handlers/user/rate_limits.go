@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/ratelimit"
+)
+
+// RateLimitCosts returns what handling the update takes from the sender's rate limits up front:
+// a message for every answer and the length of voice messages. Commands and buttons that only change
+// settings are free. Images are charged by the handlers once the options they ask for are known.
+func RateLimitCosts(update *tgbotapi.Update) map[string]float64 {
+	costs := make(map[string]float64)
+
+	switch {
+	case update.Message != nil:
+		message := update.Message
+
+		if message.IsCommand() {
+			break
+		}
+
+		costs[ratelimit.Messages] = 1
+
+		if message.Voice != nil {
+			costs[ratelimit.VoiceMinutes] = float64(message.Voice.Duration) / 60
+		} else if message.Audio != nil {
+			costs[ratelimit.VoiceMinutes] = float64(message.Audio.Duration) / 60
+		}
+	case update.EditedMessage != nil:
+		if !update.EditedMessage.IsCommand() {
+			costs[ratelimit.Messages] = 1
+		}
+	case update.CallbackQuery != nil:
+		if strings.HasPrefix(update.CallbackQuery.Data, RegenerateDataPrefix) {
+			costs[ratelimit.Messages] = 1
+		}
+	}
+
+	return costs
+}
+
+// charge takes the costs from the sender's rate limits, it returns the text telling the sender how long
+// to wait when they run short.
+func (h *Handler) charge(ctx context.Context, costs map[string]float64) (string, bool) {
+	ok, wait := h.request.Take(ctx, costs)
+
+	if ok {
+		return "", true
+	}
+
+	return localization.GetLocalizedText(h.request.Lang, localization.RateLimited, int(math.Ceil(wait.Seconds()))), false
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/ratelimit"
+)
+
+func TestImageCosts(t *testing.T) {
+	tests := []struct {
+		args string
+		cost float64
+	}{
+		{args: "a cat", cost: 2},
+		{args: "--n 4 a cat", cost: 4},
+		{args: "--model dall-e-3 a cat", cost: 2},
+		{args: "--model dall-e-3 --quality hd a cat", cost: 4},
+	}
+
+	for _, tt := range tests {
+		_, options, err := parseImageCommand(tt.args)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cost := imageCosts(options)[ratelimit.Images]; cost != tt.cost {
+			t.Errorf("%q costs %v images, want %v", tt.args, cost, tt.cost)
+		}
+	}
+}
+
+func TestRateLimitCosts(t *testing.T) {
+	command := &tgbotapi.Message{Text: "/image a cat", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}}
+
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		costs  map[string]float64
+	}{
+		{
+			name:   "message",
+			update: tgbotapi.Update{Message: &tgbotapi.Message{Text: "hi"}},
+			costs:  map[string]float64{ratelimit.Messages: 1},
+		},
+		{
+			name:   "voice message",
+			update: tgbotapi.Update{Message: &tgbotapi.Message{Voice: &tgbotapi.Voice{Duration: 90}}},
+			costs:  map[string]float64{ratelimit.Messages: 1, ratelimit.VoiceMinutes: 1.5},
+		},
+		{
+			name:   "image command charged by the handler",
+			update: tgbotapi.Update{Message: command},
+			costs:  map[string]float64{},
+		},
+		{
+			name:   "regenerate button",
+			update: tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: RegenerateDataPrefix + "id"}},
+			costs:  map[string]float64{ratelimit.Messages: 1},
+		},
+		{
+			name:   "settings button",
+			update: tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: SettingsDataPrefix + "model"}},
+			costs:  map[string]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			costs := RateLimitCosts(&tt.update)
+
+			if len(costs) != len(tt.costs) {
+				t.Fatalf("costs = %v, want %v", costs, tt.costs)
+			}
+
+			for name, cost := range tt.costs {
+				if costs[name] != cost {
+					t.Errorf("costs = %v, want %v", costs, tt.costs)
+				}
+			}
+		})
+	}
+}
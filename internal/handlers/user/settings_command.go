@@ -0,0 +1,378 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+const (
+	settingModel           = "model"
+	settingMaxTokens       = "max_tokens"
+	settingTemperature     = "temperature"
+	settingTopP            = "top_p"
+	settingPresencePenalty = "presence_penalty"
+	settingVoiceReplies    = "voice_replies"
+	settingVoice           = "voice"
+
+	settingDefaultValue = "default"
+	settingOnValue      = "on"
+	settingOffValue     = "off"
+)
+
+var (
+	maxTokensPresets       = []int{300, 500, 1000, 2000, 4000, 8000}
+	temperaturePresets     = []float32{0.2, 0.5, 0.7, 1, 1.3}
+	topPPresets            = []float32{0.1, 0.5, 0.9, 1}
+	presencePenaltyPresets = []float32{-1, 0.5, 1, 2}
+
+	// settingLabels are the localization keys of the names of the settings.
+	settingLabels = map[string]string{
+		settingModel:           localization.SettingsModel,
+		settingMaxTokens:       localization.SettingsMaxTokens,
+		settingTemperature:     localization.SettingsTemperature,
+		settingTopP:            localization.SettingsTopP,
+		settingPresencePenalty: localization.SettingsPresencePenalty,
+		settingVoiceReplies:    localization.SettingsVoiceReplies,
+		settingVoice:           localization.SettingsVoice,
+	}
+
+	errInvalidSetting = errors.New("invalid setting")
+)
+
+// maxTokensError rejects a max tokens value that does not fit the model.
+type maxTokensError struct {
+	model     string
+	maxTokens int
+	limit     int
+}
+
+func (e maxTokensError) Error() string {
+	return fmt.Sprintf("max tokens %d exceed the %s limit of %d", e.maxTokens, e.model, e.limit)
+}
+
+func (h *Handler) handleSettingsCommand(message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, localization.GetLocalizedText(user.Lang, localization.SettingsTitle))
+	msg.ReplyMarkup = h.settingsMenu(user)
+	msg.ReplyToMessageID = message.MessageID
+
+	_, err := h.bot.Send(msg)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// handleSettingsButton handles "settings:" (main menu), "settings:{setting}" (options)
+// and "settings:{setting}:{value}" (apply) callbacks.
+func (h *Handler) handleSettingsButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	setting, value, hasValue := strings.Cut(strings.TrimPrefix(callbackQuery.Data, SettingsDataPrefix), ":")
+
+	text := localization.GetLocalizedText(user.Lang, localization.SettingsTitle)
+	markup := h.settingsMenu(user)
+	callback := tgbotapi.NewCallback(callbackQuery.ID, "")
+
+	if hasValue {
+		err := h.applySetting(user, setting, value)
+
+		var tooHigh maxTokensError
+
+		switch {
+		case errors.As(err, &tooHigh):
+			callback = tgbotapi.NewCallbackWithAlert(
+				callbackQuery.ID,
+				localization.GetLocalizedText(
+					user.Lang,
+					localization.SettingsMaxTokensTooHigh,
+					tooHigh.maxTokens,
+					tooHigh.model,
+					tooHigh.limit,
+				),
+			)
+		case err != nil:
+			callback = tgbotapi.NewCallbackWithAlert(
+				callbackQuery.ID,
+				localization.GetLocalizedText(user.Lang, localization.SettingsInvalid),
+			)
+		}
+
+		if err != nil {
+			// Stay on the options so another value can be picked.
+			hasValue = false
+		} else {
+			if err := h.saveUser(ctx, user); err != nil {
+				log.Println(err)
+			}
+
+			callback.Text = localization.GetLocalizedText(user.Lang, localization.SettingsSaved)
+			markup = h.settingsMenu(user)
+		}
+	}
+
+	if !hasValue && setting != "" {
+		options, ok := h.settingOptions(user, setting)
+
+		if !ok {
+			return
+		}
+
+		text = localization.GetLocalizedText(user.Lang, localization.SettingsChoose, settingLabel(user, setting))
+		markup = options
+	}
+
+	if _, err := h.bot.Request(callback); err != nil {
+		log.Println(err)
+	}
+
+	_, err := h.bot.Send(
+		tgbotapi.NewEditMessageTextAndMarkup(
+			callbackQuery.Message.Chat.ID,
+			callbackQuery.Message.MessageID,
+			text,
+			markup,
+		),
+	)
+
+	if err != nil && !tgbotclient.IsNotModifiedError(err) {
+		log.Println(err)
+	}
+}
+
+func (h *Handler) settingsMenu(user *models.User) tgbotapi.InlineKeyboardMarkup {
+	provider, model := h.client.ParseModel(user.GetModel())
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		settingsRow(user, settingModel, fmt.Sprintf("%s (%s)", model, provider)),
+		settingsRow(user, settingMaxTokens, strconv.Itoa(user.GetMaxTokens())),
+		settingsRow(user, settingTemperature, formatSetting(user.Temperature)),
+		settingsRow(user, settingTopP, formatSetting(user.TopP)),
+		settingsRow(user, settingPresencePenalty, formatSetting(user.PresencePenalty)),
+		settingsRow(user, settingVoiceReplies, formatSwitch(user.VoiceReplies)),
+		settingsRow(user, settingVoice, string(user.GetVoice())),
+	)
+}
+
+func settingsRow(user *models.User, setting string, value string) []tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%s: %s", settingLabel(user, setting), value),
+			SettingsDataPrefix+setting,
+		),
+	)
+}
+
+func settingLabel(user *models.User, setting string) string {
+	return localization.GetLocalizedText(user.Lang, settingLabels[setting])
+}
+
+func (h *Handler) settingOptions(user *models.User, setting string) (tgbotapi.InlineKeyboardMarkup, bool) {
+	var (
+		values  []string
+		current string
+	)
+
+	switch setting {
+	case settingModel:
+		values = h.client.Models()
+		current = user.GetModel()
+	case settingMaxTokens:
+		for _, v := range maxTokensPresets {
+			values = append(values, strconv.Itoa(v))
+		}
+		current = strconv.Itoa(user.GetMaxTokens())
+	case settingTemperature:
+		values = floatOptions(temperaturePresets)
+		current = formatSetting(user.Temperature)
+	case settingTopP:
+		values = floatOptions(topPPresets)
+		current = formatSetting(user.TopP)
+	case settingPresencePenalty:
+		values = floatOptions(presencePenaltyPresets)
+		current = formatSetting(user.PresencePenalty)
+	case settingVoiceReplies:
+		values = []string{settingOnValue, settingOffValue}
+		current = formatSwitch(user.VoiceReplies)
+	case settingVoice:
+		for _, v := range voices {
+			values = append(values, string(v))
+		}
+		current = string(user.GetVoice())
+	default:
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(values)+1)
+
+	for _, value := range values {
+		text := value
+
+		if value == current {
+			text = fmt.Sprintf("✅ %s", value)
+		}
+
+		// Model names can be longer than the 64 bytes of callback data Telegram accepts.
+		data := value
+
+		if setting == settingModel {
+			data = modelId(value)
+		}
+
+		rows = append(
+			rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(text, fmt.Sprintf("%s%s:%s", SettingsDataPrefix, setting, data)),
+			),
+		)
+	}
+
+	rows = append(
+		rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				localization.GetLocalizedText(user.Lang, localization.SettingsBack),
+				SettingsDataPrefix,
+			),
+		),
+	)
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
+
+func (h *Handler) applySetting(user *models.User, setting string, value string) error {
+	switch setting {
+	case settingModel:
+		value = h.modelById(value)
+
+		if !h.isChatModel(value) {
+			return errInvalidSetting
+		}
+
+		if limit := h.client.MaxTokensLimit(value); user.GetMaxTokens() > limit {
+			return maxTokensError{model: value, maxTokens: user.GetMaxTokens(), limit: limit}
+		}
+
+		user.Model = &value
+	case settingMaxTokens:
+		maxTokens, err := strconv.Atoi(value)
+
+		if err != nil || maxTokens <= 0 {
+			return errInvalidSetting
+		}
+
+		if limit := h.client.MaxTokensLimit(user.GetModel()); maxTokens > limit {
+			return maxTokensError{model: user.GetModel(), maxTokens: maxTokens, limit: limit}
+		}
+
+		user.MaxTokens = maxTokens
+	case settingTemperature:
+		return parseFloatSetting(value, 0, 2, &user.Temperature)
+	case settingTopP:
+		return parseFloatSetting(value, 0, 1, &user.TopP)
+	case settingPresencePenalty:
+		return parseFloatSetting(value, -2, 2, &user.PresencePenalty)
+	case settingVoiceReplies:
+		if value != settingOnValue && value != settingOffValue {
+			return errInvalidSetting
+		}
+
+		user.VoiceReplies = value == settingOnValue
+	case settingVoice:
+		if !isVoice(value) {
+			return errInvalidSetting
+		}
+
+		user.Voice = &value
+	default:
+		return errInvalidSetting
+	}
+
+	return nil
+}
+
+func parseFloatSetting(value string, min float32, max float32, target **float32) error {
+	if value == settingDefaultValue {
+		*target = nil
+
+		return nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 32)
+
+	if err != nil || float32(parsed) < min || float32(parsed) > max {
+		return errInvalidSetting
+	}
+
+	v := float32(parsed)
+	*target = &v
+
+	return nil
+}
+
+// isChatModel tells whether the model is one of the models of the configured providers.
+func (h *Handler) isChatModel(model string) bool {
+	for _, m := range h.client.Models() {
+		if m == model {
+			return true
+		}
+	}
+
+	return false
+}
+
+// modelId returns a short ID of the model that fits into callback data.
+func modelId(model string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(model))
+
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// modelById returns the model with the ID, other values are returned as they are, so buttons sent with
+// the model names still work.
+func (h *Handler) modelById(id string) string {
+	for _, model := range h.client.Models() {
+		if modelId(model) == id {
+			return model
+		}
+	}
+
+	return id
+}
+
+func floatOptions(presets []float32) []string {
+	values := []string{settingDefaultValue}
+
+	for _, v := range presets {
+		values = append(values, formatSetting(&v))
+	}
+
+	return values
+}
+
+func formatSetting(v *float32) string {
+	if v == nil {
+		return settingDefaultValue
+	}
+
+	return strconv.FormatFloat(float64(*v), 'f', -1, 32)
+}
+
+func formatSwitch(on bool) string {
+	if on {
+		return settingOnValue
+	}
+
+	return settingOffValue
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+)
+
+func TestSettingOptionsCallbackData(t *testing.T) {
+	longModel := "meta-llama/Meta-Llama-3.1-405B-Instruct-Turbo-with-a-very-long-deployment-name"
+	router := llm.NewRouter(
+		map[string]llm.LLM{llm.ProviderOpenAI: &llm.Fake{}, "gateway": &llm.Fake{}},
+		[]llm.ModelRoute{{Model: longModel, Provider: "gateway"}},
+	)
+	handler := NewHandler(nil, router, nil, "", nil)
+	user := &models.User{Lang: "ru"}
+
+	for setting := range settingLabels {
+		markup, ok := handler.settingOptions(user, setting)
+
+		if !ok {
+			t.Fatalf("no options for %s", setting)
+		}
+
+		for _, row := range markup.InlineKeyboard {
+			for _, button := range row {
+				if len(*button.CallbackData) > 64 {
+					t.Errorf("callback data %q is longer than 64 bytes", *button.CallbackData)
+				}
+			}
+		}
+
+		if back := markup.InlineKeyboard[len(markup.InlineKeyboard)-1][0]; back.Text != "« Назад" {
+			t.Errorf("back button %q is not localized", back.Text)
+		}
+	}
+
+	for _, row := range handler.settingsMenu(user).InlineKeyboard {
+		if strings.HasPrefix(row[0].Text, "settings") {
+			t.Errorf("menu button %q is not localized", row[0].Text)
+		}
+	}
+
+	if err := handler.applySetting(user, settingModel, modelId(longModel)); err != nil || user.GetModel() != longModel {
+		t.Errorf("applying the model ID set %s: %v", user.GetModel(), err)
+	}
+
+	if err := handler.applySetting(user, settingModel, "unknown"); err == nil {
+		t.Error("applied an unknown model")
+	}
+}
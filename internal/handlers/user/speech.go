@@ -0,0 +1,128 @@
+package user
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/internal/util"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+const (
+	speechModel = openai.TTSModel1
+	// maxSpeechInput is the longest text the speech API accepts in one request.
+	maxSpeechInput = 4096
+
+	// speechCharactersPerMinute estimates how much text a minute of speech holds.
+	speechCharactersPerMinute = 900
+
+	voiceTextPrefix    = "**voice text**:\n```\n%s\n```\n\n"
+	voiceTextPrefixEnd = "\n```\n\n"
+)
+
+var voices = []openai.SpeechVoice{
+	openai.VoiceAlloy,
+	openai.VoiceEcho,
+	openai.VoiceFable,
+	openai.VoiceOnyx,
+	openai.VoiceNova,
+	openai.VoiceShimmer,
+}
+
+// speak sends the text as voice messages in reply to the message. Text longer than the speech
+// API accepts is split and the parts are synthesized one after another, so they arrive in order.
+func (h *Handler) speak(ctx context.Context, message *tgbotapi.Message, user *models.User, text string) error {
+	text = tgbotclient.RenderPlainText(stripVoiceTextPrefix(text))
+
+	for _, part := range tgbotclient.SplitText(text, maxSpeechInput) {
+		h.bot.SendChatRecordVoiceAction(message.Chat.ID)
+
+		oggFilepath, err := h.synthesize(ctx, user, part)
+
+		if err != nil {
+			return err
+		}
+
+		voice := tgbotapi.NewVoice(message.Chat.ID, tgbotapi.FilePath(oggFilepath))
+		voice.ReplyToMessageID = message.MessageID
+		_, err = h.bot.Send(voice)
+		os.Remove(oggFilepath)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// synthesize speaks the text with the user's voice and returns the path of the OGG/Opus file.
+func (h *Handler) synthesize(ctx context.Context, user *models.User, text string) (string, error) {
+	speech, err := h.client.Speak(
+		ctx,
+		llm.SpeechRequest{
+			Model: string(speechModel),
+			Input: text,
+			Voice: string(user.GetVoice()),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+	defer speech.Close()
+
+	mp3File, err := os.CreateTemp(os.TempDir(), "speech*.mp3")
+
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(mp3File.Name())
+
+	_, err = io.Copy(mp3File, speech)
+	mp3File.Close()
+
+	if err != nil {
+		return "", err
+	}
+
+	return util.ConvertMp3ToOgg(mp3File.Name())
+}
+
+// speechCosts returns what speaking the text takes from the rate limits, estimated from its length.
+func speechCosts(text string) map[string]float64 {
+	text = tgbotclient.RenderPlainText(stripVoiceTextPrefix(text))
+
+	return map[string]float64{ratelimit.VoiceMinutes: float64(utf8.RuneCountInString(text)) / speechCharactersPerMinute}
+}
+
+// stripVoiceTextPrefix drops the transcription shown above answers to voice messages.
+func stripVoiceTextPrefix(text string) string {
+	if !strings.HasPrefix(text, strings.SplitN(voiceTextPrefix, "%s", 2)[0]) {
+		return text
+	}
+
+	if _, answer, ok := strings.Cut(text, voiceTextPrefixEnd); ok {
+		return answer
+	}
+
+	return text
+}
+
+func isVoice(voice string) bool {
+	for _, v := range voices {
+		if string(v) == voice {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,7 +7,13 @@ import (
 
 func (h *Handler) handleStartCommand(message *tgbotapi.Message) {
 	user := h.getCurrentUser()
-	msg := h.newSystemMessage(message.Chat.ID, localization.GetLocalizedText(user.Lang, localization.WelcomeMessage))
+	text := localization.GetLocalizedText(user.Lang, localization.WelcomeMessage)
+
+	if h.inGroup() {
+		text = localization.GetLocalizedText(user.Lang, localization.GroupHelp)
+	}
+
+	msg := h.newSystemMessage(message.Chat.ID, text)
 	msg.ReplyToMessageID = message.MessageID
 	h.bot.Send(msg)
 }
@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+)
+
+const stopCommand = "stop"
+
+// generations are the completions being streamed, by conversation. Updates of a conversation are handled
+// one at a time, so there is at most one, but /stop is handled out of turn while it runs.
+type generations struct {
+	mu      sync.Mutex
+	lastId  uint64
+	cancels map[conversation]generation
+}
+
+// conversation is a Telegram chat or a forum topic of it, threadId is 0 outside of topics.
+type conversation struct {
+	chatId   int64
+	threadId int
+}
+
+// generation is a completion being streamed, memberId is the user who asked for it.
+type generation struct {
+	id       uint64
+	memberId int64
+	cancel   context.CancelFunc
+}
+
+func newGenerations() *generations {
+	return &generations{cancels: make(map[conversation]generation)}
+}
+
+// start returns the context of a completion the member asked for in the conversation, /stop cancels it.
+// The returned func must be called when the completion is over.
+func (g *generations) start(ctx context.Context, key conversation, memberId int64) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.lastId++
+	id := g.lastId
+	g.cancels[key] = generation{id: id, memberId: memberId, cancel: cancel}
+
+	return ctx, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+
+		if g.cancels[key].id == id {
+			delete(g.cancels, key)
+		}
+
+		cancel()
+	}
+}
+
+// running returns the completion being streamed in the conversation.
+func (g *generations) running(key conversation) (generation, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	generation, ok := g.cancels[key]
+
+	return generation, ok
+}
+
+// stop cancels the completion unless it is already over.
+func (g *generations) stop(key conversation, id uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if generation, ok := g.cancels[key]; ok && generation.id == id {
+		generation.cancel()
+		delete(g.cancels, key)
+	}
+}
+
+// conversation returns the Telegram chat or forum topic the message belongs to.
+func (h *Handler) conversation(message *tgbotapi.Message) conversation {
+	return conversation{chatId: message.Chat.ID, threadId: h.threadId()}
+}
+
+// IsStopCommand tells whether the update is a /stop, which must not wait behind the completion it stops.
+func IsStopCommand(update *tgbotapi.Update) bool {
+	return update.Message != nil && update.Message.IsCommand() && update.Message.Command() == stopCommand
+}
+
+// handleStopCommand cancels the answer being streamed in the chat or forum topic, what was streamed so far
+// is kept. In groups only the member who asked for the answer or a group admin may stop it.
+func (h *Handler) handleStopCommand(message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+	key := h.conversation(message)
+	generation, ok := h.generations.running(key)
+
+	if !ok {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.StopNothing))
+
+		return
+	}
+
+	if h.inGroup() && generation.memberId != message.From.ID && !h.isGroupAdmin(message.Chat.ID, message.From.ID) {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.StopNotAllowed))
+
+		return
+	}
+
+	h.generations.stop(key, generation.id)
+}
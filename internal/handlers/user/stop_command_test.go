@@ -0,0 +1,48 @@
+package user
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerationsByConversation(t *testing.T) {
+	g := newGenerations()
+	first := conversation{chatId: -100500, threadId: 1}
+	second := conversation{chatId: -100500, threadId: 2}
+
+	firstCtx, firstDone := g.start(context.Background(), first, 1000)
+	defer firstDone()
+
+	secondCtx, secondDone := g.start(context.Background(), second, 2000)
+	defer secondDone()
+
+	generation, ok := g.running(first)
+
+	if !ok || generation.memberId != 1000 {
+		t.Fatalf("the first topic runs %+v", generation)
+	}
+
+	g.stop(first, generation.id)
+
+	if firstCtx.Err() == nil {
+		t.Error("the first topic's answer was not stopped")
+	}
+
+	if secondCtx.Err() != nil {
+		t.Error("stopping the first topic stopped the second one")
+	}
+
+	if _, ok := g.running(first); ok {
+		t.Error("the stopped answer is still running")
+	}
+
+	// A stale stop must not cancel a newer answer of the conversation.
+	thirdCtx, thirdDone := g.start(context.Background(), second, 3000)
+	defer thirdDone()
+
+	g.stop(second, generation.id)
+
+	if thirdCtx.Err() != nil {
+		t.Error("a stale stop cancelled a newer answer")
+	}
+}
@@ -0,0 +1,206 @@
+package user
+
+import (
+	"context"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/tools"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// streamEditInterval keeps message edits well below Telegram's per-chat rate limits.
+const streamEditInterval = 1500 * time.Millisecond
+
+// streamReply progressively renders a streamed answer into a chain of Telegram messages,
+// starting a new message whenever the answer outgrows the current one.
+type streamReply struct {
+	bot      *tgbotclient.TgBotClient
+	message  *tgbotapi.Message
+	prefix   string
+	replies  []tgbotapi.Message
+	shown    []string
+	resumed  int
+	editedAt time.Time
+	// calls are the tool calls made while producing the answer.
+	calls []models.ToolCall
+}
+
+// resume streams into the messages of an existing answer instead of sending new ones.
+func (s *streamReply) resume(parts []tgbotapi.Message) {
+	s.replies = parts
+	s.shown = make([]string, len(parts))
+	s.resumed = len(parts)
+}
+
+func (s *streamReply) update(content string) {
+	if time.Since(s.editedAt) < streamEditInterval {
+		return
+	}
+
+	s.editedAt = time.Now()
+
+	for i, part := range tgbotclient.SplitMarkdown(s.prefix+content, tgbotclient.MaxMessageLength) {
+		if err := s.show(i, part); err != nil {
+			log.Println(err)
+
+			return
+		}
+	}
+}
+
+// show puts the text into the i-th message of the chain, sending the message if it does not exist yet.
+// Partial answers are rendered as well, unfinished markup simply shows up as text until it is closed.
+func (s *streamReply) show(i int, text string) error {
+	if i < len(s.replies) {
+		if text == s.shown[i] {
+			return nil
+		}
+
+		_, err := s.bot.EditMessageWithFallback(
+			s.replies[i].Chat.ID,
+			s.replies[i].MessageID,
+			text,
+			tgbotclient.ModeCommonMark,
+		)
+
+		if err == nil {
+			s.shown[i] = text
+		}
+
+		return err
+	}
+
+	replyTo := s.message
+
+	if i > 0 {
+		replyTo = &s.replies[i-1]
+	}
+
+	reply, err := s.bot.NewReplyWithFallback(replyTo, text, tgbotclient.ModeCommonMark)
+
+	if err != nil {
+		return err
+	}
+
+	s.replies = append(s.replies, reply)
+	s.shown = append(s.shown, text)
+
+	return nil
+}
+
+func (s *streamReply) finalize(text string) error {
+	parts := tgbotclient.SplitMarkdown(text, tgbotclient.MaxMessageLength)
+
+	for i, part := range parts {
+		if err := s.show(i, part); err != nil {
+			return err
+		}
+	}
+
+	s.truncate(len(parts))
+
+	return nil
+}
+
+// truncate deletes the messages past the first n, e.g. when a split point moved while streaming.
+func (s *streamReply) truncate(n int) {
+	for i := n; i < len(s.replies); i++ {
+		if _, err := s.bot.DeleteMessage(&s.replies[i]); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if n < len(s.replies) {
+		s.replies = s.replies[:n]
+		s.shown = s.shown[:n]
+	}
+}
+
+func (h *Handler) newStreamReply(message *tgbotapi.Message, prefix string) *streamReply {
+	return &streamReply{
+		bot:      h.bot,
+		message:  message,
+		prefix:   prefix,
+		editedAt: time.Now(),
+	}
+}
+
+// streamModel streams every round of a tool run into the same reply.
+type streamModel struct {
+	client llm.LLM
+	stream *streamReply
+}
+
+func (m streamModel) Complete(
+	ctx context.Context,
+	request llm.ChatRequest,
+) (llm.Result, error) {
+	return m.client.Stream(ctx, request, m.stream.update)
+}
+
+// streamCompletion streams the answer into the stream's messages, running the user's tools when
+// the model supports them. When nothing was received from the model the stream is left without
+// any messages it sent itself.
+func (h *Handler) streamCompletion(
+	ctx context.Context,
+	stream *streamReply,
+	user *models.User,
+	request llm.ChatRequest,
+) (llm.Result, error) {
+	result, images, err := h.runCompletion(ctx, stream, user, request)
+
+	if result.Content == "" {
+		stream.truncate(stream.resumed)
+
+		return result, err
+	}
+
+	if finalizeErr := stream.finalize(stream.prefix + result.Content); finalizeErr != nil {
+		log.Println(finalizeErr)
+	}
+
+	h.sendToolImages(stream.message, images)
+
+	return result, err
+}
+
+func (h *Handler) runCompletion(
+	ctx context.Context,
+	stream *streamReply,
+	user *models.User,
+	request llm.ChatRequest,
+) (llm.Result, []string, error) {
+	if h.tools == nil || !h.client.SupportsTools(request.Model) {
+		result, err := h.client.Stream(ctx, request, stream.update)
+
+		return result, nil, err
+	}
+
+	run, err := tools.RunCompletion(
+		ctx,
+		streamModel{client: h.client, stream: stream},
+		h.tools,
+		tools.Env{UserId: user.Id, Timezone: user.Timezone, Charge: h.request.Take},
+		request,
+		user.IsToolEnabled,
+	)
+	stream.calls = run.Calls
+
+	return run.Result, run.Images, err
+}
+
+// sendToolImages sends the images generated by tools in reply to the prompt.
+func (h *Handler) sendToolImages(message *tgbotapi.Message, images []string) {
+	for _, image := range images {
+		photo := tgbotapi.NewPhoto(message.Chat.ID, tgbotapi.FileURL(image))
+		photo.ReplyToMessageID = message.MessageID
+
+		if _, err := h.bot.Send(photo); err != nil {
+			log.Println(err)
+		}
+	}
+}
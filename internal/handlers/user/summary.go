@@ -0,0 +1,225 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tokenizer"
+)
+
+const (
+	summaryMaxTokens = 500
+	// summaryMaxMessages bounds the thread walked back for the messages to summarize.
+	summaryMaxMessages = 1000
+	// summaryReservedTokens covers the instructions, the previous summary header and message overhead.
+	summaryReservedTokens = 200
+
+	summaryInstructions = "You maintain a rolling summary of a conversation between a user and an assistant. " +
+		"Merge the previous summary with the new messages into one concise summary. " +
+		"Keep facts, decisions, names, code identifiers and open questions; drop small talk. " +
+		"Write it in the language of the conversation and reply with the summary only."
+	summarySystemMessage = "Summary of the earlier part of this conversation:\n%s"
+)
+
+// summaryMessages returns the system messages that carry the chat's rolling summary into the context.
+func summaryMessages(chat *models.Chat) []llm.Message {
+	if chat.Summary == "" {
+		return nil
+	}
+
+	return []llm.Message{
+		{
+			Role:    llm.RoleSystem,
+			Content: fmt.Sprintf(summarySystemMessage, chat.Summary),
+		},
+	}
+}
+
+// summaryBoundary reports whether messages of the thread before the first one kept in the context may be
+// missing from the summary, and returns the message the summary has to be brought up to.
+func summaryBoundary(
+	chat *models.Chat,
+	history []models.Message,
+	first int,
+	prompt models.Message,
+) (models.Message, bool) {
+	before := prompt
+
+	if first < len(history) {
+		before = history[first]
+	}
+
+	// A full page of history may hide even older messages, so only a known summarized
+	// predecessor proves there is nothing to do.
+	if first == 0 && len(history) < maxChatHistoryMessages {
+		return before, false
+	}
+
+	if first > 0 && chat.SummarizedUntil != nil {
+		for _, msg := range history[first-1:] {
+			if msg.ObjectId == *chat.SummarizedUntil {
+				return before, false
+			}
+		}
+	}
+
+	return before, true
+}
+
+// summaryOfOtherBranch reports whether the chat's summary covers another branch of the chat than
+// the thread of the history, which is known when the history reaches the start of the thread.
+func summaryOfOtherBranch(chat *models.Chat, history []models.Message) bool {
+	if chat.SummarizedUntil == nil || len(history) >= maxChatHistoryMessages {
+		return false
+	}
+
+	for _, msg := range history {
+		if msg.ObjectId == *chat.SummarizedUntil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateSummary folds the messages of the thread that fell out of the context window, i.e. the messages
+// the given one continues that are not summarized yet, into the chat's rolling summary. A summary of
+// another branch of the chat is replaced by one of this thread.
+func (h *Handler) updateSummary(
+	ctx context.Context,
+	user *models.User,
+	chat *models.Chat,
+	before models.Message,
+) error {
+	messages, passed, err := h.threadHistoryUntil(ctx, before, summaryMaxMessages, chat.SummarizedUntil)
+
+	if err != nil {
+		return err
+	}
+
+	if passed {
+		chat.ResetSummary()
+		messages, err = h.threadHistory(ctx, before, summaryMaxMessages)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	t, err := tokenizer.ForModel(user.GetModel())
+
+	if err != nil {
+		return err
+	}
+
+	// The window is recomputed per batch because the summary itself grows.
+	for len(messages) > 0 {
+		budget := h.client.ContextWindow(user.GetModel()) - summaryMaxTokens - summaryReservedTokens -
+			t.Count(chat.Summary)
+
+		lines := make([]string, 0)
+
+		for len(messages) > 0 {
+			line := transcriptLine(messages[0])
+			tokens := t.Count(line)
+
+			if tokens > budget {
+				if len(lines) > 0 {
+					break
+				}
+
+				line = t.Truncate(line, budget)
+				tokens = budget
+			}
+
+			budget -= tokens
+			lines = append(lines, line)
+			chat.SummarizedUntil = &messages[0].ObjectId
+			messages = messages[1:]
+		}
+
+		summary, err := h.summarize(ctx, user, chat.Summary, lines)
+
+		if err != nil {
+			return err
+		}
+
+		chat.Summary = summary
+	}
+
+	_, err = h.storage.UpdateChat(ctx, chat)
+
+	return err
+}
+
+// invalidateSummary drops the chat's summary when it already covers a message that has changed.
+func (h *Handler) invalidateSummary(ctx context.Context, chatId primitive.ObjectID, changed primitive.ObjectID) {
+	chat, err := h.storage.GetChatById(ctx, chatId)
+
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if chat.SummarizedUntil == nil || bytes.Compare(changed[:], chat.SummarizedUntil[:]) > 0 {
+		return
+	}
+
+	chat.ResetSummary()
+
+	if _, err := h.storage.UpdateChat(ctx, &chat); err != nil {
+		log.Println(err)
+	}
+}
+
+func (h *Handler) summarize(
+	ctx context.Context,
+	user *models.User,
+	previous string,
+	lines []string,
+) (string, error) {
+	content := fmt.Sprintf(
+		"Previous summary:\n%s\n\nNew messages:\n%s",
+		previous,
+		strings.Join(lines, "\n"),
+	)
+
+	resp, err := h.client.Chat(
+		ctx,
+		llm.ChatRequest{
+			Model: user.GetModel(),
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: summaryInstructions},
+				{Role: llm.RoleUser, Content: content},
+			},
+			MaxTokens: summaryMaxTokens,
+			User:      strconv.FormatInt(user.Id, 10),
+		},
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(resp.Content), nil
+}
+
+func transcriptLine(msg models.Message) string {
+	if msg.Role == models.RoleUser {
+		return fmt.Sprintf("User: %s", textWithPlaceholders(msg, 0))
+	}
+
+	return fmt.Sprintf("Assistant: %s", msg.Text)
+}
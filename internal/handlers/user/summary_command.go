@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+func (h *Handler) handleSummaryCommand(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+
+	if user.ActiveChatId == nil {
+		h.newSystemReply(message, "There is no active chat")
+
+		return
+	}
+
+	chat, err := h.storage.GetChatById(ctx, *user.ActiveChatId)
+
+	if err != nil {
+		log.Println(err)
+		h.newSystemReply(message, "Failed, try again")
+
+		return
+	}
+
+	if chat.Summary == "" {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.SummaryEmpty))
+
+		return
+	}
+
+	_, err = h.newRepliesWithFallback(
+		message,
+		fmt.Sprintf("**Summary**:\n%s", chat.Summary),
+		tgbotclient.ModeCommonMark,
+	)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
+	"ibuddy_bot/pkg/llm"
+)
+
+// TestUpdateSummaryFollowsThread summarizes a branch of a chat whose other branch was written in between.
+func TestUpdateSummaryFollowsThread(t *testing.T) {
+	store := newMemStorage()
+	user := &models.User{Id: 1000, MemoryDisabled: true}
+	fake := &llm.Fake{Results: []llm.Result{{Content: "summary of b"}}}
+	handler := NewHandler(nil, llm.NewRouter(map[string]llm.LLM{llm.ProviderOpenAI: fake}, nil), store, "", nil).
+		withRequest(&request.Request{User: user})
+
+	chat := models.Chat{UserId: user.Id}
+	res, _ := store.CreateChat(context.Background(), chat)
+	chat.Id = res.InsertedID.(primitive.ObjectID)
+
+	messages := make(map[string]models.Message)
+
+	insert := func(text string, role string, parent string) {
+		message := models.Message{ChatId: chat.Id, Role: role, Text: text}
+
+		if parent != "" {
+			parentId := messages[parent].ObjectId
+			message.ParentId = &parentId
+		}
+
+		id, _ := store.InsertMessage(context.Background(), message)
+		message.ObjectId = *id
+		messages[text] = message
+	}
+
+	insert("question", models.RoleUser, "")
+	insert("answer", models.RoleAssistant, "question")
+	insert("question a", models.RoleUser, "answer")
+	insert("answer a", models.RoleAssistant, "question a")
+	insert("question b", models.RoleUser, "answer")
+	insert("answer b", models.RoleAssistant, "question b")
+
+	// The summary of branch a does not cover branch b, it is replaced.
+	summarizedUntil := messages["answer a"].ObjectId
+	chat.Summary = "summary of a"
+	chat.SummarizedUntil = &summarizedUntil
+
+	if err := handler.updateSummary(context.Background(), user, &chat, messages["answer b"]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.Requests) != 1 {
+		t.Fatalf("summarized %d times", len(fake.Requests))
+	}
+
+	content := fake.Requests[0].Messages[1].Content
+
+	for _, text := range []string{"summary of a", "question a", "answer a"} {
+		if strings.Contains(content, text) {
+			t.Errorf("the summary of branch b covers %q: %q", text, content)
+		}
+	}
+
+	for _, text := range []string{"User: question\n", "Assistant: answer\n", "User: question b"} {
+		if !strings.Contains(content, text) {
+			t.Errorf("the summary of branch b misses %q: %q", text, content)
+		}
+	}
+
+	if chat.Summary != "summary of b" || *chat.SummarizedUntil != messages["question b"].ObjectId {
+		t.Errorf("summary %q until %v", chat.Summary, chat.SummarizedUntil)
+	}
+}
+
+func TestSummaryOfOtherBranch(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	history := []models.Message{{ObjectId: ids[0]}, {ObjectId: ids[1]}}
+
+	if summaryOfOtherBranch(&models.Chat{SummarizedUntil: &ids[1]}, history) {
+		t.Error("the summary of the thread is of another branch")
+	}
+
+	if !summaryOfOtherBranch(&models.Chat{SummarizedUntil: &ids[2]}, history) {
+		t.Error("the summary of another branch is of the thread")
+	}
+
+	if summaryOfOtherBranch(&models.Chat{}, history) {
+		t.Error("no summary is of another branch")
+	}
+}
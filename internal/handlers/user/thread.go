@@ -0,0 +1,169 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/util"
+)
+
+// threadHistory returns up to limit messages the given one continues, oldest first. The thread is
+// followed through ParentId, messages stored before threads existed continue the previous message of their chat.
+func (h *Handler) threadHistory(ctx context.Context, message models.Message, limit int) ([]models.Message, error) {
+	history, _, err := h.threadHistoryUntil(ctx, message, limit, nil)
+
+	return history, err
+}
+
+// threadHistoryUntil is threadHistory stopping at the until message, which is left out, or at the first
+// message older than it. It reports whether the thread passed until without going through it, i.e.
+// until is on another branch of the chat.
+func (h *Handler) threadHistoryUntil(
+	ctx context.Context,
+	message models.Message,
+	limit int,
+	until *primitive.ObjectID,
+) ([]models.Message, bool, error) {
+	var recentLimit int64 = maxChatHistoryMessages
+	recent, err := h.storage.ListChatMessagesBefore(ctx, message.ChatId, message.ObjectId, &recentLimit)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	// recent is newest first, so the previous message of recent[i] is recent[i+1].
+	positions := map[primitive.ObjectID]int{message.ObjectId: -1}
+	loaded := make(map[primitive.ObjectID]models.Message, len(recent))
+
+	for i, msg := range recent {
+		positions[msg.ObjectId] = i
+		loaded[msg.ObjectId] = msg
+	}
+
+	previous := func(msg models.Message) (models.Message, bool, error) {
+		if msg.ParentId != nil {
+			if parent, ok := loaded[*msg.ParentId]; ok {
+				return parent, true, nil
+			}
+
+			parent, err := h.storage.GetMessageById(ctx, *msg.ParentId)
+
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return parent, false, nil
+			}
+
+			return parent, err == nil, err
+		}
+
+		if i, ok := positions[msg.ObjectId]; ok {
+			if i+1 < len(recent) {
+				return recent[i+1], true, nil
+			}
+
+			if int64(len(recent)) < recentLimit {
+				return models.Message{}, false, nil
+			}
+		}
+
+		var one int64 = 1
+		before, err := h.storage.ListChatMessagesBefore(ctx, msg.ChatId, msg.ObjectId, &one)
+
+		if err != nil || len(before) == 0 {
+			return models.Message{}, false, err
+		}
+
+		return before[0], true, nil
+	}
+
+	history := make([]models.Message, 0)
+	current := message
+	passed := false
+
+	for len(history) < limit {
+		parent, ok, err := previous(current)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !ok {
+			break
+		}
+
+		if until != nil && bytes.Compare(parent.ObjectId[:], until[:]) <= 0 {
+			passed = parent.ObjectId != *until
+
+			break
+		}
+
+		history = append(history, parent)
+		current = parent
+	}
+
+	util.ReverseSlice(history)
+
+	return history, passed, nil
+}
+
+// promptParent finds the message a new prompt continues: the answer it replies to,
+// or else the latest message of the active chat.
+func (h *Handler) promptParent(ctx context.Context, user *models.User, message *tgbotapi.Message) (*models.Message, error) {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == h.bot.Self.ID {
+		answer, err := h.findChatMessage(ctx, user, reply.MessageID)
+
+		if err == nil && answer.Role == models.RoleAssistant {
+			return &answer, nil
+		}
+
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+
+	if user.ActiveChatId == nil {
+		return nil, nil
+	}
+
+	var limit int64 = 1
+	latest, err := h.storage.ListChatMessages(ctx, *user.ActiveChatId, &limit)
+
+	if err != nil || len(latest) == 0 {
+		return nil, err
+	}
+
+	return &latest[0], nil
+}
+
+// findChatMessage finds a Telegram message, sent by either side, in the user's chats.
+func (h *Handler) findChatMessage(ctx context.Context, user *models.User, messageId int) (models.Message, error) {
+	chatIds, err := h.userChatIds(ctx, user)
+
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	return h.storage.GetMessageByTgId(ctx, chatIds, messageId)
+}
+
+// userChatIds returns the chats of the user, in a group the chats of the group or forum topic, which are
+// the conversations of the Telegram chat the update comes from.
+func (h *Handler) userChatIds(ctx context.Context, user *models.User) ([]primitive.ObjectID, error) {
+	chats, err := h.storage.ListUserChats(ctx, user.Id, h.threadId())
+
+	if err != nil {
+		return nil, err
+	}
+
+	chatIds := make([]primitive.ObjectID, len(chats))
+
+	for i, chat := range chats {
+		chatIds[i] = chat.Id
+	}
+
+	return chatIds, nil
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// handleToolsCommand lists the tools with a button turning each of them on or off.
+func (h *Handler) handleToolsCommand(message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+
+	if h.tools == nil || len(h.tools.List()) == 0 {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.ToolsUnavailable))
+
+		return
+	}
+
+	text, markup := h.toolsView(user)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = markup
+	msg.ReplyToMessageID = message.MessageID
+
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println(err)
+	}
+}
+
+// handleToolsButton handles "tools:{name}" callbacks and shows the updated list in the same message.
+func (h *Handler) handleToolsButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
+	user := h.getCurrentUser()
+	name := strings.TrimPrefix(callbackQuery.Data, ToolsDataPrefix)
+
+	if h.tools == nil {
+		h.answerCallback(callbackQuery, "")
+
+		return
+	}
+
+	if _, ok := h.tools.Get(name); !ok {
+		h.answerCallback(callbackQuery, "")
+
+		return
+	}
+
+	user.ToggleTool(name)
+
+	if err := h.saveUser(ctx, user); err != nil {
+		log.Println(err)
+		h.answerCallback(callbackQuery, "Failed, try again")
+
+		return
+	}
+
+	h.answerCallback(callbackQuery, "")
+
+	text, markup := h.toolsView(user)
+	_, err := h.bot.Send(
+		tgbotapi.NewEditMessageTextAndMarkup(
+			callbackQuery.Message.Chat.ID,
+			callbackQuery.Message.MessageID,
+			text,
+			markup,
+		),
+	)
+
+	if err != nil && !tgbotclient.IsNotModifiedError(err) {
+		log.Println(err)
+	}
+}
+
+func (h *Handler) toolsView(user *models.User) (string, tgbotapi.InlineKeyboardMarkup) {
+	lines := []string{localization.GetLocalizedText(user.Lang, localization.ToolsTitle)}
+
+	if !h.client.SupportsTools(user.GetModel()) {
+		lines = append(lines, "", localization.GetLocalizedText(user.Lang, localization.ToolsNotSupported, user.GetModel()))
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(h.tools.List()))
+
+	for _, tool := range h.tools.List() {
+		mark := "⬜"
+
+		if user.IsToolEnabled(tool.Name()) {
+			mark = "✅"
+		}
+
+		rows = append(
+			rows,
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(mark+" "+tool.Name(), ToolsDataPrefix+tool.Name()),
+			),
+		)
+	}
+
+	return strings.Join(lines, "\n"), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleTimezoneCommand shows the timezone used by the date and time tool, "/timezone <name>" changes it.
+func (h *Handler) handleTimezoneCommand(ctx context.Context, message *tgbotapi.Message) {
+	user := h.getCurrentUser()
+	name := strings.TrimSpace(message.CommandArguments())
+
+	if name == "" {
+		timezone := user.Timezone
+
+		if timezone == "" {
+			timezone = time.UTC.String()
+		}
+
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.TimezoneCurrent, timezone))
+
+		return
+	}
+
+	location, err := time.LoadLocation(name)
+
+	if err != nil {
+		h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.TimezoneUnknown, name))
+
+		return
+	}
+
+	user.Timezone = location.String()
+
+	if err := h.saveUser(ctx, user); err != nil {
+		log.Println(err)
+		h.newSystemReply(message, "Failed, try again")
+
+		return
+	}
+
+	h.newSystemReply(message, localization.GetLocalizedText(user.Lang, localization.TimezoneSet, user.Timezone))
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -13,34 +12,76 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"ibuddy_bot/internal/localization"
 	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
 	"ibuddy_bot/internal/storage"
+	"ibuddy_bot/internal/tools"
 	"ibuddy_bot/internal/util"
-	"ibuddy_bot/pkg/openaiclient"
+	"ibuddy_bot/pkg/llm"
 	"ibuddy_bot/pkg/tgbotclient"
 )
 
+const (
+	PersonaDataPrefix    = "persona:"
+	SettingsDataPrefix   = "settings:"
+	RegenerateDataPrefix = "regenerate:"
+	VariantDataPrefix    = "variant:"
+	ForkDataPrefix       = "fork:"
+	MemoryDataPrefix     = "memory:"
+	ToolsDataPrefix      = "tools:"
+	SpeakDataPrefix      = "speak:"
+	ImageDataPrefix      = "image:"
+)
+
 type Handler struct {
 	bot           *tgbotclient.TgBotClient
-	client        *openaiclient.OpenAiClient
+	client        *llm.Router
 	storage       storage.Storage
 	telegramToken string
-	currentUser   *models.User
+	visionModel   string
+	tools         *tools.Registry
+	inline        *inlineState
+	generations   *generations
+	// request is the update being handled, set on the copy of the handler serving it, see HandleUpdate.
+	request *request.Request
 }
 
 func NewHandler(
 	bot *tgbotclient.TgBotClient,
-	client *openaiclient.OpenAiClient,
+	client *llm.Router,
 	storage storage.Storage,
+	visionModel string,
+	tools *tools.Registry,
 ) *Handler {
 	return &Handler{
-		bot:     bot,
-		client:  client,
-		storage: storage,
+		bot:         bot,
+		client:      client,
+		storage:     storage,
+		visionModel: visionModel,
+		tools:       tools,
+		inline:      newInlineState(),
+		generations: newGenerations(),
 	}
 }
 
-func (h *Handler) HandleUpdate(ctx context.Context, update *tgbotapi.Update, currentUser *models.User) {
-	h.setCurrentUser(currentUser)
+// HandleUpdate handles the update with a copy of the handler holding the request. The copies share
+// everything else, so the workers can handle updates concurrently without seeing each other's requests.
+func (h *Handler) HandleUpdate(ctx context.Context, update *tgbotapi.Update, req *request.Request) {
+	h.withRequest(req).handleUpdate(ctx, update)
+}
+
+func (h *Handler) withRequest(req *request.Request) *Handler {
+	handler := *h
+	handler.request = req
+
+	return &handler
+}
+
+func (h *Handler) handleUpdate(ctx context.Context, update *tgbotapi.Update) {
+	if chat, message := updateChat(update); chat != nil && !chat.IsPrivate() {
+		if !h.enterGroup(ctx, chat, message, h.request.User) {
+			return
+		}
+	}
 
 	if update.Message != nil {
 		if update.Message.IsCommand() {
@@ -48,18 +89,21 @@ func (h *Handler) HandleUpdate(ctx context.Context, update *tgbotapi.Update, cur
 		} else {
 			h.handleMessage(ctx, update.Message)
 		}
+	} else if update.EditedMessage != nil {
+		if !update.EditedMessage.IsCommand() {
+			h.handleEditedMessage(ctx, update.EditedMessage)
+		}
 	} else if update.CallbackQuery != nil {
 		h.handleCallbackQuery(ctx, update.CallbackQuery)
+	} else if update.InlineQuery != nil {
+		h.handleInlineQuery(ctx, update.InlineQuery)
+	} else if update.ChosenInlineResult != nil {
+		h.handleChosenInlineResult(ctx, update.ChosenInlineResult)
 	} else {
 		log.Println("Unknown update!")
 	}
 }
 
-const (
-	maxChatMessages           = 20
-	maximumContextLengthError = "maximum context length"
-)
-
 func (h *Handler) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	if message.PinnedMessage != nil {
 		log.Printf("Pinned message: %s", message.PinnedMessage.Text)
@@ -72,7 +116,46 @@ func (h *Handler) handleMessage(ctx context.Context, message *tgbotapi.Message)
 	h.bot.SendChatTypingAction(message.Chat.ID)
 
 	messageText := strings.TrimSpace(message.Text)
-	if len(messageText) < 2 {
+
+	if messageText == "" {
+		messageText = strings.TrimSpace(message.Caption)
+	}
+
+	if h.inGroup() {
+		messageText = strings.TrimSpace(h.stripBotMention(messageText))
+	}
+
+	images := messageImages(message)
+	isVoiceText := false
+
+	if message.Voice != nil || message.Audio != nil {
+		voiceText := h.extractVoiceText(ctx, message)
+
+		if voiceText == "" {
+			return
+		}
+
+		isVoiceText = true
+		messageText = voiceText
+	}
+
+	document := message.Document
+
+	if len(images) > 0 {
+		document = nil
+	}
+
+	if document != nil {
+		if text := documentLimitError(user, document); text != "" {
+			if _, err := h.newSystemReply(message, text); err != nil {
+				log.Println(err)
+			}
+
+			return
+		}
+	}
+
+	if len(messageText) < 2 && len(images) == 0 && document == nil {
 		msg := h.newSystemMessage(
 			message.Chat.ID,
 			localization.GetLocalizedText(user.Lang, localization.TooShortMessage),
@@ -86,127 +169,95 @@ func (h *Handler) handleMessage(ctx context.Context, message *tgbotapi.Message)
 		return
 	}
 
-	if user.ActiveChatId == nil {
-		res, err := h.storage.CreateChat(
-			ctx,
-			models.Chat{
-				UserId:   user.Id,
-				Username: user.Username,
-				Title:    messageText,
-			},
-		)
+	parent, err := h.promptParent(ctx, user, message)
 
-		if err != nil {
-			log.Println(err)
-		} else {
-			v, _ := res.InsertedID.(primitive.ObjectID)
-			h.changeUserActiveChat(ctx, user, v)
-			_, err := h.bot.PinMessage(message.Chat.ID, message.MessageID)
-			if err != nil {
-				log.Println(err)
-			}
-		}
+	if err != nil {
+		log.Println(err)
 	}
 
-	isVoiceText := false
-	voiceText := h.extractVoiceText(ctx, message)
-
-	if voiceText != "" {
-		isVoiceText = true
-		messageText = voiceText
+	if parent != nil && (user.ActiveChatId == nil || *user.ActiveChatId != parent.ChatId) {
+		h.changeUserActiveChat(ctx, user, parent.ChatId)
 	}
 
-	var limit int64 = maxChatMessages
-	activeChatMessages, _ := h.storage.ListChatMessages(ctx, *user.ActiveChatId, &limit)
-	util.ReverseSlice(activeChatMessages)
+	if user.ActiveChatId == nil {
+		title := messageText
 
-	messages := make([]openai.ChatCompletionMessage, len(activeChatMessages))
+		if title == "" && document != nil {
+			title = document.FileName
+		}
 
-	for i, msg := range activeChatMessages {
-		messages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Text,
+		if title == "" {
+			title = imagePlaceholder
 		}
+
+		h.createActiveChat(ctx, user, message, title)
 	}
 
-	_, err = h.storage.InsertMessage(
-		ctx,
-		models.Message{
-			Id:       message.MessageID,
-			ChatId:   *user.ActiveChatId,
-			UserId:   message.From.ID,
-			Username: message.From.UserName,
-			Role:     models.RoleUser,
-			Text:     messageText,
-		},
-	)
+	chat, err := h.storage.GetChatById(ctx, *user.ActiveChatId)
 
 	if err != nil {
 		log.Println(err)
 	}
 
-	messages = append(
-		messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: messageText,
-		},
-	)
+	prompt := models.Message{
+		Id:       message.MessageID,
+		ChatId:   *user.ActiveChatId,
+		UserId:   message.From.ID,
+		Username: message.From.UserName,
+		Role:     models.RoleUser,
+		Text:     messageText,
+		Images:   images,
+	}
 
-	resp, err := h.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:     user.GetModel(),
-			Messages:  messages,
-			MaxTokens: user.GetMaxTokens(),
-			User:      strconv.FormatInt(user.Id, 10),
-		},
-	)
+	if parent != nil {
+		prompt.ParentId = &parent.ObjectId
+	}
 
-	if err != nil {
-		log.Println(err)
+	documentParts := 0
 
-		if strings.Contains(err.Error(), maximumContextLengthError) {
-			_, err = h.newSystemReply(message, fmt.Sprintf("Start new context with /new command"))
-		} else {
-			_, err = h.newSystemReply(message, "Failed, try again")
+	if document != nil {
+		parts, ok := h.ingestDocument(ctx, user, message, document, prompt.ChatId)
+
+		if !ok {
+			return
 		}
 
-		if err != nil {
+		documentParts = parts
+		prompt.Document = document.FileName
+	}
+
+	if promptId, err := h.storage.InsertMessage(ctx, prompt); err != nil {
+		log.Println(err)
+
+		prompt.ObjectId = primitive.NewObjectID()
+	} else {
+		prompt.ObjectId = *promptId
+	}
+
+	// A document without a question is only remembered until one is asked.
+	if prompt.Document != "" && messageText == "" {
+		text := localization.GetLocalizedText(user.Lang, localization.DocumentAdded, prompt.Document, documentParts)
+
+		if _, err := h.newSystemReply(message, text); err != nil {
 			log.Println(err)
 		}
 
 		return
 	}
 
-	responseText := resp.Choices[0].Message.Content
+	history, err := h.threadHistory(ctx, prompt, maxChatHistoryMessages)
 
 	if err != nil {
 		log.Println(err)
 	}
 
-	if isVoiceText {
-		responseText = fmt.Sprintf("**voice text**:\n```\n%s\n```\n\n%s", messageText, responseText)
-	}
-
-	msg, err := h.newReplyWithFallback(message, responseText, tgbotapi.ModeMarkdownV2)
+	prefix := ""
 
-	if err != nil {
-		log.Println(err)
+	if isVoiceText {
+		prefix = fmt.Sprintf(voiceTextPrefix, messageText)
 	}
 
-	_, err = h.storage.InsertMessage(
-		ctx,
-		models.Message{
-			Id:         msg.MessageID,
-			ChatId:     *user.ActiveChatId,
-			ReplyToId:  &message.MessageID,
-			UserId:     h.bot.Self.ID,
-			Username:   h.bot.Self.UserName,
-			Role:       models.RoleAssistant,
-			Text:       responseText,
-			Additional: resp,
-		},
-	)
+	h.respond(ctx, message, user, &chat, history, prompt, prefix)
 }
 
 func (h *Handler) extractVoiceText(ctx context.Context, message *tgbotapi.Message) string {
@@ -219,44 +270,71 @@ func (h *Handler) extractVoiceText(ctx context.Context, message *tgbotapi.Messag
 		return ""
 	}
 
-	fileUrl, err := h.bot.GetFileDirectURL(fileId)
-	localFile, err := util.DownloadFileByUrl(fileUrl)
-	defer os.Remove(localFile.Name())
-	mp3FilePath, err := util.ConvertOggToMp3(localFile.Name())
-	defer os.Remove(mp3FilePath)
+	mp3FilePath, err := h.downloadVoice(fileId)
 
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
+		log.Println(err)
 
 		msg := h.newSystemMessage(message.Chat.ID, "Failed, try again")
 		msg.ReplyToMessageID = message.MessageID
 		h.bot.Send(msg)
 		return ""
 	}
+	defer os.Remove(mp3FilePath)
 
-	resp, err := h.client.CreateTranscription(
+	text, err := h.client.Transcribe(
 		ctx,
-		openai.AudioRequest{
+		llm.TranscriptionRequest{
 			Model:    openai.Whisper1,
 			FilePath: mp3FilePath,
 		},
 	)
 
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
+		log.Println(err)
 
-		msg := h.newSystemMessage(message.Chat.ID, "Failed, try again")
+		msg := h.newSystemMessage(message.Chat.ID, modelErrorText(h.getCurrentUser().Lang, err))
 		msg.ReplyToMessageID = message.MessageID
 		h.bot.Send(msg)
 		return ""
 	}
 
-	return resp.Text
+	return text
+}
+
+// downloadVoice downloads the voice message and converts it to an MP3 file the caller removes.
+func (h *Handler) downloadVoice(fileId string) (string, error) {
+	fileUrl, err := h.bot.GetFileDirectURL(fileId)
+
+	if err != nil {
+		return "", err
+	}
+
+	localFile, err := util.DownloadFileByUrl(fileUrl)
+
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(localFile.Name())
+
+	mp3FilePath, err := util.ConvertOggToMp3(localFile.Name())
+
+	if err != nil {
+		os.Remove(mp3FilePath)
+
+		return "", err
+	}
+
+	return mp3FilePath, nil
 }
 
 func (h *Handler) handleCommandMessage(ctx context.Context, message *tgbotapi.Message) {
 	h.bot.SendChatTypingAction(message.Chat.ID)
 
+	if !h.checkGroupCommand(message) {
+		return
+	}
+
 	switch message.Command() {
 	case "start":
 		h.handleStartCommand(message)
@@ -268,6 +346,22 @@ func (h *Handler) handleCommandMessage(ctx context.Context, message *tgbotapi.Me
 		h.handleChatsCommand(ctx, message)
 	case "history":
 		h.handleHistoryCommand(ctx, message)
+	case "fork":
+		h.handleForkCommand(ctx, message)
+	case "memory":
+		h.handleMemoryCommand(ctx, message)
+	case "tools":
+		h.handleToolsCommand(message)
+	case "timezone":
+		h.handleTimezoneCommand(ctx, message)
+	case "summary":
+		h.handleSummaryCommand(ctx, message)
+	case "persona":
+		h.handlePersonaCommand(ctx, message)
+	case "settings":
+		h.handleSettingsCommand(message)
+	case stopCommand:
+		h.handleStopCommand(message)
 	default:
 		h.handleUnknownCommand(message)
 	}
@@ -275,11 +369,47 @@ func (h *Handler) handleCommandMessage(ctx context.Context, message *tgbotapi.Me
 
 func (h *Handler) handleCallbackQuery(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
 	switch {
+	case strings.HasPrefix(callbackQuery.Data, PersonaDataPrefix):
+		if h.checkGroupButton(callbackQuery) {
+			h.handlePersonaButton(ctx, callbackQuery)
+		}
+	case strings.HasPrefix(callbackQuery.Data, SettingsDataPrefix):
+		if h.checkGroupButton(callbackQuery) {
+			h.handleSettingsButton(ctx, callbackQuery)
+		}
+	case strings.HasPrefix(callbackQuery.Data, RegenerateDataPrefix):
+		h.handleRegenerateButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, VariantDataPrefix):
+		h.handleVariantButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, ForkDataPrefix):
+		h.handleForkButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, MemoryDataPrefix):
+		h.handleMemoryButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, ToolsDataPrefix):
+		h.handleToolsButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, SpeakDataPrefix):
+		h.handleSpeakButton(ctx, callbackQuery)
+	case strings.HasPrefix(callbackQuery.Data, ImageDataPrefix):
+		h.handleImageButton(ctx, callbackQuery)
 	case primitive.IsValidObjectID(callbackQuery.Data):
 		h.handleChatSwitchButton(ctx, callbackQuery)
 	}
 }
 
+// updateChat returns the Telegram chat of the update and the message it concerns.
+func updateChat(update *tgbotapi.Update) (*tgbotapi.Chat, *tgbotapi.Message) {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat, update.Message
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat, update.EditedMessage
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat, update.CallbackQuery.Message
+	}
+
+	return nil, nil
+}
+
 func (h *Handler) handleChatSwitchButton(ctx context.Context, callbackQuery *tgbotapi.CallbackQuery) {
 	chatId, err := primitive.ObjectIDFromHex(callbackQuery.Data)
 
@@ -291,52 +421,81 @@ func (h *Handler) handleChatSwitchButton(ctx context.Context, callbackQuery *tgb
 
 	chat, err := h.storage.GetChatById(ctx, chatId)
 
-	callback := tgbotapi.NewCallback(callbackQuery.ID, chat.Title)
+	if err != nil {
+		log.Println(err)
+	}
 
-	if _, err := h.bot.Request(callback); err != nil {
-		panic(err)
+	if err != nil || !h.isUserChat(h.getCurrentUser(), chat) {
+		h.answerCallback(callbackQuery, localization.GetLocalizedText(h.getCurrentUser().Lang, localization.ChatNotFound))
+
+		return
 	}
 
-	user := h.getCurrentUser()
-	msg, err := h.bot.Send(
-		h.newSystemMessage(callbackQuery.Message.Chat.ID, fmt.Sprintf("Active chat: %s", chat.Title)),
+	h.answerCallback(callbackQuery, chat.Title)
+
+	h.changeUserActiveChat(ctx, h.getCurrentUser(), chatId)
+	h.announceActiveChat(callbackQuery.Message.Chat.ID, chat)
+}
+
+// createActiveChat starts a new chat with the user's default persona and pins the message that started it,
+// except in groups where pins belong to the group.
+func (h *Handler) createActiveChat(ctx context.Context, user *models.User, message *tgbotapi.Message, title string) {
+	res, err := h.storage.CreateChat(
+		ctx,
+		models.Chat{
+			UserId:       user.Id,
+			ThreadId:     h.threadId(),
+			Username:     user.Username,
+			Title:        title,
+			Persona:      user.Persona,
+			SystemPrompt: user.SystemPrompt,
+		},
 	)
 
 	if err != nil {
 		log.Println(err)
+	} else {
+		v, _ := res.InsertedID.(primitive.ObjectID)
+		h.changeUserActiveChat(ctx, user, v)
 
-		return
-	}
+		if h.inGroup() {
+			return
+		}
 
-	h.changeUserActiveChat(ctx, user, chatId)
-	h.bot.PinMessage(msg.Chat.ID, msg.MessageID)
+		_, err := h.bot.PinMessage(message.Chat.ID, message.MessageID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
 }
 
 func (h *Handler) changeUserActiveChat(ctx context.Context, user *models.User, chatId primitive.ObjectID) {
+	if user.ActiveChatId != nil && *user.ActiveChatId != chatId {
+		h.rememberChat(ctx, *user, *user.ActiveChatId)
+	}
+
 	user.ActiveChatId = &chatId
-	h.storage.UpdateUser(ctx, user)
+	if err := h.saveUser(ctx, user); err != nil {
+		log.Println(err)
+	}
 }
 
 func (h *Handler) newSystemReply(message *tgbotapi.Message, s string) (tgbotapi.Message, error) {
 	return h.bot.NewSystemReply(message, s)
 }
 
-func (h *Handler) newReplyWithFallback(
+func (h *Handler) newRepliesWithFallback(
 	message *tgbotapi.Message,
 	responseText string,
 	parseMode string,
-) (tgbotapi.Message, error) {
-	return h.bot.NewReplyWithFallback(message, responseText, parseMode)
+) ([]tgbotapi.Message, error) {
+	return h.bot.NewRepliesWithFallback(message, responseText, parseMode)
 }
 
 func (h *Handler) newSystemMessage(chatId int64, text string) tgbotapi.MessageConfig {
 	return h.bot.NewSystemMessage(chatId, text)
 }
 
-func (h *Handler) setCurrentUser(user *models.User) {
-	h.currentUser = user
-}
-
 func (h *Handler) getCurrentUser() *models.User {
-	return h.currentUser
+	return h.request.User
 }
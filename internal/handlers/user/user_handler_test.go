@@ -0,0 +1,402 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
+	"ibuddy_bot/internal/storage"
+	"ibuddy_bot/pkg/llm"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// memStorage keeps users, chats and messages in memory, the methods the tests do not need
+// panic through the nil embedded interface.
+type memStorage struct {
+	storage.Storage
+
+	mu       sync.Mutex
+	users    map[int64]models.User
+	chats    map[primitive.ObjectID]models.Chat
+	messages []models.Message
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{users: make(map[int64]models.User), chats: make(map[primitive.ObjectID]models.Chat)}
+}
+
+func (s *memStorage) GetOrCreateUser(_ context.Context, userId int64, newUser *models.User) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[userId]; ok {
+		return user, nil
+	}
+
+	s.users[userId] = *newUser
+
+	return *newUser, nil
+}
+
+func (s *memStorage) UpdateUser(_ context.Context, user *models.User) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.Id] = *user
+
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
+
+func (s *memStorage) CreateChat(_ context.Context, chat models.Chat) (*mongo.InsertOneResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chat.Id = primitive.NewObjectID()
+	s.chats[chat.Id] = chat
+
+	return &mongo.InsertOneResult{InsertedID: chat.Id}, nil
+}
+
+func (s *memStorage) GetChatById(_ context.Context, chatId primitive.ObjectID) (models.Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chat, ok := s.chats[chatId]; ok {
+		return chat, nil
+	}
+
+	return models.Chat{}, mongo.ErrNoDocuments
+}
+
+func (s *memStorage) UpdateChat(_ context.Context, chat *models.Chat) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chats[chat.Id] = *chat
+
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
+
+func (s *memStorage) ListUserChats(_ context.Context, userId int64, threadId int) ([]models.Chat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chats []models.Chat
+
+	for _, chat := range s.chats {
+		if chat.UserId == userId && chat.ThreadId == threadId {
+			chats = append(chats, chat)
+		}
+	}
+
+	return chats, nil
+}
+
+func (s *memStorage) UpdateGroup(context.Context, *models.Group) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
+
+func (s *memStorage) InsertMessage(_ context.Context, message models.Message) (*primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message.ObjectId = primitive.NewObjectID()
+	s.messages = append(s.messages, message)
+
+	return &message.ObjectId, nil
+}
+
+func (s *memStorage) UpdateMessage(_ context.Context, message *models.Message) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.messages {
+		if s.messages[i].ObjectId == message.ObjectId {
+			s.messages[i] = *message
+		}
+	}
+
+	return &mongo.UpdateResult{MatchedCount: 1}, nil
+}
+
+func (s *memStorage) GetMessageById(_ context.Context, id primitive.ObjectID) (models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, message := range s.messages {
+		if message.ObjectId == id {
+			return message, nil
+		}
+	}
+
+	return models.Message{}, mongo.ErrNoDocuments
+}
+
+// ListChatMessages returns the latest messages of the chat, newest first.
+func (s *memStorage) ListChatMessages(_ context.Context, chatId primitive.ObjectID, limit *int64) ([]models.Message, error) {
+	return s.chatMessages(chatId, nil, nil, limit), nil
+}
+
+func (s *memStorage) ListChatMessagesBefore(
+	_ context.Context,
+	chatId primitive.ObjectID,
+	before primitive.ObjectID,
+	limit *int64,
+) ([]models.Message, error) {
+	return s.chatMessages(chatId, nil, &before, limit), nil
+}
+
+// ListChatMessagesBetween returns the messages of the chat between the two, oldest first.
+func (s *memStorage) ListChatMessagesBetween(
+	_ context.Context,
+	chatId primitive.ObjectID,
+	after *primitive.ObjectID,
+	before primitive.ObjectID,
+) ([]models.Message, error) {
+	messages := s.chatMessages(chatId, after, &before, nil)
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// chatMessages returns the messages of the chat between after and before, newest first.
+func (s *memStorage) chatMessages(
+	chatId primitive.ObjectID,
+	after *primitive.ObjectID,
+	before *primitive.ObjectID,
+	limit *int64,
+) []models.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []models.Message
+
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		message := s.messages[i]
+
+		if message.ChatId != chatId ||
+			(after != nil && bytes.Compare(message.ObjectId[:], after[:]) <= 0) ||
+			(before != nil && bytes.Compare(message.ObjectId[:], before[:]) >= 0) {
+			continue
+		}
+
+		if limit != nil && int64(len(messages)) == *limit {
+			break
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+func (s *memStorage) GetMessageByTgId(context.Context, []primitive.ObjectID, int) (models.Message, error) {
+	return models.Message{}, mongo.ErrNoDocuments
+}
+
+func (s *memStorage) GetUserMessage(context.Context, []primitive.ObjectID, int64, int) (models.Message, error) {
+	return models.Message{}, mongo.ErrNoDocuments
+}
+
+func (s *memStorage) ListUserMemories(context.Context, int64) ([]models.Memory, error) {
+	return nil, nil
+}
+
+func (s *memStorage) ListChatChunks(context.Context, primitive.ObjectID) ([]models.Chunk, error) {
+	return nil, nil
+}
+
+// sentMessage is a message the bot sent to the test server.
+type sentMessage struct {
+	chatId    int64
+	replyToId int
+}
+
+// newTestBot returns a bot talking to a test server that accepts every call and records the sent messages.
+func newTestBot(t *testing.T) (*tgbotclient.TgBotClient, func() []sentMessage) {
+	t.Helper()
+
+	var (
+		mu        sync.Mutex
+		sent      []sentMessage
+		messageId int64
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		if r.URL.Path == "/bottest/getMe" {
+			fmt.Fprint(w, `{"ok": true, "result": {"id": 1, "is_bot": true, "username": "ibuddy_bot"}}`)
+
+			return
+		}
+
+		chatId, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+
+		if r.URL.Path == "/bottest/sendMessage" {
+			replyToId, _ := strconv.Atoi(r.Form.Get("reply_to_message_id"))
+
+			mu.Lock()
+			sent = append(sent, sentMessage{chatId: chatId, replyToId: replyToId})
+			mu.Unlock()
+		}
+
+		fmt.Fprintf(
+			w,
+			`{"ok": true, "result": {"message_id": %d, "chat": {"id": %d, "type": "private"}}}`,
+			atomic.AddInt64(&messageId, 1),
+			chatId,
+		)
+	}))
+	t.Cleanup(srv.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("test", srv.URL+"/bot%s/%s")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tgbotclient.NewTgBotClientWithBot(bot), func() []sentMessage {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]sentMessage{}, sent...)
+	}
+}
+
+// TestHandleUpdateConcurrently runs the updates of many users at once, as the dispatcher workers do,
+// and checks that every user's turns and answers end up in that user's chat. Run it with -race.
+func TestHandleUpdateConcurrently(t *testing.T) {
+	const (
+		users    = 20
+		messages = 5
+	)
+
+	bot, sent := newTestBot(t)
+	store := newMemStorage()
+	fake := &llm.Fake{}
+
+	for i := 0; i < users*messages; i++ {
+		fake.Results = append(fake.Results, llm.Result{Content: "An answer in a few words."})
+	}
+
+	handler := NewHandler(bot, llm.NewRouter(map[string]llm.LLM{llm.ProviderOpenAI: fake}, nil), store, "gpt-4-vision-preview", nil)
+
+	var wg sync.WaitGroup
+
+	for u := 0; u < users; u++ {
+		userId := int64(1000 + u)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < messages; i++ {
+				update := &tgbotapi.Update{
+					UpdateID: int(userId)*messages + i,
+					Message: &tgbotapi.Message{
+						MessageID: int(userId)*messages + i,
+						From:      &tgbotapi.User{ID: userId, UserName: fmt.Sprintf("user%d", userId)},
+						Chat:      &tgbotapi.Chat{ID: userId, Type: "private"},
+						Text:      fmt.Sprintf("question %d of %d", i, userId),
+					},
+				}
+
+				user, err := store.GetOrCreateUser(context.Background(), userId, &models.User{Id: userId, MemoryDisabled: true})
+
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+
+				handler.HandleUpdate(context.Background(), update, request.New(update, &user))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(fake.Requests) != users*messages {
+		t.Fatalf("the model got %d requests, want %d", len(fake.Requests), users*messages)
+	}
+
+	for _, req := range fake.Requests {
+		prompt := req.Messages[len(req.Messages)-1].Content
+
+		var question, userId int
+
+		if _, err := fmt.Sscanf(prompt, "question %d of %d", &question, &userId); err != nil {
+			t.Fatalf("unexpected prompt %q", prompt)
+		}
+
+		if req.User != strconv.Itoa(userId) {
+			t.Errorf("the question of %d was asked for %s", userId, req.User)
+		}
+
+		for _, message := range req.Messages {
+			if message.Role == llm.RoleUser && !isQuestionOf(message.Content, userId) {
+				t.Errorf("the context of %d holds %q", userId, message.Content)
+			}
+		}
+	}
+
+	chats := make(map[int64]int)
+
+	for _, chat := range store.chats {
+		chats[chat.UserId]++
+	}
+
+	chatOf := make(map[primitive.ObjectID]primitive.ObjectID, len(store.messages))
+
+	for _, message := range store.messages {
+		chatOf[message.ObjectId] = message.ChatId
+	}
+
+	for _, message := range store.messages {
+		chat := store.chats[message.ChatId]
+
+		if message.Role == models.RoleUser && (chat.UserId != message.UserId || !isQuestionOf(message.Text, int(chat.UserId))) {
+			t.Errorf("%q of %d was stored in the chat of %d", message.Text, message.UserId, chat.UserId)
+		}
+
+		if message.Role == models.RoleAssistant && (message.ParentId == nil || chatOf[*message.ParentId] != message.ChatId) {
+			t.Errorf("an answer in the chat of %d does not continue a question of the chat", chat.UserId)
+		}
+	}
+
+	if len(chats) != users || len(store.messages) != users*messages*2 {
+		t.Errorf("stored %d messages in the chats of %d users, want %d in the chats of %d", len(store.messages), len(chats), users*messages*2, users)
+	}
+
+	for _, message := range sent() {
+		if message.replyToId != 0 && int64(message.replyToId/messages) != message.chatId {
+			t.Errorf("the answer to message %d was sent to %d", message.replyToId, message.chatId)
+		}
+	}
+}
+
+func isQuestionOf(content string, userId int) bool {
+	var question, owner int
+
+	_, err := fmt.Sscanf(content, "question %d of %d", &question, &owner)
+
+	return err == nil && owner == userId
+}
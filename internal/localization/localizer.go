@@ -6,7 +6,95 @@ const (
 	TextLoading     = "loading"
 	UserBanned      = "userBanned"
 	TooShortMessage = "tooShortMessage"
+	TooLongMessage  = "tooLongMessage"
 	WelcomeMessage  = "welcomeMessage"
+	SummaryEmpty    = "summaryEmpty"
+
+	PersonaChoose    = "personaChoose"
+	PersonaSelected  = "personaSelected"
+	PersonaCustomSet = "personaCustomSet"
+
+	SettingsTitle            = "settingsTitle"
+	SettingsChoose           = "settingsChoose"
+	SettingsSaved            = "settingsSaved"
+	SettingsInvalid          = "settingsInvalid"
+	SettingsMaxTokensTooHigh = "settingsMaxTokensTooHigh"
+	SettingsModel            = "settingsModel"
+	SettingsMaxTokens        = "settingsMaxTokens"
+	SettingsTemperature      = "settingsTemperature"
+	SettingsTopP             = "settingsTopP"
+	SettingsPresencePenalty  = "settingsPresencePenalty"
+	SettingsVoiceReplies     = "settingsVoiceReplies"
+	SettingsVoice            = "settingsVoice"
+	SettingsBack             = "settingsBack"
+
+	AnswerRegenerate   = "answerRegenerate"
+	AnswerListen       = "answerListen"
+	AnswerRegenerating = "answerRegenerating"
+	AnswerNotFound     = "answerNotFound"
+
+	EditForkOffer  = "editForkOffer"
+	EditForkButton = "editForkButton"
+	ForkNotFound   = "forkNotFound"
+	ChatNotFound   = "chatNotFound"
+
+	VisionModelUsed = "visionModelUsed"
+
+	DocumentTooLarge     = "documentTooLarge"
+	DocumentTooManyPages = "documentTooManyPages"
+	DocumentTooLong      = "documentTooLong"
+	DocumentUnsupported  = "documentUnsupported"
+	DocumentEmpty        = "documentEmpty"
+	DocumentAdded        = "documentAdded"
+
+	MemoryOn       = "memoryOn"
+	MemoryOff      = "memoryOff"
+	MemoryEmpty    = "memoryEmpty"
+	MemoryUsage    = "memoryUsage"
+	MemoryAdded    = "memoryAdded"
+	MemoryUpdated  = "memoryUpdated"
+	MemoryNotFound = "memoryNotFound"
+	MemoryFull     = "memoryFull"
+	MemoryTooLong  = "memoryTooLong"
+
+	ToolsTitle        = "toolsTitle"
+	ToolsUnavailable  = "toolsUnavailable"
+	ToolsNotSupported = "toolsNotSupported"
+	TimezoneCurrent   = "timezoneCurrent"
+	TimezoneSet       = "timezoneSet"
+	TimezoneUnknown   = "timezoneUnknown"
+
+	ImageUsage         = "imageUsage"
+	ImageOptionInvalid = "imageOptionInvalid"
+	ImageOptions       = "imageOptions"
+	ImageResults       = "imageResults"
+	ImageEditUsage     = "imageEditUsage"
+	ImageBaseSet       = "imageBaseSet"
+
+	GroupHelp        = "groupHelp"
+	GroupAdminOnly   = "groupAdminOnly"
+	GroupPrivateOnly = "groupPrivateOnly"
+
+	InlineAnswer      = "inlineAnswer"
+	InlineShortAnswer = "inlineShortAnswer"
+	InlineTranslation = "inlineTranslation"
+	InlineRateLimited = "inlineRateLimited"
+	InlineChatTitle   = "inlineChatTitle"
+
+	ModelFailed           = "modelFailed"
+	ModelRateLimited      = "modelRateLimited"
+	ModelRateLimitedRetry = "modelRateLimitedRetry"
+	ModelServerError      = "modelServerError"
+	ModelTimeout          = "modelTimeout"
+	ModelContextLength    = "modelContextLength"
+	ModelContentPolicy    = "modelContentPolicy"
+	ModelUnavailableRetry = "modelUnavailableRetry"
+
+	StopNothing    = "stopNothing"
+	StopNotAllowed = "stopNotAllowed"
+	StopDone       = "stopDone"
+
+	RateLimited = "rateLimited"
 )
 
 var (
@@ -15,13 +103,189 @@ var (
 			TextLoading:     "Loading...",
 			UserBanned:      "You're banned: %s",
 			TooShortMessage: "Too short message",
-			WelcomeMessage:  "Welcome!\nSend message to start conversation\nSend `/new` to clear current thread\nSend `/image {description}` to generate images",
+			TooLongMessage:  "Message is too long for the selected model",
+			WelcomeMessage:  "Welcome!\nSend message to start conversation\nSend `/new` to clear current thread\nSend `/image {description}` to generate images, options like `--size 1024x1024 --model dall-e-3` go before the description\nReply to a photo with `/image edit {description}` or `/image variation` to change it\nSend `/summary` to see what is remembered from earlier messages\nSend `/persona` to choose how the assistant behaves\nSend `/settings` to change the model and its parameters, or to get answers as voice messages\nReply to an earlier answer to continue from it, or send `/fork` to copy the chat into a new branch\nSend a photo, with a question in the caption, to ask about it\nSend a text, Markdown, source code or PDF document to ask questions about it\nSend `/memory` to see and edit what is remembered about you\nSend `/tools` to choose the tools the assistant can use and `/timezone` to set your timezone\nAdd the bot to a group to talk to it there, it answers when mentioned, replied to or given a command\nSend `/stop` to stop an answer while it is being written",
+			SummaryEmpty:    "Nothing is summarized yet, the whole conversation still fits into the context",
+
+			PersonaChoose:    "Choose a persona for this chat, it also becomes the default for new chats.\nSend `/persona {prompt}` to write your own system prompt, {date}, {time}, {name} and {language} are replaced automatically.",
+			PersonaSelected:  "Persona: %s",
+			PersonaCustomSet: "Custom system prompt saved",
+
+			SettingsTitle:            "Settings",
+			SettingsChoose:           "%s: choose a value",
+			SettingsSaved:            "Saved",
+			SettingsInvalid:          "This value is not supported",
+			SettingsMaxTokensTooHigh: "Max tokens %d exceed the %s limit of %d, lower max tokens first",
+			SettingsModel:            "Model",
+			SettingsMaxTokens:        "Max tokens",
+			SettingsTemperature:      "Temperature",
+			SettingsTopP:             "Top P",
+			SettingsPresencePenalty:  "Presence penalty",
+			SettingsVoiceReplies:     "Voice replies",
+			SettingsVoice:            "Voice",
+			SettingsBack:             "« Back",
+
+			AnswerRegenerate:   "🔄 Regenerate",
+			AnswerListen:       "🔊 Listen",
+			AnswerRegenerating: "Generating another answer...",
+			AnswerNotFound:     "This answer is no longer available",
+
+			EditForkOffer:  "Only the latest message of the active chat can be answered again. Fork the conversation from the edited message?",
+			EditForkButton: "🔀 Fork from here",
+			ForkNotFound:   "This message is not part of your chats",
+			ChatNotFound:   "This chat is not available here",
+
+			VisionModelUsed: "%s can't see images, answering with %s",
+
+			DocumentTooLarge:     "The document is too large, the limit is %d MB",
+			DocumentTooManyPages: "The document has %d pages, the limit is %d",
+			DocumentTooLong:      "The document is too long, the limit is %d characters of text",
+			DocumentUnsupported:  "Only plain text, Markdown, source code and PDF documents are supported",
+			DocumentEmpty:        "No text found in the document",
+			DocumentAdded:        "Added %s (%d parts), ask questions about it",
+
+			MemoryOn:       "🧠 Memory is on. Facts remembered from your conversations are used in every chat.",
+			MemoryOff:      "🧠 Memory is off. Nothing new is remembered and remembered facts are not used.",
+			MemoryEmpty:    "Nothing is remembered yet.",
+			MemoryUsage:    "Send /memory <fact> to add a fact, /memory edit <number> <fact> to change one.",
+			MemoryAdded:    "Remembered",
+			MemoryUpdated:  "Fact %d updated",
+			MemoryNotFound: "There is no fact number %d",
+			MemoryFull:     "Memory is full (%d facts), delete some facts first",
+			MemoryTooLong:  "A fact can be at most %d characters long",
+
+			ToolsTitle:        "🧰 Tools the assistant can use while answering, tap a tool to turn it on or off",
+			ToolsUnavailable:  "No tools are available",
+			ToolsNotSupported: "%s can't use tools, choose another model in /settings",
+			TimezoneCurrent:   "Your timezone is %s. Send `/timezone {name}`, e.g. `/timezone Europe/Berlin`, to change it",
+			TimezoneSet:       "Timezone set to %s",
+			TimezoneUnknown:   "Unknown timezone %s, use a name like Europe/Berlin",
+
+			ImageUsage:         "Send `/image {description}` to generate images. Options go before the description: `--model dall-e-2|dall-e-3`, `--size 1024x1024`, `--n 2`, `--quality standard|hd`, `--style vivid|natural`",
+			ImageOptionInvalid: "%s %s is not supported by %s",
+			ImageOptions:       "%s\nTap an option to generate again with it",
+			ImageResults:       "Tap to get more variations of an image or to make it the base for `/image edit`",
+			ImageEditUsage:     "Reply to a photo with `/image edit {description}` to change it or with `/image variation` to get similar images. Without a reply the image chosen with \"Use as base\" is used",
+			ImageBaseSet:       "This image is now the base for /image edit and /image variation",
+
+			GroupHelp:        "Hi! In groups I answer when I'm mentioned with @, when you reply to my message or send me a command.\nEach group, and each topic of a forum, has its own conversation: send `/new` to start over, `/chats` to switch chats and `/fork` to branch one.\nOnly group admins can change the `/persona` and `/settings` of the group.\nWith privacy mode on (the default, see /setprivacy in @BotFather) I only receive the messages addressed to me, so other messages of the group are not part of the conversation. Personal `/memory` is only available in a private chat with me",
+			GroupAdminOnly:   "Only group admins can change this",
+			GroupPrivateOnly: "This command is only available in a private chat with the bot",
+
+			InlineAnswer:      "Answer",
+			InlineShortAnswer: "Short answer",
+			InlineTranslation: "Translation",
+			InlineRateLimited: "Too many requests, wait a moment",
+			InlineChatTitle:   "Inline answers",
+
+			ModelFailed:           "Failed, try again",
+			ModelRateLimited:      "Too many requests to the model, try again a bit later",
+			ModelRateLimitedRetry: "Too many requests to the model, try again in %d seconds",
+			ModelServerError:      "The model provider is having problems, try again a bit later",
+			ModelTimeout:          "The model took too long to answer, try again",
+			ModelContextLength:    "The conversation no longer fits the model, start a new one with /new",
+			ModelContentPolicy:    "The provider's content policy rejected the request, try rephrasing it",
+			ModelUnavailableRetry: "The model provider is unavailable, try again in %d seconds",
+
+			StopNothing:    "There is no answer being written",
+			StopNotAllowed: "Only the member who asked or a group admin can stop this answer",
+			StopDone:       "Stopped",
+
+			RateLimited: "Slow down, retry in %d seconds",
 		},
 		"ru": {
 			TextLoading:     "Идет загрузка...",
 			UserBanned:      "Вы были забанены: %s",
 			TooShortMessage: "Слишком короткое сообщение",
+			TooLongMessage:  "Сообщение слишком длинное для выбранной модели",
 			WelcomeMessage:  "Добро пожаловать! ",
+			SummaryEmpty:    "Пока нечего резюмировать, весь разговор помещается в контекст",
+
+			PersonaChoose:    "Выберите персону для этого чата, она также станет персоной по умолчанию для новых чатов.\nОтправьте `/persona {промпт}`, чтобы задать свой системный промпт, {date}, {time}, {name} и {language} подставляются автоматически.",
+			PersonaSelected:  "Персона: %s",
+			PersonaCustomSet: "Системный промпт сохранен",
+
+			SettingsTitle:            "Настройки",
+			SettingsChoose:           "%s: выберите значение",
+			SettingsSaved:            "Сохранено",
+			SettingsInvalid:          "Это значение не поддерживается",
+			SettingsMaxTokensTooHigh: "Max tokens %d превышает лимит %s в %d токенов, сначала уменьшите max tokens",
+			SettingsModel:            "Модель",
+			SettingsMaxTokens:        "Макс. токенов",
+			SettingsTemperature:      "Температура",
+			SettingsTopP:             "Top P",
+			SettingsPresencePenalty:  "Штраф за повторы",
+			SettingsVoiceReplies:     "Голосовые ответы",
+			SettingsVoice:            "Голос",
+			SettingsBack:             "« Назад",
+
+			AnswerRegenerate:   "🔄 Другой ответ",
+			AnswerListen:       "🔊 Прослушать",
+			AnswerRegenerating: "Генерирую другой ответ...",
+			AnswerNotFound:     "Этот ответ больше недоступен",
+
+			EditForkOffer:  "Заново ответить можно только на последнее сообщение активного чата. Создать ответвление беседы от отредактированного сообщения?",
+			EditForkButton: "🔀 Ответвить отсюда",
+			ForkNotFound:   "Это сообщение не относится к вашим чатам",
+			ChatNotFound:   "Этот чат здесь недоступен",
+
+			VisionModelUsed: "%s не видит изображения, отвечает %s",
+
+			DocumentTooLarge:     "Документ слишком большой, максимум %d МБ",
+			DocumentTooManyPages: "В документе %d страниц, максимум %d",
+			DocumentTooLong:      "Документ слишком длинный, максимум %d символов текста",
+			DocumentUnsupported:  "Поддерживаются только текстовые, Markdown, PDF документы и исходный код",
+			DocumentEmpty:        "В документе не найден текст",
+			DocumentAdded:        "Добавлен %s (частей: %d), задавайте вопросы по нему",
+
+			MemoryOn:       "🧠 Память включена. Факты из ваших разговоров используются во всех чатах.",
+			MemoryOff:      "🧠 Память выключена. Новое не запоминается, запомненные факты не используются.",
+			MemoryEmpty:    "Пока ничего не запомнено.",
+			MemoryUsage:    "Отправьте /memory <факт>, чтобы добавить факт, /memory edit <номер> <факт>, чтобы изменить его.",
+			MemoryAdded:    "Запомнено",
+			MemoryUpdated:  "Факт %d изменён",
+			MemoryNotFound: "Факта с номером %d нет",
+			MemoryFull:     "Память заполнена (%d фактов), сначала удалите лишние",
+			MemoryTooLong:  "Факт может быть не длиннее %d символов",
+
+			ToolsTitle:        "🧰 Инструменты, которые ассистент может использовать при ответе, нажмите на инструмент, чтобы включить или выключить его",
+			ToolsUnavailable:  "Нет доступных инструментов",
+			ToolsNotSupported: "%s не умеет использовать инструменты, выберите другую модель в /settings",
+			TimezoneCurrent:   "Ваш часовой пояс: %s. Отправьте `/timezone {название}`, например `/timezone Europe/Moscow`, чтобы изменить его",
+			TimezoneSet:       "Часовой пояс: %s",
+			TimezoneUnknown:   "Неизвестный часовой пояс %s, используйте название вроде Europe/Moscow",
+
+			ImageUsage:         "Отправьте `/image {описание}`, чтобы сгенерировать изображения. Параметры указываются перед описанием: `--model dall-e-2|dall-e-3`, `--size 1024x1024`, `--n 2`, `--quality standard|hd`, `--style vivid|natural`",
+			ImageOptionInvalid: "%s %s не поддерживается в %s",
+			ImageOptions:       "%s\nНажмите на параметр, чтобы сгенерировать заново с ним",
+			ImageResults:       "Нажмите, чтобы получить похожие варианты изображения или сделать его основой для `/image edit`",
+			ImageEditUsage:     "Ответьте на фото командой `/image edit {описание}`, чтобы изменить его, или `/image variation`, чтобы получить похожие изображения. Без ответа используется изображение, выбранное кнопкой \"Use as base\"",
+			ImageBaseSet:       "Это изображение теперь основа для /image edit и /image variation",
+
+			GroupHelp:        "Привет! В группах я отвечаю, когда меня упоминают через @, отвечают на мое сообщение или отправляют мне команду.\nУ каждой группы и каждой темы форума своя беседа: `/new` начинает заново, `/chats` переключает чаты, `/fork` создает ответвление.\nМенять `/persona` и `/settings` группы могут только администраторы.\nКогда режим приватности включен (по умолчанию, см. /setprivacy в @BotFather), я получаю только адресованные мне сообщения, поэтому остальные сообщения группы не попадают в беседу. Личная память `/memory` доступна только в личном чате со мной",
+			GroupAdminOnly:   "Это могут менять только администраторы группы",
+			GroupPrivateOnly: "Эта команда доступна только в личном чате с ботом",
+
+			InlineAnswer:      "Ответ",
+			InlineShortAnswer: "Короткий ответ",
+			InlineTranslation: "Перевод",
+			InlineRateLimited: "Слишком много запросов, подождите немного",
+			InlineChatTitle:   "Ответы в других чатах",
+
+			ModelFailed:           "Не получилось, попробуйте еще раз",
+			ModelRateLimited:      "Слишком много запросов к модели, попробуйте чуть позже",
+			ModelRateLimitedRetry: "Слишком много запросов к модели, попробуйте через %d с",
+			ModelServerError:      "У провайдера модели проблемы, попробуйте чуть позже",
+			ModelTimeout:          "Модель отвечала слишком долго, попробуйте еще раз",
+			ModelContextLength:    "Беседа больше не помещается в модель, начните новую командой /new",
+			ModelContentPolicy:    "Запрос отклонен политикой контента провайдера, попробуйте переформулировать",
+			ModelUnavailableRetry: "Провайдер модели недоступен, попробуйте через %d с",
+
+			StopNothing:    "Сейчас ничего не пишется",
+			StopNotAllowed: "Остановить этот ответ может только тот, кто его запросил, или администратор группы",
+			StopDone:       "Остановлено",
+
+			RateLimited: "Не так быстро, повторите через %d с",
 		},
 	}
 )
@@ -41,5 +305,5 @@ func GetLocalizedText(lang string, textId string, args ...interface{}) string {
 		return message
 	}
 
-	return fmt.Sprintf(message, args)
+	return fmt.Sprintf(message, args...)
 }
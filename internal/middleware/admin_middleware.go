@@ -6,18 +6,18 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"ibuddy_bot/internal/handlers/admin"
 	"ibuddy_bot/internal/handlers/user"
-	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
 )
 
 func AdminMiddleware(
 	adminHandler *admin.Handler,
 	userHandler *user.Handler,
-) func(context.Context, *tgbotapi.Update, *models.User) {
-	return func(ctx context.Context, update *tgbotapi.Update, user *models.User) {
-		if user.IsAdmin() && adminHandler.IsAdminUpdate(update) {
+) func(context.Context, *tgbotapi.Update, *request.Request) {
+	return func(ctx context.Context, update *tgbotapi.Update, req *request.Request) {
+		if req.User.IsAdmin() && adminHandler.IsAdminUpdate(update) {
 			adminHandler.HandleUpdate(ctx, update)
 		} else {
-			userHandler.HandleUpdate(ctx, update, user)
+			userHandler.HandleUpdate(ctx, update, req)
 		}
 	}
 }
@@ -6,28 +6,37 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"ibuddy_bot/internal/localization"
-	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
 	"ibuddy_bot/pkg/tgbotclient"
 )
 
 func BanCheckMiddleware(
 	tgBotClient *tgbotclient.TgBotClient,
-	next func(context.Context, *tgbotapi.Update, *models.User),
-) func(context.Context, *tgbotapi.Update, *models.User) {
-	return func(ctx context.Context, update *tgbotapi.Update, user *models.User) {
+	next func(context.Context, *tgbotapi.Update, *request.Request),
+) func(context.Context, *tgbotapi.Update, *request.Request) {
+	return func(ctx context.Context, update *tgbotapi.Update, req *request.Request) {
+		user := req.User
+
 		if user.IsBanned() {
-			var chatId int64
+			// Inline queries come from other chats, there is no chat of the bot to explain the ban in.
+			if update.InlineQuery != nil || update.ChosenInlineResult != nil {
+				return
+			}
+
+			text := localization.GetLocalizedText(user.Lang, localization.UserBanned, *user.BanReason)
+
+			// Buttons of inline messages come without the message, the ban is shown on the button instead.
+			if req.Chat == nil {
+				if update.CallbackQuery != nil {
+					if _, err := tgBotClient.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, text)); err != nil {
+						log.Println(err)
+					}
+				}
 
-			if update.CallbackQuery != nil {
-				chatId = update.CallbackQuery.Message.Chat.ID
-			} else {
-				chatId = update.Message.Chat.ID
+				return
 			}
 
-			msg := tgBotClient.NewSystemMessage(
-				chatId,
-				localization.GetLocalizedText(user.Lang, localization.UserBanned, *user.BanReason),
-			)
+			msg := tgBotClient.NewSystemMessage(req.Chat.ID, text)
 
 			if update.Message != nil {
 				msg.ReplyToMessageID = update.Message.MessageID
@@ -39,7 +48,7 @@ func BanCheckMiddleware(
 				log.Println(err)
 			}
 		} else {
-			next(ctx, update, user)
+			next(ctx, update, req)
 		}
 	}
 }
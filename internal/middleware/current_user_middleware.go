@@ -6,6 +6,7 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/request"
 	"ibuddy_bot/internal/storage"
 )
 
@@ -13,24 +14,51 @@ func extractFrom(update *tgbotapi.Update) *tgbotapi.User {
 	if update.CallbackQuery != nil {
 		return update.CallbackQuery.From
 	}
-	return update.Message.From
+	if update.EditedMessage != nil {
+		return update.EditedMessage.From
+	}
+	if update.InlineQuery != nil {
+		return update.InlineQuery.From
+	}
+	if update.ChosenInlineResult != nil {
+		return update.ChosenInlineResult.From
+	}
+	if update.Message != nil {
+		return update.Message.From
+	}
+	// E.g. my_chat_member updates when the bot is added to or removed from a group.
+	return nil
 }
 
 func extractReplyToMessage(update *tgbotapi.Update) *tgbotapi.Message {
+	if update.InlineQuery != nil || update.ChosenInlineResult != nil {
+		return nil
+	}
 	if update.CallbackQuery != nil {
+		// Buttons of inline messages come without the message.
+		if update.CallbackQuery.Message == nil {
+			return nil
+		}
 		return update.CallbackQuery.Message.ReplyToMessage
 	}
+	if update.EditedMessage != nil {
+		return update.EditedMessage.ReplyToMessage
+	}
 	return update.Message.ReplyToMessage
 }
 
 func CurrentUserMiddleware(
 	storage storage.Storage,
 	adminUser string,
-	next func(context.Context, *tgbotapi.Update, *models.User),
+	next func(context.Context, *tgbotapi.Update, *request.Request),
 ) func(context.Context, *tgbotapi.Update) {
 	return func(ctx context.Context, update *tgbotapi.Update) {
 		from := extractFrom(update)
 
+		if from == nil {
+			return
+		}
+
 		userId := from.ID
 		username := from.UserName
 		lang := from.LanguageCode
@@ -58,6 +86,6 @@ func CurrentUserMiddleware(
 
 		user.Lang = lang
 		user.Admin = user.Username == adminUser
-		next(ctx, update, &user)
+		next(ctx, update, request.New(update, &user))
 	}
 }
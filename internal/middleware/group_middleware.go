@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// GroupMiddleware passes on only the group messages addressed to the bot, the bot stays silent
+// on the rest of the group conversation. Private chats and button presses are passed unchanged.
+func GroupMiddleware(
+	tgBotClient *tgbotclient.TgBotClient,
+	next func(context.Context, *tgbotapi.Update),
+) func(context.Context, *tgbotapi.Update) {
+	return func(ctx context.Context, update *tgbotapi.Update) {
+		message := update.Message
+
+		if message == nil {
+			message = update.EditedMessage
+		}
+
+		if message == nil || message.Chat == nil || message.Chat.IsPrivate() || tgBotClient.IsAddressed(message) {
+			next(ctx, update)
+		}
+	}
+}
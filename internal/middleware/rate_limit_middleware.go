@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/handlers/user"
+	"ibuddy_bot/internal/localization"
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/internal/request"
+	"ibuddy_bot/internal/storage"
+	"ibuddy_bot/pkg/tgbotclient"
+)
+
+// maxChargeAttempts is how many times the costs are taken when other updates of the sender keep
+// changing the buckets at the same time.
+const maxChargeAttempts = 3
+
+// RateLimitMiddleware takes the cost of the update from the sender's token buckets and tells the sender
+// how long to wait when they run short. The handlers charge what they only learn while handling the
+// update with request.Request.Take. The buckets are stored with the user, so restarts do not
+// refill them. Admins are not limited.
+func RateLimitMiddleware(
+	tgBotClient *tgbotclient.TgBotClient,
+	storage storage.Storage,
+	tiers ratelimit.Tiers,
+	next func(context.Context, *tgbotapi.Update, *request.Request),
+) func(context.Context, *tgbotapi.Update, *request.Request) {
+	return func(ctx context.Context, update *tgbotapi.Update, req *request.Request) {
+		if !req.User.IsAdmin() {
+			req.Charge = chargeFunc(storage, tiers, req.User)
+		}
+
+		ok, wait := req.Take(ctx, user.RateLimitCosts(update))
+
+		if ok {
+			next(ctx, update, req)
+
+			return
+		}
+
+		text := localization.GetLocalizedText(req.Lang, localization.RateLimited, int(math.Ceil(wait.Seconds())))
+
+		if update.CallbackQuery != nil {
+			if _, err := tgBotClient.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, text)); err != nil {
+				log.Println(err)
+			}
+
+			return
+		}
+
+		message := update.Message
+
+		if message == nil {
+			message = update.EditedMessage
+		}
+
+		msg := tgBotClient.NewSystemMessage(message.Chat.ID, text)
+		msg.ReplyToMessageID = message.MessageID
+
+		if _, err := tgBotClient.Send(msg); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// chargeFunc takes the costs from the buckets of the sender and stores them. It keeps the sender,
+// since the handlers swap the user of the request in groups. The buckets are stored only if no other
+// update of the sender changed them meanwhile, otherwise they are loaded again and the costs taken anew.
+func chargeFunc(
+	storage storage.Storage,
+	tiers ratelimit.Tiers,
+	sender *models.User,
+) func(context.Context, map[string]float64) (bool, time.Duration) {
+	return func(ctx context.Context, costs map[string]float64) (bool, time.Duration) {
+		for attempt := 1; ; attempt++ {
+			previous := make(map[string]models.Bucket, len(sender.RateLimits))
+
+			for name, bucket := range sender.RateLimits {
+				previous[name] = bucket
+			}
+
+			// Stored dates have millisecond precision, the buckets must compare equal once loaded.
+			ok, wait := tiers.Take(sender, costs, time.Now().Truncate(time.Millisecond))
+
+			if !ok {
+				return false, wait
+			}
+
+			buckets := make(map[string]models.Bucket, len(costs))
+
+			for name := range costs {
+				if bucket, ok := sender.RateLimits[name]; ok && bucket != previous[name] {
+					buckets[name] = bucket
+				}
+			}
+
+			if len(buckets) == 0 {
+				return true, 0
+			}
+
+			stored, err := storage.UpdateRateLimits(ctx, sender.Id, previous, buckets)
+
+			if err != nil {
+				log.Println(err)
+
+				return true, 0
+			}
+
+			if stored {
+				return true, 0
+			}
+
+			if attempt == maxChargeAttempts {
+				log.Printf("rate limits of %d keep changing, not charged", sender.Id)
+
+				return true, 0
+			}
+
+			user, err := storage.GetUserById(ctx, sender.Id)
+
+			if err != nil {
+				log.Println(err)
+
+				return true, 0
+			}
+
+			sender.RateLimits = user.RateLimits
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/internal/storage"
+)
+
+// bucketStorage stores the buckets of a single user the way the conditional update of the database does.
+type bucketStorage struct {
+	storage.Storage
+
+	user    models.User
+	updates int
+}
+
+func (s *bucketStorage) GetUserById(context.Context, int64) (models.User, error) {
+	user := s.user
+	user.RateLimits = make(map[string]models.Bucket, len(s.user.RateLimits))
+
+	for name, bucket := range s.user.RateLimits {
+		user.RateLimits[name] = bucket
+	}
+
+	return user, nil
+}
+
+func (s *bucketStorage) UpdateRateLimits(
+	_ context.Context,
+	_ int64,
+	previous map[string]models.Bucket,
+	buckets map[string]models.Bucket,
+) (bool, error) {
+	s.updates++
+
+	for name := range buckets {
+		stored, exists := s.user.RateLimits[name]
+		_, expected := previous[name]
+
+		if exists != expected || stored != previous[name] {
+			return false, nil
+		}
+	}
+
+	for name, bucket := range buckets {
+		s.user.RateLimits[name] = bucket
+	}
+
+	return true, nil
+}
+
+func TestChargeConcurrently(t *testing.T) {
+	tiers := ratelimit.Tiers{ratelimit.DefaultTier: {ratelimit.Messages: {Burst: 2, PerHour: 1}}}
+	store := &bucketStorage{user: models.User{Id: 1, RateLimits: make(map[string]models.Bucket)}}
+	costs := map[string]float64{ratelimit.Messages: 1}
+
+	// Both updates load the user before either of them is charged, as two shards do.
+	first, _ := store.GetUserById(context.Background(), 1)
+	second, _ := store.GetUserById(context.Background(), 1)
+
+	if ok, _ := chargeFunc(store, tiers, &first)(context.Background(), costs); !ok {
+		t.Fatal("the first update was limited")
+	}
+
+	if ok, _ := chargeFunc(store, tiers, &second)(context.Background(), costs); !ok {
+		t.Fatal("the second update was limited")
+	}
+
+	if tokens := store.user.RateLimits[ratelimit.Messages].Tokens; tokens > 0.01 || store.updates != 3 {
+		t.Errorf("%v tokens left after %d updates, want none after 3", tokens, store.updates)
+	}
+
+	if ok, wait := chargeFunc(store, tiers, &second)(context.Background(), costs); ok || wait < 59*time.Minute {
+		t.Errorf("a third message was allowed or has to wait %s", wait)
+	}
+}
@@ -2,9 +2,29 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Chat is a conversation of a user. A chat forked from another one points at it with ParentId,
+// and ForkedAt is the message of the parent chat the fork diverges at. MemorizedUntil is the last
+// message already looked through for facts to remember about the user. Inline marks the chat
+// that keeps the answers the user sent to other chats in inline mode. ThreadId is the forum topic
+// of a group chat the chat belongs to, 0 outside of topics.
 type Chat struct {
-	Id       primitive.ObjectID `bson:"_id,omitempty"`
-	UserId   int64              `bson:"user_id"`
-	Username string             `bson:"username"`
-	Title    string             `bson:"title"`
+	Id              primitive.ObjectID  `bson:"_id,omitempty"`
+	UserId          int64               `bson:"user_id"`
+	ThreadId        int                 `bson:"thread_id"`
+	Username        string              `bson:"username"`
+	Title           string              `bson:"title"`
+	Persona         string              `bson:"persona"`
+	SystemPrompt    string              `bson:"system_prompt"`
+	Summary         string              `bson:"summary"`
+	SummarizedUntil *primitive.ObjectID `bson:"summarized_until"`
+	ParentId        *primitive.ObjectID `bson:"parent_id"`
+	ForkedAt        *primitive.ObjectID `bson:"forked_at"`
+	MemorizedUntil  *primitive.ObjectID `bson:"memorized_until"`
+	Inline          bool                `bson:"inline,omitempty"`
+}
+
+// ResetSummary drops the rolling summary so it is rebuilt from the current history.
+func (c *Chat) ResetSummary() {
+	c.Summary = ""
+	c.SummarizedUntil = nil
 }
@@ -0,0 +1,14 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Chunk is a part of a document shared in a chat, with the embedding used to find it by a question.
+type Chunk struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty"`
+	ChatId    primitive.ObjectID `bson:"chat_id"`
+	Document  string             `bson:"document"`
+	Index     int                `bson:"index"`
+	Count     int                `bson:"count"`
+	Text      string             `bson:"text"`
+	Embedding []float32          `bson:"embedding"`
+}
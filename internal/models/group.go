@@ -0,0 +1,68 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Group keeps the conversation state and the model settings of a Telegram group, or of a single
+// topic of a forum supergroup (ThreadId is 0 outside of topics). Its members share them.
+type Group struct {
+	Id           primitive.ObjectID  `bson:"_id,omitempty"`
+	ChatId       int64               `bson:"chat_id"`
+	ThreadId     int                 `bson:"thread_id"`
+	Title        string              `bson:"title"`
+	ActiveChatId *primitive.ObjectID `bson:"active_chat_id"`
+	Model        *string             `bson:"model"`
+	MaxTokens    int                 `bson:"max_tokens"`
+	// Sampling parameters, nil means the API default.
+	Temperature     *float32 `bson:"temperature"`
+	TopP            *float32 `bson:"top_p"`
+	PresencePenalty *float32 `bson:"presence_penalty"`
+	Persona         string   `bson:"persona"`
+	SystemPrompt    string   `bson:"system_prompt"`
+}
+
+// UserInGroup returns the member as seen in the group: chats belong to the group, the group's
+// conversation state and settings replace the member's own and nothing is remembered about
+// the member from group conversations.
+func (g *Group) UserInGroup(member User) User {
+	user := member
+	user.Id = g.ChatId
+	user.Username = g.Title
+	user.ActiveChatId = g.ActiveChatId
+	user.Model = g.Model
+	user.MaxTokens = g.MaxTokens
+	user.Temperature = g.Temperature
+	user.TopP = g.TopP
+	user.PresencePenalty = g.PresencePenalty
+	user.Persona = g.Persona
+	user.SystemPrompt = g.SystemPrompt
+	user.MemoryDisabled = true
+
+	return user
+}
+
+// Split takes the group's part of a user returned by UserInGroup into the group and returns
+// the member with the rest of the changes, such as personal tools and voice settings.
+func (g *Group) Split(user User, member User) User {
+	g.ActiveChatId = user.ActiveChatId
+	g.Model = user.Model
+	g.MaxTokens = user.MaxTokens
+	g.Temperature = user.Temperature
+	g.TopP = user.TopP
+	g.PresencePenalty = user.PresencePenalty
+	g.Persona = user.Persona
+	g.SystemPrompt = user.SystemPrompt
+
+	user.Id = member.Id
+	user.Username = member.Username
+	user.ActiveChatId = member.ActiveChatId
+	user.Model = member.Model
+	user.MaxTokens = member.MaxTokens
+	user.Temperature = member.Temperature
+	user.TopP = member.TopP
+	user.PresencePenalty = member.PresencePenalty
+	user.Persona = member.Persona
+	user.SystemPrompt = member.SystemPrompt
+	user.MemoryDisabled = member.MemoryDisabled
+
+	return user
+}
@@ -0,0 +1,10 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Memory is a durable fact about a user, shared by all of their chats.
+type Memory struct {
+	Id     primitive.ObjectID `bson:"_id,omitempty"`
+	UserId int64              `bson:"user_id"`
+	Text   string             `bson:"text"`
+}
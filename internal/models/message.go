@@ -2,13 +2,64 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Message is a single turn of a chat. Id is the Telegram message id; an answer split into
+// several Telegram messages lists all of them in PartIds. ParentId links the turn to the one it
+// continues, so replying to an earlier answer branches the chat into a tree. Assistant turns keep every
+// generated answer in Variants, and Text always holds the selected one. EditedText keeps
+// the new text of an edited earlier message until the conversation is forked from it.
+// Images only keep the Telegram files, they are downloaded again whenever the turn is sent to the model.
+// Document is the name of a file shared with the turn, its text is stored as chunks of the chat.
+// ToolCalls records the tools the model called while producing an answer.
+// Answers to /image keep the options they were generated with and the generated images.
+// CopyOf is the message a fork copied, the copy shares its Telegram ids, which still mean the original.
 type Message struct {
-	Id         int                `bson:"id"`
-	ChatId     primitive.ObjectID `bson:"chat_id"`
-	ReplyToId  *int               `bson:"reply_to_id"`
-	UserId     int64              `bson:"user_id"`
-	Username   string             `bson:"username"`
-	Role       string             `bson:"role"`
-	Text       string             `bson:"text"`
-	Additional interface{}        `bson:"additional"`
+	ObjectId        primitive.ObjectID  `bson:"_id,omitempty"`
+	Id              int                 `bson:"id"`
+	PartIds         []int               `bson:"part_ids,omitempty"`
+	ChatId          primitive.ObjectID  `bson:"chat_id"`
+	ReplyToId       *int                `bson:"reply_to_id"`
+	ParentId        *primitive.ObjectID `bson:"parent_id"`
+	UserId          int64               `bson:"user_id"`
+	Username        string              `bson:"username"`
+	Role            string              `bson:"role"`
+	Text            string              `bson:"text"`
+	Images          []Image             `bson:"images,omitempty"`
+	Document        string              `bson:"document,omitempty"`
+	ToolCalls       []ToolCall          `bson:"tool_calls,omitempty"`
+	Variants        []string            `bson:"variants,omitempty"`
+	SelectedVariant int                 `bson:"selected_variant"`
+	EditedText      string              `bson:"edited_text,omitempty"`
+	ImageOptions    *ImageOptions       `bson:"image_options,omitempty"`
+	GeneratedImages []GeneratedImage    `bson:"generated_images,omitempty"`
+	Additional      interface{}         `bson:"additional"`
+	CopyOf          *primitive.ObjectID `bson:"copy_of,omitempty"`
+}
+
+type Image struct {
+	FileId   string `bson:"file_id"`
+	MimeType string `bson:"mime_type"`
+}
+
+type ToolCall struct {
+	Id        string `bson:"id"`
+	Name      string `bson:"name"`
+	Arguments string `bson:"arguments"`
+	Result    string `bson:"result"`
+	Error     string `bson:"error,omitempty"`
+}
+
+// ImageOptions are the image API parameters of a generation. Operation is empty for images
+// generated from a description, or tells whether an existing image was edited or varied.
+type ImageOptions struct {
+	Operation string `bson:"operation,omitempty"`
+	Model     string `bson:"model"`
+	Size      string `bson:"size"`
+	N         int    `bson:"n"`
+	Quality   string `bson:"quality,omitempty"`
+	Style     string `bson:"style,omitempty"`
+}
+
+type GeneratedImage struct {
+	FileId        string `bson:"file_id"`
+	RevisedPrompt string `bson:"revised_prompt,omitempty"`
 }
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/sashabaranov/go-openai"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -9,6 +11,7 @@ const (
 	RoleUser         = "user"
 	RoleAssistant    = "assistant"
 	defaultMaxTokens = 300
+	defaultVoice     = openai.VoiceAlloy
 )
 
 type User struct {
@@ -20,6 +23,34 @@ type User struct {
 	Admin        bool
 	Model        *string `bson:"model"`
 	MaxTokens    int     `bson:"max_tokens"`
+	// Sampling parameters, nil means the API default.
+	Temperature     *float32 `bson:"temperature"`
+	TopP            *float32 `bson:"top_p"`
+	PresencePenalty *float32 `bson:"presence_penalty"`
+	// Persona and SystemPrompt are the defaults inherited by new chats.
+	Persona      string `bson:"persona"`
+	SystemPrompt string `bson:"system_prompt"`
+	// MemoryDisabled stops both remembering new facts and using the remembered ones.
+	MemoryDisabled bool `bson:"memory_disabled"`
+	// DisabledTools are the names of the tools the model is not offered for this user.
+	DisabledTools []string `bson:"disabled_tools"`
+	// Timezone is an IANA timezone name, empty means UTC.
+	Timezone string `bson:"timezone"`
+	// VoiceReplies sends every answer as a voice message too, spoken with Voice.
+	VoiceReplies bool    `bson:"voice_replies"`
+	Voice        *string `bson:"voice"`
+	// BaseImage is edited by "/image edit" when the command does not reply to a photo.
+	BaseImage *Image `bson:"base_image"`
+	// Tier picks the rate limits of the user, empty is the default tier.
+	Tier string `bson:"tier"`
+	// RateLimits are the token buckets of the user by what they limit, see the ratelimit package.
+	RateLimits map[string]Bucket `bson:"rate_limits,omitempty"`
+}
+
+// Bucket is a token bucket as of UpdatedAt, it refills from then on.
+type Bucket struct {
+	Tokens    float64   `bson:"tokens"`
+	UpdatedAt time.Time `bson:"updated_at"`
 }
 
 func (u *User) IsBanned() bool {
@@ -45,3 +76,60 @@ func (u *User) GetModel() string {
 
 	return openai.GPT3Dot5Turbo
 }
+
+func (u *User) GetVoice() openai.SpeechVoice {
+	if u.Voice != nil {
+		return openai.SpeechVoice(*u.Voice)
+	}
+
+	return defaultVoice
+}
+
+func (u *User) IsToolEnabled(name string) bool {
+	for _, disabled := range u.DisabledTools {
+		if disabled == name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ToggleTool enables a disabled tool or disables an enabled one.
+func (u *User) ToggleTool(name string) {
+	if u.IsToolEnabled(name) {
+		u.DisabledTools = append(u.DisabledTools, name)
+
+		return
+	}
+
+	enabled := make([]string, 0, len(u.DisabledTools))
+
+	for _, disabled := range u.DisabledTools {
+		if disabled != name {
+			enabled = append(enabled, disabled)
+		}
+	}
+
+	u.DisabledTools = enabled
+}
+
+func (u *User) GetTemperature() float32 {
+	return valueOrZero(u.Temperature)
+}
+
+func (u *User) GetTopP() float32 {
+	return valueOrZero(u.TopP)
+}
+
+func (u *User) GetPresencePenalty() float32 {
+	return valueOrZero(u.PresencePenalty)
+}
+
+func valueOrZero(v *float32) float32 {
+	if v == nil {
+		return 0
+	}
+
+	return *v
+}
@@ -0,0 +1,105 @@
+package persona
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// CustomId marks a user-written system prompt instead of a built-in persona.
+	CustomId = "custom"
+	// NoneId disables the system prompt.
+	NoneId = "none"
+)
+
+type Persona struct {
+	Id     string
+	Name   string
+	Prompt string
+}
+
+// Variables are substituted into system prompts at request time. Date is shown in Timezone,
+// an IANA timezone name, empty or unknown names mean UTC.
+type Variables struct {
+	Date     time.Time
+	Timezone string
+	UserName string
+	Language string
+}
+
+var (
+	builtIn = []Persona{
+		{
+			Id:     "assistant",
+			Name:   "🤖 Assistant",
+			Prompt: "You are a helpful assistant talking to {name} in Telegram. Today is {date}. Answer in {language} unless asked otherwise.",
+		},
+		{
+			Id:     "programmer",
+			Name:   "👨‍💻 Programmer",
+			Prompt: "You are a senior software engineer helping {name}. Give concise answers with working code examples and explain trade-offs briefly. Today is {date}.",
+		},
+		{
+			Id:     "translator",
+			Name:   "🌍 Translator",
+			Prompt: "You are a professional translator. Translate every message into {language}; if it is already in {language}, translate it into English. Reply with the translation only.",
+		},
+		{
+			Id:     "teacher",
+			Name:   "🎓 Teacher",
+			Prompt: "You are a patient teacher. Explain topics step by step with simple examples and check {name}'s understanding with a short question at the end. Answer in {language}.",
+		},
+		{
+			Id:     "editor",
+			Name:   "✍️ Editor",
+			Prompt: "You are a copy editor. Fix grammar, spelling and style of the texts {name} sends, keep the original meaning and language, and list the most important changes.",
+		},
+	}
+)
+
+func List() []Persona {
+	return builtIn
+}
+
+func Get(id string) (Persona, bool) {
+	for _, p := range builtIn {
+		if p.Id == id {
+			return p, true
+		}
+	}
+
+	return Persona{}, false
+}
+
+// Resolve returns the raw system prompt for the persona id, using customPrompt for CustomId.
+func Resolve(id string, customPrompt string) string {
+	if id == CustomId {
+		return customPrompt
+	}
+
+	p, _ := Get(id)
+
+	return p.Prompt
+}
+
+// Expand substitutes the {date}, {time}, {name} and {language} variables.
+func Expand(prompt string, vars Variables) string {
+	language := vars.Language
+
+	if language == "" {
+		language = "the language of the user's message"
+	}
+
+	date := vars.Date.UTC()
+
+	if location, err := time.LoadLocation(vars.Timezone); err == nil {
+		date = vars.Date.In(location)
+	}
+
+	return strings.NewReplacer(
+		"{date}", date.Format("Monday, January 2, 2006"),
+		"{time}", date.Format("15:04 MST"),
+		"{name}", vars.UserName,
+		"{language}", language,
+	).Replace(prompt)
+}
@@ -0,0 +1,28 @@
+package persona
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandTimezone(t *testing.T) {
+	// Late evening in UTC is already the next day in Tokyo.
+	date := time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		timezone string
+		expanded string
+	}{
+		{timezone: "", expanded: "Friday, March 1, 2024 22:30 UTC"},
+		{timezone: "Asia/Tokyo", expanded: "Saturday, March 2, 2024 07:30 JST"},
+		{timezone: "Unknown/Zone", expanded: "Friday, March 1, 2024 22:30 UTC"},
+	}
+
+	for _, tt := range tests {
+		expanded := Expand("{date} {time}", Variables{Date: date.In(time.Local), Timezone: tt.timezone})
+
+		if expanded != tt.expanded {
+			t.Errorf("in %q got %q, want %q", tt.timezone, expanded, tt.expanded)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/models"
+)
+
+const (
+	Messages     = "messages"
+	Images       = "images"
+	VoiceMinutes = "voice_minutes"
+
+	// DefaultTier is the tier of users without one.
+	DefaultTier = "default"
+)
+
+// Limit is a token bucket holding up to Burst tokens and refilling PerHour tokens an hour.
+// A zero PerHour means no limit.
+type Limit struct {
+	Burst   float64 `json:"burst"`
+	PerHour float64 `json:"per_hour"`
+}
+
+// Limits are the limits of a tier by what they limit.
+type Limits map[string]Limit
+
+// Tiers are the limits by tier, a user's tier is models.User.Tier.
+type Tiers map[string]Limits
+
+// DefaultTiers are used when no limits file is given.
+var DefaultTiers = Tiers{
+	DefaultTier: {
+		Messages:     {Burst: 20, PerHour: 60},
+		Images:       {Burst: 5, PerHour: 10},
+		VoiceMinutes: {Burst: 10, PerHour: 30},
+	},
+	"premium": {
+		Messages:     {Burst: 60, PerHour: 300},
+		Images:       {Burst: 20, PerHour: 50},
+		VoiceMinutes: {Burst: 30, PerHour: 120},
+	},
+}
+
+// imageCosts are the images an image of the model takes from the Images limit.
+var imageCosts = map[string]float64{
+	openai.CreateImageModelDallE2: 1,
+	openai.CreateImageModelDallE3: 2,
+}
+
+// ImageCost returns what an image of the model and quality takes from the Images limit, HD images
+// cost twice as much. Images of other models cost one.
+func ImageCost(model string, quality string) float64 {
+	cost, ok := imageCosts[model]
+
+	if !ok {
+		cost = 1
+	}
+
+	if quality == openai.CreateImageQualityHD {
+		cost *= 2
+	}
+
+	return cost
+}
+
+// Load reads the tiers from a JSON file shaped like DefaultTiers, e.g.
+// {"default": {"messages": {"burst": 20, "per_hour": 60}}}. Limits missing from a tier are not enforced.
+func Load(path string) (Tiers, error) {
+	var tiers Tiers
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &tiers); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if _, ok := tiers[DefaultTier]; !ok {
+		return nil, fmt.Errorf("%s: the %s tier is missing", path, DefaultTier)
+	}
+
+	return tiers, nil
+}
+
+// limits returns the limits of the user's tier, unknown tiers get the default one.
+func (t Tiers) limits(user *models.User) Limits {
+	if limits, ok := t[user.Tier]; ok {
+		return limits
+	}
+
+	return t[DefaultTier]
+}
+
+// Take takes the costs from the user's buckets, either all of them or, when a bucket is short,
+// none and returns how long to wait until all the buckets can pay.
+// A cost above the burst is allowed from a full bucket, leaving it in debt.
+func (t Tiers) Take(user *models.User, costs map[string]float64, now time.Time) (bool, time.Duration) {
+	limits := t.limits(user)
+	buckets := make(map[string]models.Bucket, len(costs))
+
+	var wait time.Duration
+
+	for name, cost := range costs {
+		limit, ok := limits[name]
+
+		if !ok || limit.PerHour <= 0 || cost <= 0 {
+			continue
+		}
+
+		bucket := refill(user.RateLimits[name], limit, now)
+		buckets[name] = bucket
+
+		if need := math.Min(cost, limit.Burst) - bucket.Tokens; need > 0 {
+			if w := time.Duration(need / limit.PerHour * float64(time.Hour)); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait > 0 {
+		return false, wait
+	}
+
+	if len(buckets) > 0 && user.RateLimits == nil {
+		user.RateLimits = make(map[string]models.Bucket, len(buckets))
+	}
+
+	for name, bucket := range buckets {
+		bucket.Tokens -= costs[name]
+		user.RateLimits[name] = bucket
+	}
+
+	return true, 0
+}
+
+// refill adds the tokens earned since the bucket was last updated, a new bucket starts full.
+func refill(bucket models.Bucket, limit Limit, now time.Time) models.Bucket {
+	if bucket.UpdatedAt.IsZero() {
+		return models.Bucket{Tokens: limit.Burst, UpdatedAt: now}
+	}
+
+	earned := now.Sub(bucket.UpdatedAt).Hours() * limit.PerHour
+
+	return models.Bucket{Tokens: math.Min(limit.Burst, bucket.Tokens+earned), UpdatedAt: now}
+}
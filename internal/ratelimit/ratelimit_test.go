@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"ibuddy_bot/internal/models"
+)
+
+func TestRefill(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Burst: 20, PerHour: 60}
+
+	tests := []struct {
+		name   string
+		bucket models.Bucket
+		tokens float64
+	}{
+		{name: "new bucket", bucket: models.Bucket{}, tokens: 20},
+		{name: "empty bucket", bucket: models.Bucket{Tokens: 0, UpdatedAt: now}, tokens: 0},
+		{name: "partial refill", bucket: models.Bucket{Tokens: 5, UpdatedAt: now.Add(-5 * time.Minute)}, tokens: 10},
+		{name: "burst cap", bucket: models.Bucket{Tokens: 15, UpdatedAt: now.Add(-time.Hour)}, tokens: 20},
+		{name: "debt", bucket: models.Bucket{Tokens: -5, UpdatedAt: now.Add(-2 * time.Minute)}, tokens: -3},
+	}
+
+	for _, tt := range tests {
+		bucket := refill(tt.bucket, limit, now)
+
+		if math.Abs(bucket.Tokens-tt.tokens) > 1e-9 || !bucket.UpdatedAt.Equal(now) {
+			t.Errorf("%s: got %v tokens as of %v, want %v as of %v", tt.name, bucket.Tokens, bucket.UpdatedAt, tt.tokens, now)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		tier   string
+		bucket models.Bucket
+		cost   float64
+		ok     bool
+		wait   time.Duration
+		tokens float64
+	}{
+		{
+			name:   "new bucket",
+			cost:   1,
+			ok:     true,
+			tokens: 19,
+		},
+		{
+			name:   "empty bucket",
+			bucket: models.Bucket{Tokens: 0, UpdatedAt: now},
+			cost:   1,
+			wait:   time.Minute,
+		},
+		{
+			name:   "partial refill",
+			bucket: models.Bucket{Tokens: 0, UpdatedAt: now.Add(-2 * time.Minute)},
+			cost:   1,
+			ok:     true,
+			tokens: 1,
+		},
+		{
+			name:   "burst cap",
+			bucket: models.Bucket{Tokens: 19, UpdatedAt: now.Add(-time.Hour)},
+			cost:   1,
+			ok:     true,
+			tokens: 19,
+		},
+		{
+			name:   "cost above the burst",
+			bucket: models.Bucket{Tokens: 10, UpdatedAt: now},
+			cost:   25,
+			wait:   10 * time.Minute,
+		},
+		{
+			name:   "cost above the burst from a full bucket",
+			bucket: models.Bucket{Tokens: 20, UpdatedAt: now},
+			cost:   25,
+			ok:     true,
+			tokens: -5,
+		},
+		{
+			name:   "premium tier",
+			tier:   "premium",
+			bucket: models.Bucket{Tokens: 0, UpdatedAt: now.Add(-30 * time.Second)},
+			cost:   1,
+			ok:     true,
+			tokens: 1.5,
+		},
+		{
+			name:   "unknown tier falls back to the default",
+			tier:   "gold",
+			bucket: models.Bucket{Tokens: 0, UpdatedAt: now.Add(-30 * time.Second)},
+			cost:   1,
+			wait:   30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		user := &models.User{Tier: tt.tier}
+
+		if !tt.bucket.UpdatedAt.IsZero() {
+			user.RateLimits = map[string]models.Bucket{Messages: tt.bucket}
+		}
+
+		ok, wait := DefaultTiers.Take(user, map[string]float64{Messages: tt.cost}, now)
+
+		if ok != tt.ok || (wait-tt.wait).Abs() > time.Millisecond {
+			t.Errorf("%s: got %v and a wait of %v, want %v and %v", tt.name, ok, wait, tt.ok, tt.wait)
+		}
+
+		if !ok {
+			if user.RateLimits[Messages] != tt.bucket {
+				t.Errorf("%s: a refused cost changed the bucket to %v", tt.name, user.RateLimits[Messages])
+			}
+
+			continue
+		}
+
+		if bucket := user.RateLimits[Messages]; math.Abs(bucket.Tokens-tt.tokens) > 1e-9 || !bucket.UpdatedAt.Equal(now) {
+			t.Errorf("%s: left %v tokens as of %v, want %v", tt.name, bucket.Tokens, bucket.UpdatedAt, tt.tokens)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package request
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"ibuddy_bot/internal/models"
+)
+
+// Request is the state of the update being handled. Every update gets its own, created by
+// the current user middleware and passed down the chain, since the workers share the handlers.
+type Request struct {
+	UpdateId int
+	// User owns the conversation: the sender in a private chat, the group as seen by the sender in a group.
+	User *models.User
+	// Member is the sender, set in groups only.
+	Member *models.User
+	// Group is the group or forum topic the update comes from, nil in a private chat.
+	Group *models.Group
+	// Lang is the language of the sender's Telegram client.
+	Lang string
+	// Chat is where the update comes from, nil for inline queries.
+	Chat *tgbotapi.Chat
+	// Charge takes costs from the sender's rate limits and tells how long to wait when they run short,
+	// set by the rate limit middleware for the costs only known while handling the update. Nil when
+	// the sender is not limited.
+	Charge func(ctx context.Context, costs map[string]float64) (bool, time.Duration)
+}
+
+func New(update *tgbotapi.Update, user *models.User) *Request {
+	return &Request{
+		UpdateId: update.UpdateID,
+		User:     user,
+		Lang:     user.Lang,
+		Chat:     chat(update),
+	}
+}
+
+func chat(update *tgbotapi.Update) *tgbotapi.Chat {
+	// Buttons of inline messages come without the message, FromChat does not check.
+	if update.CallbackQuery != nil && update.CallbackQuery.Message == nil {
+		return nil
+	}
+
+	return update.FromChat()
+}
+
+// EnterGroup makes the group the owner of the conversation, the sender becoming its member.
+func (r *Request) EnterGroup(group *models.Group, user *models.User) {
+	r.Member = r.User
+	r.Group = group
+	r.User = user
+}
+
+// InGroup tells whether the update comes from a group.
+func (r *Request) InGroup() bool {
+	return r.Group != nil
+}
+
+// Sender returns the user who sent the update.
+func (r *Request) Sender() *models.User {
+	if r.Member != nil {
+		return r.Member
+	}
+
+	return r.User
+}
+
+// Take takes the costs from the sender's rate limits, see Charge.
+func (r *Request) Take(ctx context.Context, costs map[string]float64) (bool, time.Duration) {
+	if r.Charge == nil || len(costs) == 0 {
+		return true, 0
+	}
+
+	return r.Charge(ctx, costs)
+}
@@ -16,6 +16,11 @@ const (
 	usersCollectionName    = "users"
 	chatsCollectionName    = "chats"
 	messagesCollectionName = "messages"
+	chunksCollectionName   = "chunks"
+	memoriesCollectionName = "memories"
+	groupsCollectionName   = "groups"
+
+	userRateLimitsField = "rate_limits"
 )
 
 type Mongo struct {
@@ -62,6 +67,15 @@ func Init(ctx context.Context, db *Mongo) error {
 	if !collectionMap[messagesCollectionName] {
 		err = db.client.Database(databaseName).CreateCollection(ctx, messagesCollectionName)
 	}
+	if !collectionMap[chunksCollectionName] {
+		err = db.client.Database(databaseName).CreateCollection(ctx, chunksCollectionName)
+	}
+	if !collectionMap[memoriesCollectionName] {
+		err = db.client.Database(databaseName).CreateCollection(ctx, memoriesCollectionName)
+	}
+	if !collectionMap[groupsCollectionName] {
+		err = db.client.Database(databaseName).CreateCollection(ctx, groupsCollectionName)
+	}
 
 	return err
 }
@@ -96,12 +110,70 @@ func (db *Mongo) CreateUser(ctx context.Context, user *models.User) (*mongo.Inse
 	return db.client.Database(databaseName).Collection(usersCollectionName).InsertOne(ctx, user)
 }
 
+// UpdateUser stores the user but the rate limits, which only UpdateRateLimits changes. Empty omitempty
+// fields keep their stored values.
 func (db *Mongo) UpdateUser(ctx context.Context, user *models.User) (*mongo.UpdateResult, error) {
-	return db.client.Database(databaseName).Collection(usersCollectionName).ReplaceOne(
+	data, err := bson.Marshal(user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var document bson.D
+
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	fields := make(bson.D, 0, len(document))
+
+	for _, field := range document {
+		if field.Key != userRateLimitsField {
+			fields = append(fields, field)
+		}
+	}
+
+	return db.client.Database(databaseName).Collection(usersCollectionName).UpdateOne(
 		ctx,
 		bson.M{"id": user.Id},
-		user,
+		bson.M{"$set": fields},
+	)
+}
+
+// UpdateRateLimits stores the buckets of the user unless another update changed them since they were
+// previous, a bucket missing from previous must not be stored yet. It reports whether they were stored.
+func (db *Mongo) UpdateRateLimits(
+	ctx context.Context,
+	userId int64,
+	previous map[string]models.Bucket,
+	buckets map[string]models.Bucket,
+) (bool, error) {
+	filter := bson.M{"id": userId}
+	set := bson.M{}
+
+	for name, bucket := range buckets {
+		key := userRateLimitsField + "." + name
+
+		if bucket, ok := previous[name]; ok {
+			filter[key] = bucket
+		} else {
+			filter[key] = bson.M{"$exists": false}
+		}
+
+		set[key] = bucket
+	}
+
+	res, err := db.client.Database(databaseName).Collection(usersCollectionName).UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$set": set},
 	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount == 1, nil
 }
 
 func (db *Mongo) GetChatById(ctx context.Context, chatId primitive.ObjectID) (models.Chat, error) {
@@ -115,10 +187,18 @@ func (db *Mongo) GetChatById(ctx context.Context, chatId primitive.ObjectID) (mo
 	return result, err
 }
 
-func (db *Mongo) ListUserChats(ctx context.Context, id int64) ([]models.Chat, error) {
+// ListUserChats returns the chats of the user, for a group the chats of the forum topic.
+// Chats stored before topics were told apart have no thread_id and count as outside of topics.
+func (db *Mongo) ListUserChats(ctx context.Context, id int64, threadId int) ([]models.Chat, error) {
+	var thread interface{} = threadId
+
+	if threadId == 0 {
+		thread = bson.M{"$in": bson.A{0, nil}}
+	}
+
 	cur, err := db.client.Database(databaseName).Collection(chatsCollectionName).Find(
 		ctx,
-		bson.M{"user_id": id},
+		bson.M{"user_id": id, "thread_id": thread},
 	)
 
 	if err != nil {
@@ -155,6 +235,126 @@ func (db *Mongo) ListChatMessages(ctx context.Context, id primitive.ObjectID, li
 	return items, err
 }
 
+func (db *Mongo) ListChatMessagesBetween(
+	ctx context.Context,
+	id primitive.ObjectID,
+	after *primitive.ObjectID,
+	before primitive.ObjectID,
+) ([]models.Message, error) {
+	idFilter := bson.M{"$lt": before}
+
+	if after != nil {
+		idFilter["$gt"] = *after
+	}
+
+	cur, err := db.client.Database(databaseName).Collection(messagesCollectionName).Find(
+		ctx,
+		bson.M{"chat_id": id, "_id": idFilter},
+		&options.FindOptions{
+			Sort: bson.M{"_id": 1},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	items := make([]models.Message, 0)
+	err = cur.All(ctx, &items)
+
+	return items, err
+}
+
+func (db *Mongo) ListChatMessagesBefore(
+	ctx context.Context,
+	id primitive.ObjectID,
+	before primitive.ObjectID,
+	limit *int64,
+) ([]models.Message, error) {
+	cur, err := db.client.Database(databaseName).Collection(messagesCollectionName).Find(
+		ctx,
+		bson.M{"chat_id": id, "_id": bson.M{"$lt": before}},
+		&options.FindOptions{
+			Limit: limit,
+			Sort:  bson.M{"_id": -1},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	items := make([]models.Message, 0)
+	err = cur.All(ctx, &items)
+
+	return items, err
+}
+
+func (db *Mongo) GetMessageById(ctx context.Context, id primitive.ObjectID) (models.Message, error) {
+	var result models.Message
+
+	err := db.client.Database(databaseName).Collection(messagesCollectionName).FindOne(
+		ctx,
+		bson.M{"_id": id},
+	).Decode(&result)
+
+	return result, err
+}
+
+// GetUserMessage finds the user's Telegram message in the chats, leaving out the copies made by forks.
+// Telegram message ids are only unique within a Telegram chat, so the chats must be of one.
+func (db *Mongo) GetUserMessage(
+	ctx context.Context,
+	chatIds []primitive.ObjectID,
+	userId int64,
+	messageId int,
+) (models.Message, error) {
+	var result models.Message
+
+	err := db.client.Database(databaseName).Collection(messagesCollectionName).FindOne(
+		ctx,
+		bson.M{
+			"chat_id": bson.M{"$in": chatIds},
+			"user_id": userId,
+			"id":      messageId,
+			"copy_of": bson.M{"$exists": false},
+		},
+		&options.FindOneOptions{
+			Sort: bson.M{"_id": -1},
+		},
+	).Decode(&result)
+
+	return result, err
+}
+
+// GetMessageByTgId finds the latest message of the chats sent as the Telegram message, including answer parts.
+// The copies made by forks are left out, the Telegram message belongs to the thread it was sent in.
+func (db *Mongo) GetMessageByTgId(
+	ctx context.Context,
+	chatIds []primitive.ObjectID,
+	messageId int,
+) (models.Message, error) {
+	var result models.Message
+
+	err := db.client.Database(databaseName).Collection(messagesCollectionName).FindOne(
+		ctx,
+		bson.M{
+			"chat_id": bson.M{"$in": chatIds},
+			"$or":     bson.A{bson.M{"id": messageId}, bson.M{"part_ids": messageId}},
+			"copy_of": bson.M{"$exists": false},
+		},
+		&options.FindOneOptions{
+			Sort: bson.M{"_id": -1},
+		},
+	).Decode(&result)
+
+	return result, err
+}
+
 func (db *Mongo) InsertMessage(ctx context.Context, message models.Message) (*primitive.ObjectID, error) {
 	res, err := db.client.Database(databaseName).Collection(messagesCollectionName).InsertOne(
 		ctx,
@@ -170,6 +370,14 @@ func (db *Mongo) InsertMessage(ctx context.Context, message models.Message) (*pr
 	return &id, nil
 }
 
+func (db *Mongo) UpdateMessage(ctx context.Context, message *models.Message) (*mongo.UpdateResult, error) {
+	return db.client.Database(databaseName).Collection(messagesCollectionName).ReplaceOne(
+		ctx,
+		bson.M{"_id": message.ObjectId},
+		message,
+	)
+}
+
 func (db *Mongo) CreateChat(ctx context.Context, chat models.Chat) (*mongo.InsertOneResult, error) {
 	return db.client.Database(databaseName).Collection(chatsCollectionName).InsertOne(
 		ctx,
@@ -177,6 +385,151 @@ func (db *Mongo) CreateChat(ctx context.Context, chat models.Chat) (*mongo.Inser
 	)
 }
 
+func (db *Mongo) UpdateChat(ctx context.Context, chat *models.Chat) (*mongo.UpdateResult, error) {
+	return db.client.Database(databaseName).Collection(chatsCollectionName).ReplaceOne(
+		ctx,
+		bson.M{"_id": chat.Id},
+		chat,
+	)
+}
+
+func (db *Mongo) InsertChunks(ctx context.Context, chunks []models.Chunk) error {
+	documents := make([]interface{}, len(chunks))
+
+	for i, chunk := range chunks {
+		documents[i] = chunk
+	}
+
+	_, err := db.client.Database(databaseName).Collection(chunksCollectionName).InsertMany(ctx, documents)
+
+	return err
+}
+
+func (db *Mongo) ListChatChunks(ctx context.Context, chatId primitive.ObjectID) ([]models.Chunk, error) {
+	cur, err := db.client.Database(databaseName).Collection(chunksCollectionName).Find(
+		ctx,
+		bson.M{"chat_id": chatId},
+		&options.FindOptions{
+			Sort: bson.M{"_id": 1},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	items := make([]models.Chunk, 0)
+	err = cur.All(ctx, &items)
+
+	return items, err
+}
+
+func (db *Mongo) ListUserMemories(ctx context.Context, userId int64) ([]models.Memory, error) {
+	cur, err := db.client.Database(databaseName).Collection(memoriesCollectionName).Find(
+		ctx,
+		bson.M{"user_id": userId},
+		&options.FindOptions{
+			Sort: bson.M{"_id": 1},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer cur.Close(ctx)
+
+	items := make([]models.Memory, 0)
+	err = cur.All(ctx, &items)
+
+	return items, err
+}
+
+func (db *Mongo) GetMemoryById(ctx context.Context, id primitive.ObjectID) (models.Memory, error) {
+	var result models.Memory
+
+	err := db.client.Database(databaseName).Collection(memoriesCollectionName).FindOne(
+		ctx,
+		bson.M{"_id": id},
+	).Decode(&result)
+
+	return result, err
+}
+
+func (db *Mongo) InsertMemory(ctx context.Context, memory models.Memory) (*primitive.ObjectID, error) {
+	res, err := db.client.Database(databaseName).Collection(memoriesCollectionName).InsertOne(
+		ctx,
+		memory,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := res.InsertedID.(primitive.ObjectID)
+
+	return &id, nil
+}
+
+func (db *Mongo) UpdateMemory(ctx context.Context, memory *models.Memory) (*mongo.UpdateResult, error) {
+	return db.client.Database(databaseName).Collection(memoriesCollectionName).ReplaceOne(
+		ctx,
+		bson.M{"_id": memory.Id},
+		memory,
+	)
+}
+
+func (db *Mongo) DeleteMemory(ctx context.Context, id primitive.ObjectID) error {
+	_, err := db.client.Database(databaseName).Collection(memoriesCollectionName).DeleteOne(
+		ctx,
+		bson.M{"_id": id},
+	)
+
+	return err
+}
+
+func (db *Mongo) DeleteUserMemories(ctx context.Context, userId int64) error {
+	_, err := db.client.Database(databaseName).Collection(memoriesCollectionName).DeleteMany(
+		ctx,
+		bson.M{"user_id": userId},
+	)
+
+	return err
+}
+
+func (db *Mongo) GetOrCreateGroup(
+	ctx context.Context,
+	chatId int64,
+	threadId int,
+	newGroup *models.Group,
+) (models.Group, error) {
+	var result models.Group
+
+	collection := db.client.Database(databaseName).Collection(groupsCollectionName)
+	filter := bson.M{"chat_id": chatId, "thread_id": threadId}
+	err := collection.FindOne(ctx, filter).Decode(&result)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := collection.InsertOne(ctx, newGroup); err != nil {
+			return result, err
+		}
+
+		err = collection.FindOne(ctx, filter).Decode(&result)
+	}
+
+	return result, err
+}
+
+func (db *Mongo) UpdateGroup(ctx context.Context, group *models.Group) (*mongo.UpdateResult, error) {
+	return db.client.Database(databaseName).Collection(groupsCollectionName).ReplaceOne(
+		ctx,
+		bson.M{"_id": group.Id},
+		group,
+	)
+}
+
 func (db *Mongo) ListUsers(ctx context.Context) ([]models.User, error) {
 	cur, err := db.client.Database(databaseName).Collection(usersCollectionName).Find(
 		ctx,
@@ -14,11 +14,49 @@ type Storage interface {
 	GetOrCreateUser(ctx context.Context, userId int64, newUser *models.User) (models.User, error)
 	CreateUser(ctx context.Context, user *models.User) (*mongo.InsertOneResult, error)
 	UpdateUser(ctx context.Context, user *models.User) (*mongo.UpdateResult, error)
+	UpdateRateLimits(
+		ctx context.Context,
+		userId int64,
+		previous map[string]models.Bucket,
+		buckets map[string]models.Bucket,
+	) (bool, error)
 	GetChatById(ctx context.Context, chatId primitive.ObjectID) (models.Chat, error)
-	ListUserChats(ctx context.Context, id int64) ([]models.Chat, error)
+	ListUserChats(ctx context.Context, id int64, threadId int) ([]models.Chat, error)
 	ListChatMessages(ctx context.Context, id primitive.ObjectID, limit *int64) ([]models.Message, error)
+	ListChatMessagesBetween(
+		ctx context.Context,
+		id primitive.ObjectID,
+		after *primitive.ObjectID,
+		before primitive.ObjectID,
+	) ([]models.Message, error)
+	ListChatMessagesBefore(
+		ctx context.Context,
+		id primitive.ObjectID,
+		before primitive.ObjectID,
+		limit *int64,
+	) ([]models.Message, error)
+	GetMessageById(ctx context.Context, id primitive.ObjectID) (models.Message, error)
+	GetUserMessage(
+		ctx context.Context,
+		chatIds []primitive.ObjectID,
+		userId int64,
+		messageId int,
+	) (models.Message, error)
+	GetMessageByTgId(ctx context.Context, chatIds []primitive.ObjectID, messageId int) (models.Message, error)
 	InsertMessage(ctx context.Context, message models.Message) (*primitive.ObjectID, error)
+	UpdateMessage(ctx context.Context, message *models.Message) (*mongo.UpdateResult, error)
 	CreateChat(ctx context.Context, chat models.Chat) (*mongo.InsertOneResult, error)
+	UpdateChat(ctx context.Context, chat *models.Chat) (*mongo.UpdateResult, error)
+	InsertChunks(ctx context.Context, chunks []models.Chunk) error
+	ListChatChunks(ctx context.Context, chatId primitive.ObjectID) ([]models.Chunk, error)
+	ListUserMemories(ctx context.Context, userId int64) ([]models.Memory, error)
+	GetMemoryById(ctx context.Context, id primitive.ObjectID) (models.Memory, error)
+	InsertMemory(ctx context.Context, memory models.Memory) (*primitive.ObjectID, error)
+	UpdateMemory(ctx context.Context, memory *models.Memory) (*mongo.UpdateResult, error)
+	DeleteMemory(ctx context.Context, id primitive.ObjectID) error
+	DeleteUserMemories(ctx context.Context, userId int64) error
+	GetOrCreateGroup(ctx context.Context, chatId int64, threadId int, newGroup *models.Group) (models.Group, error)
+	UpdateGroup(ctx context.Context, group *models.Group) (*mongo.UpdateResult, error)
 	ListUsers(ctx context.Context) ([]models.User, error)
 	ListChats(ctx context.Context) ([]models.Chat, error)
 }
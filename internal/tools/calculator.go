@@ -0,0 +1,319 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+var (
+	calculatorConstants = map[string]float64{
+		"pi": math.Pi,
+		"e":  math.E,
+	}
+	calculatorFunctions = map[string]func(float64) float64{
+		"sqrt":  math.Sqrt,
+		"abs":   math.Abs,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"asin":  math.Asin,
+		"acos":  math.Acos,
+		"atan":  math.Atan,
+		"ln":    math.Log,
+		"log":   math.Log10,
+		"log2":  math.Log2,
+		"exp":   math.Exp,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+	}
+)
+
+// Calculator evaluates arithmetic expressions, models are unreliable at exact arithmetic.
+type Calculator struct{}
+
+func (Calculator) Name() string {
+	return "calculator"
+}
+
+func (Calculator) Description() string {
+	return "Evaluate an arithmetic expression exactly. Supports + - * / % ^, parentheses, " +
+		"the constants pi and e and the functions sqrt, abs, sin, cos, tan, asin, acos, atan, " +
+		"ln, log (base 10), log2, exp, floor, ceil, round and pow(x, y)."
+}
+
+func (Calculator) Parameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"expression": {Type: jsonschema.String, Description: "The expression, e.g. (2 + 3) ^ 2 / sqrt(16)"},
+		},
+		Required: []string{"expression"},
+	}
+}
+
+func (Calculator) Call(_ context.Context, _ Env, arguments string) (Result, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return Result{}, err
+	}
+
+	value, err := Evaluate(args.Expression)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Content: strconv.FormatFloat(value, 'g', -1, 64)}, nil
+}
+
+// Evaluate computes an arithmetic expression, ^ (or **) is exponentiation.
+func Evaluate(expression string) (float64, error) {
+	p := &expressionParser{input: strings.ReplaceAll(expression, "**", "^")}
+	value, err := p.expression()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if p.skipSpaces(); p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("the result is not a finite number")
+	}
+
+	return value, nil
+}
+
+// expressionParser is a recursive descent parser evaluating while it parses:
+//
+//	expression = term {("+" | "-") term}
+//	term       = unary {("*" | "/" | "%") unary}
+//	unary      = ("+" | "-") unary | power
+//	power      = primary ["^" unary]
+//	primary    = number | name ["(" expression {"," expression} ")"] | "(" expression ")"
+type expressionParser struct {
+	input string
+	pos   int
+}
+
+func (p *expressionParser) expression() (float64, error) {
+	value, err := p.term()
+
+	for err == nil {
+		switch p.peek() {
+		case '+':
+			p.pos++
+			var y float64
+			y, err = p.term()
+			value += y
+		case '-':
+			p.pos++
+			var y float64
+			y, err = p.term()
+			value -= y
+		default:
+			return value, nil
+		}
+	}
+
+	return 0, err
+}
+
+func (p *expressionParser) term() (float64, error) {
+	value, err := p.unary()
+
+	for err == nil {
+		op := p.peek()
+
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+
+		p.pos++
+
+		var y float64
+		y, err = p.unary()
+
+		switch {
+		case err != nil:
+		case op == '*':
+			value *= y
+		case y == 0:
+			err = fmt.Errorf("division by zero")
+		case op == '/':
+			value /= y
+		default:
+			value = math.Mod(value, y)
+		}
+	}
+
+	return 0, err
+}
+
+func (p *expressionParser) unary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.unary()
+
+		return -value, err
+	case '+':
+		p.pos++
+
+		return p.unary()
+	}
+
+	return p.power()
+}
+
+func (p *expressionParser) power() (float64, error) {
+	base, err := p.primary()
+
+	if err != nil || p.peek() != '^' {
+		return base, err
+	}
+
+	p.pos++
+	exponent, err := p.unary()
+
+	return math.Pow(base, exponent), err
+}
+
+func (p *expressionParser) primary() (float64, error) {
+	c := p.peek()
+
+	switch {
+	case c == '(':
+		p.pos++
+		value, err := p.expression()
+
+		if err != nil {
+			return 0, err
+		}
+
+		return value, p.expect(')')
+	case c == '.' || unicode.IsDigit(rune(c)):
+		start := p.pos
+
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+
+		// Exponent notation, e.g. 1.5e3.
+		if p.pos+1 < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') &&
+			(unicode.IsDigit(rune(p.input[p.pos+1])) || p.input[p.pos+1] == '-' || p.input[p.pos+1] == '+') {
+			p.pos += 2
+
+			for p.pos < len(p.input) && unicode.IsDigit(rune(p.input[p.pos])) {
+				p.pos++
+			}
+		}
+
+		return strconv.ParseFloat(p.input[start:p.pos], 64)
+	case unicode.IsLetter(rune(c)):
+		start := p.pos
+
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+
+		return p.name(strings.ToLower(p.input[start:p.pos]))
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func (p *expressionParser) name(name string) (float64, error) {
+	if p.peek() != '(' {
+		if value, ok := calculatorConstants[name]; ok {
+			return value, nil
+		}
+
+		return 0, fmt.Errorf("unknown constant %s", name)
+	}
+
+	p.pos++
+	args := make([]float64, 0, 2)
+
+	for {
+		value, err := p.expression()
+
+		if err != nil {
+			return 0, err
+		}
+
+		args = append(args, value)
+
+		if p.peek() != ',' {
+			break
+		}
+
+		p.pos++
+	}
+
+	if err := p.expect(')'); err != nil {
+		return 0, err
+	}
+
+	if name == "pow" {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("pow takes 2 arguments")
+		}
+
+		return math.Pow(args[0], args[1]), nil
+	}
+
+	fn, ok := calculatorFunctions[name]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown function %s", name)
+	}
+
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s takes 1 argument", name)
+	}
+
+	return fn(args[0]), nil
+}
+
+// peek returns the next character after spaces, or 0 at the end of the input.
+func (p *expressionParser) peek() byte {
+	p.skipSpaces()
+
+	if p.pos >= len(p.input) {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *expressionParser) expect(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at position %d", c, p.pos+1)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		value      float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"-2 ^ 2", -4},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 ** 10", 1024},
+		{"7 % 4", 3},
+		{"10 / 4", 2.5},
+		{"sqrt(16) + abs(-3)", 7},
+		{"pow(2, 8)", 256},
+		{"round(pi * 100) / 100", 3.14},
+		{"ln(e)", 1},
+		{"1e3 + .5", 1000.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			value, err := Evaluate(tt.expression)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if math.Abs(value-tt.value) > 1e-9 {
+				t.Errorf("got %v, want %v", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	for _, expression := range []string{"", "1 +", "(1", "1 2", "foo(1)", "x", "1 / 0", "sqrt(-1)", "pow(1)"} {
+		if value, err := Evaluate(expression); err == nil {
+			t.Errorf("%q evaluated to %v, want an error", expression, value)
+		}
+	}
+}
+
+func TestCalculatorCall(t *testing.T) {
+	result, err := Calculator{}.Call(context.Background(), Env{}, `{"expression": "0.1 + 0.2"}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Content != "0.30000000000000004" {
+		t.Errorf("got %q", result.Content)
+	}
+
+	if _, err := (Calculator{}).Call(context.Background(), Env{}, `not json`); err == nil {
+		t.Error("expected an error for invalid arguments")
+	}
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// DateTime tells the current date and time, by default in the user's timezone.
+type DateTime struct {
+	// Now is replaced in tests, time.Now is used when it is nil.
+	Now func() time.Time
+}
+
+func (DateTime) Name() string {
+	return "current_datetime"
+}
+
+func (DateTime) Description() string {
+	return "Get the current date, time and weekday, in the user's timezone unless another IANA timezone is given."
+}
+
+func (DateTime) Parameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"timezone": {Type: jsonschema.String, Description: "IANA timezone, e.g. Europe/Berlin"},
+		},
+	}
+}
+
+func (d DateTime) Call(_ context.Context, env Env, arguments string) (Result, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return Result{}, err
+		}
+	}
+
+	timezone := args.Timezone
+
+	if timezone == "" {
+		timezone = env.Timezone
+	}
+
+	location := time.UTC
+
+	if timezone != "" {
+		loaded, err := time.LoadLocation(timezone)
+
+		if err != nil {
+			return Result{}, fmt.Errorf("unknown timezone %q", timezone)
+		}
+
+		location = loaded
+	}
+
+	now := time.Now
+
+	if d.Now != nil {
+		now = d.Now
+	}
+
+	t := now().In(location)
+
+	return Result{Content: fmt.Sprintf("%s, %s (%s)", t.Format(time.RFC3339), t.Weekday(), location)}, nil
+}
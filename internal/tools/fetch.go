@@ -0,0 +1,234 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+const (
+	fetchTimeout   = 15 * time.Second
+	maxFetchSize   = 2 << 20
+	maxRedirects   = 5
+	fetchUserAgent = "ibuddy_bot/1.0"
+)
+
+var (
+	errBlockedAddress = errors.New("the address is not publicly routable")
+
+	hiddenElements = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head|template)\b.*?</(script|style|noscript|svg|head|template)\s*>`)
+	htmlComments   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	blockTags      = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|tr|h[1-6]|section|article|header|footer|table|blockquote|pre)\b[^>]*>`)
+	htmlTags       = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankSpace     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLines     = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// URLFetcher downloads a public web page and returns its text. Requests to private, loopback
+// and link-local addresses are refused on every connection, including redirects.
+type URLFetcher struct {
+	client *http.Client
+}
+
+func NewURLFetcher() *URLFetcher {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errBlockedAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   fetchTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+	}
+
+	return &URLFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   fetchTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("too many redirects")
+				}
+
+				return checkFetchURL(req.URL)
+			},
+		},
+	}
+}
+
+func (*URLFetcher) Name() string {
+	return "fetch_url"
+}
+
+func (*URLFetcher) Description() string {
+	return "Download a public web page or text file by its http(s) URL and return its text content."
+}
+
+func (*URLFetcher) Parameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"url": {Type: jsonschema.String, Description: "The http or https URL"},
+		},
+		Required: []string{"url"},
+	}
+}
+
+func (f *URLFetcher) Call(ctx context.Context, _ Env, arguments string) (Result, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return Result{}, err
+	}
+
+	target, err := url.Parse(strings.TrimSpace(args.URL))
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := checkFetchURL(target); err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	req.Header.Set("User-Agent", fetchUserAgent)
+	req.Header.Set("Accept", "text/html,text/plain,application/json;q=0.9,*/*;q=0.1")
+
+	resp, err := f.client.Do(req)
+
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("the server responded with status %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if !isTextMediaType(mediaType) {
+		return Result{}, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !utf8.Valid(body) {
+		body = []byte(strings.ToValidUTF8(string(body), ""))
+	}
+
+	content := string(body)
+
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		content = htmlToText(content)
+	}
+
+	return Result{Content: content}, nil
+}
+
+func checkFetchURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("only http and https URLs can be fetched")
+	}
+
+	if target.Hostname() == "" {
+		return fmt.Errorf("the URL has no host")
+	}
+
+	if target.User != nil {
+		return fmt.Errorf("URLs with credentials are not fetched")
+	}
+
+	return nil
+}
+
+// isPublicIP reports whether the address is routable on the internet, refusing private,
+// loopback, link-local (cloud metadata), multicast and unspecified addresses.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+
+		// Carrier-grade NAT, 100.64.0.0/10.
+		if ip[0] == 100 && ip[1]&0xc0 == 64 {
+			return false
+		}
+
+		if ip[0] == 0 {
+			return false
+		}
+	}
+
+	return !ip.IsPrivate() &&
+		!ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+func isTextMediaType(mediaType string) bool {
+	switch mediaType {
+	case "", "application/json", "application/xml", "application/xhtml+xml":
+		return true
+	}
+
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// htmlToText keeps the readable text of a page, one block element per line.
+func htmlToText(page string) string {
+	page = htmlComments.ReplaceAllString(page, "")
+	page = hiddenElements.ReplaceAllString(page, "")
+	page = blockTags.ReplaceAllString(page, "\n")
+	page = html.UnescapeString(htmlTags.ReplaceAllString(page, ""))
+	page = blankSpace.ReplaceAllString(page, " ")
+
+	lines := strings.Split(page, "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/pkg/llm"
+)
+
+// ImageCreator is the part of the provider used to generate images.
+type ImageCreator interface {
+	Image(ctx context.Context, request llm.ImageRequest) ([]llm.Image, error)
+}
+
+// ImageGenerator draws an image from a prompt, the image is sent to the user next to the answer.
+type ImageGenerator struct {
+	Client ImageCreator
+	Model  string
+}
+
+func (ImageGenerator) Name() string {
+	return "generate_image"
+}
+
+func (ImageGenerator) Description() string {
+	return "Generate an image from a detailed description. The image is shown to the user, " +
+		"do not repeat its URL in the answer."
+}
+
+func (ImageGenerator) Parameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"prompt": {Type: jsonschema.String, Description: "Detailed description of the image"},
+		},
+		Required: []string{"prompt"},
+	}
+}
+
+func (g ImageGenerator) Call(ctx context.Context, env Env, arguments string) (Result, error) {
+	var args struct {
+		Prompt string `json:"prompt"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return Result{}, err
+	}
+
+	if strings.TrimSpace(args.Prompt) == "" {
+		return Result{}, fmt.Errorf("empty prompt")
+	}
+
+	if env.Charge != nil {
+		costs := map[string]float64{ratelimit.Images: ratelimit.ImageCost(g.Model, "")}
+
+		if ok, wait := env.Charge(ctx, costs); !ok {
+			return Result{}, fmt.Errorf("the user reached the image limit, more images in %s", wait.Round(time.Second))
+		}
+	}
+
+	images, err := g.Client.Image(
+		ctx,
+		llm.ImageRequest{
+			Prompt: args.Prompt,
+			Model:  g.Model,
+			Size:   openai.CreateImageSize1024x1024,
+			N:      1,
+			User:   strconv.FormatInt(env.UserId, 10),
+		},
+	)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Content: "The image was generated and shown to the user."}
+
+	for _, image := range images {
+		result.Images = append(result.Images, image.URL)
+
+		if image.RevisedPrompt != "" {
+			result.Content += fmt.Sprintf(" Revised prompt: %s", image.RevisedPrompt)
+		}
+	}
+
+	return result, nil
+}
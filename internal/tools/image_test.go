@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/internal/ratelimit"
+	"ibuddy_bot/pkg/llm"
+)
+
+type fakeImageCreator struct {
+	requests int
+}
+
+func (c *fakeImageCreator) Image(context.Context, llm.ImageRequest) ([]llm.Image, error) {
+	c.requests++
+
+	return []llm.Image{{URL: "https://example.com/image.png"}}, nil
+}
+
+func TestImageGeneratorCharge(t *testing.T) {
+	for _, allowed := range []bool{true, false} {
+		client := &fakeImageCreator{}
+		generator := ImageGenerator{Client: client, Model: openai.CreateImageModelDallE3}
+
+		var charged map[string]float64
+
+		env := Env{
+			UserId: 1,
+			Charge: func(_ context.Context, costs map[string]float64) (bool, time.Duration) {
+				charged = costs
+
+				return allowed, time.Minute
+			},
+		}
+
+		result, err := generator.Call(context.Background(), env, `{"prompt": "a cat"}`)
+
+		if charged[ratelimit.Images] != 2 {
+			t.Errorf("charged %v, want 2 images", charged)
+		}
+
+		if allowed && (err != nil || client.requests != 1 || len(result.Images) != 1) {
+			t.Errorf("got %+v, %v after %d requests", result, err, client.requests)
+		}
+
+		if !allowed && (err == nil || client.requests != 0) {
+			t.Errorf("generated images past the limit: %v after %d requests", err, client.requests)
+		}
+	}
+}
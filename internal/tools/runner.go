@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"ibuddy_bot/internal/models"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	// MaxRounds bounds how many times the model may call tools before it has to answer.
+	MaxRounds = 5
+	// maxResultLength keeps a single tool result from flooding the context window.
+	maxResultLength = 8000
+)
+
+// Model completes chat requests, a provider in production and llm.Fake in tests.
+type Model interface {
+	Complete(ctx context.Context, request llm.ChatRequest) (llm.Result, error)
+}
+
+// Run is the outcome of a completion with tools: the final answer, every tool call made on the
+// way and the images the tools produced.
+type Run struct {
+	Result llm.Result
+	Calls  []models.ToolCall
+	Images []string
+}
+
+// RunCompletion offers the tools to the model and executes the calls it makes, feeding the results
+// back until the model answers with text. In the last round the model may not call tools so it has to answer.
+func RunCompletion(
+	ctx context.Context,
+	model Model,
+	registry *Registry,
+	env Env,
+	request llm.ChatRequest,
+	enabled func(name string) bool,
+) (Run, error) {
+	var run Run
+
+	definitions := registry.Definitions(enabled)
+	messages := append([]llm.Message{}, request.Messages...)
+
+	for round := 0; ; round++ {
+		request.Messages = messages
+
+		if len(definitions) > 0 {
+			request.Tools = definitions
+			request.NoToolCalls = round >= MaxRounds
+		}
+
+		result, err := model.Complete(ctx, request)
+		run.Result = result
+
+		if err != nil || len(result.ToolCalls) == 0 || request.Tools == nil || request.NoToolCalls {
+			return run, err
+		}
+
+		messages = append(
+			messages,
+			llm.Message{
+				Role:      llm.RoleAssistant,
+				Content:   result.Content,
+				ToolCalls: result.ToolCalls,
+			},
+		)
+
+		for _, toolCall := range result.ToolCalls {
+			call := models.ToolCall{
+				Id:        toolCall.Id,
+				Name:      toolCall.Name,
+				Arguments: toolCall.Arguments,
+			}
+
+			output, err := callTool(ctx, registry, env, toolCall, enabled)
+
+			if err != nil {
+				call.Error = err.Error()
+				output.Content = fmt.Sprintf("Error: %s", err)
+			}
+
+			call.Result = truncate(output.Content, maxResultLength)
+			run.Calls = append(run.Calls, call)
+			run.Images = append(run.Images, output.Images...)
+
+			messages = append(
+				messages,
+				llm.Message{
+					Role:       llm.RoleTool,
+					Content:    call.Result,
+					Name:       call.Name,
+					ToolCallId: call.Id,
+				},
+			)
+		}
+	}
+}
+
+func callTool(
+	ctx context.Context,
+	registry *Registry,
+	env Env,
+	call llm.ToolCall,
+	enabled func(name string) bool,
+) (Result, error) {
+	tool, ok := registry.Get(call.Name)
+
+	if !ok || !enabled(call.Name) {
+		return Result{}, fmt.Errorf("unknown tool %q", call.Name)
+	}
+
+	return tool.Call(ctx, env, call.Arguments)
+}
+
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+
+	if len(runes) <= limit {
+		return s
+	}
+
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ibuddy_bot/pkg/llm"
+)
+
+func allEnabled(string) bool {
+	return true
+}
+
+// fakeModel completes requests with the scripted results of an llm.Fake.
+type fakeModel struct {
+	*llm.Fake
+}
+
+func (m fakeModel) Complete(ctx context.Context, request llm.ChatRequest) (llm.Result, error) {
+	return m.Chat(ctx, request)
+}
+
+func TestRunCompletion(t *testing.T) {
+	model := &llm.Fake{
+		Results: []llm.Result{
+			{ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "calculator", Arguments: `{"expression": "6 * 7"}`}}},
+			{Content: "It is 42."},
+		},
+	}
+	request := llm.ChatRequest{Messages: []llm.Message{{Role: llm.RoleUser, Content: "What is 6 times 7?"}}}
+
+	run, err := RunCompletion(context.Background(), fakeModel{model}, NewRegistry(Calculator{}), Env{}, request, allEnabled)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Result.Content != "It is 42." {
+		t.Errorf("answer = %q", run.Result.Content)
+	}
+
+	if len(run.Calls) != 1 || run.Calls[0].Result != "42" || run.Calls[0].Error != "" {
+		t.Errorf("calls = %+v", run.Calls)
+	}
+
+	if len(model.Requests) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(model.Requests))
+	}
+
+	messages := model.Requests[1].Messages
+
+	if len(messages) != 3 || messages[1].Role != llm.RoleAssistant || messages[2].Role != llm.RoleTool ||
+		messages[2].ToolCallId != "call_1" || messages[2].Content != "42" {
+		t.Errorf("second request messages = %+v", messages)
+	}
+
+	if len(request.Messages) != 1 {
+		t.Errorf("the messages of the caller's request were changed")
+	}
+}
+
+func TestRunCompletionToolErrors(t *testing.T) {
+	model := &llm.Fake{
+		Results: []llm.Result{
+			{ToolCalls: []llm.ToolCall{
+				{Id: "call_1", Name: "calculator", Arguments: `{"expression": "1 +"}`},
+				{Id: "call_2", Name: "convert_units", Arguments: `{"value": 1, "from": "km", "to": "m"}`},
+				{Id: "call_3", Name: "unknown", Arguments: `{}`},
+			}},
+			{Content: "Sorry."},
+		},
+	}
+	enabled := func(name string) bool {
+		return name != "convert_units"
+	}
+
+	run, err := RunCompletion(context.Background(), fakeModel{model}, NewRegistry(Calculator{}, UnitConverter{}), Env{}, llm.ChatRequest{}, enabled)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(run.Calls) != 3 {
+		t.Fatalf("calls = %+v", run.Calls)
+	}
+
+	for _, call := range run.Calls {
+		if call.Error == "" || !strings.HasPrefix(call.Result, "Error: ") {
+			t.Errorf("the failed call %s has error %q and result %q", call.Name, call.Error, call.Result)
+		}
+	}
+
+	if tools := model.Requests[0].Tools; len(tools) != 1 || tools[0].Name != "calculator" {
+		t.Errorf("offered %+v, want only the calculator", tools)
+	}
+}
+
+func TestRunCompletionMaxRounds(t *testing.T) {
+	model := &llm.Fake{}
+
+	for i := 0; i <= MaxRounds; i++ {
+		model.Results = append(model.Results, llm.Result{
+			ToolCalls: []llm.ToolCall{{Id: "call", Name: "calculator", Arguments: `{"expression": "1"}`}},
+		})
+	}
+
+	run, err := RunCompletion(context.Background(), fakeModel{model}, NewRegistry(Calculator{}), Env{}, llm.ChatRequest{}, allEnabled)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.Requests) != MaxRounds+1 || len(run.Calls) != MaxRounds {
+		t.Fatalf("sent %d requests and made %d calls, want %d and %d", len(model.Requests), len(run.Calls), MaxRounds+1, MaxRounds)
+	}
+
+	for i, request := range model.Requests {
+		if len(request.Tools) != 1 || request.NoToolCalls != (i == MaxRounds) {
+			t.Errorf("round %d offered %d tools, no tool calls %t", i, len(request.Tools), request.NoToolCalls)
+		}
+	}
+}
+
+func TestRunCompletionWithoutTools(t *testing.T) {
+	model := &llm.Fake{Results: []llm.Result{{Content: "Hi."}}}
+	disabled := func(string) bool {
+		return false
+	}
+
+	run, err := RunCompletion(context.Background(), fakeModel{model}, NewRegistry(Calculator{}), Env{}, llm.ChatRequest{}, disabled)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Result.Content != "Hi." || model.Requests[0].Tools != nil || model.Requests[0].NoToolCalls {
+		t.Errorf("result = %+v, request = %+v", run.Result, model.Requests[0])
+	}
+}
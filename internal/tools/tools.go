@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"time"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"ibuddy_bot/pkg/llm"
+)
+
+// Tool is a Go function offered to the model through the tools API.
+type Tool interface {
+	Name() string
+	Description() string
+	// Parameters is the JSON schema of the arguments object.
+	Parameters() jsonschema.Definition
+	// Call runs the tool with the arguments JSON produced by the model.
+	Call(ctx context.Context, env Env, arguments string) (Result, error)
+}
+
+// Env is what tools know about the user they run for.
+type Env struct {
+	UserId   int64
+	Timezone string
+	// Charge takes what the tool spends from the user's rate limits and tells how long to wait when
+	// they run short, nil when the user is not limited.
+	Charge func(ctx context.Context, costs map[string]float64) (bool, time.Duration)
+}
+
+// Result is the tool output returned to the model, with any images the tool produced.
+type Result struct {
+	Content string
+	Images  []string
+}
+
+// Registry holds the available tools in the order they were registered.
+type Registry struct {
+	tools []Tool
+	names map[string]Tool
+}
+
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{names: make(map[string]Tool, len(tools))}
+
+	for _, tool := range tools {
+		r.tools = append(r.tools, tool)
+		r.names[tool.Name()] = tool
+	}
+
+	return r
+}
+
+func (r *Registry) List() []Tool {
+	return r.tools
+}
+
+func (r *Registry) Get(name string) (Tool, bool) {
+	tool, ok := r.names[name]
+
+	return tool, ok
+}
+
+// Definitions returns the tools API definitions of the tools for which enabled returns true.
+func (r *Registry) Definitions(enabled func(name string) bool) []llm.Tool {
+	definitions := make([]llm.Tool, 0, len(r.tools))
+
+	for _, tool := range r.tools {
+		if !enabled(tool.Name()) {
+			continue
+		}
+
+		parameters := tool.Parameters()
+		definitions = append(
+			definitions,
+			llm.Tool{
+				Name:        tool.Name(),
+				Description: tool.Description(),
+				Parameters:  &parameters,
+			},
+		)
+	}
+
+	return definitions
+}
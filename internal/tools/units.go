@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+type unit struct {
+	quantity string
+	// factor converts the unit to the base unit of its quantity.
+	factor float64
+}
+
+// units are keyed by their lowercase symbols and names. Temperatures are converted separately.
+var units = map[string]unit{
+	"mm": {"length", 0.001}, "millimeter": {"length", 0.001}, "cm": {"length", 0.01}, "centimeter": {"length", 0.01},
+	"m": {"length", 1}, "meter": {"length", 1}, "km": {"length", 1000}, "kilometer": {"length", 1000},
+	"in": {"length", 0.0254}, "inch": {"length", 0.0254}, "ft": {"length", 0.3048}, "foot": {"length", 0.3048},
+	"feet": {"length", 0.3048}, "yd": {"length", 0.9144}, "yard": {"length", 0.9144},
+	"mi": {"length", 1609.344}, "mile": {"length", 1609.344}, "nmi": {"length", 1852}, "nautical mile": {"length", 1852},
+
+	"mg": {"mass", 0.000001}, "milligram": {"mass", 0.000001}, "g": {"mass", 0.001}, "gram": {"mass", 0.001},
+	"kg": {"mass", 1}, "kilogram": {"mass", 1}, "t": {"mass", 1000}, "tonne": {"mass", 1000},
+	"oz": {"mass", 0.028349523125}, "ounce": {"mass", 0.028349523125},
+	"lb": {"mass", 0.45359237}, "pound": {"mass", 0.45359237}, "st": {"mass", 6.35029318}, "stone": {"mass", 6.35029318},
+
+	"ml": {"volume", 0.001}, "milliliter": {"volume", 0.001}, "l": {"volume", 1}, "liter": {"volume", 1},
+	"m3": {"volume", 1000}, "cubic meter": {"volume", 1000}, "tsp": {"volume", 0.00492892159375},
+	"tbsp": {"volume", 0.01478676478125}, "cup": {"volume", 0.2365882365}, "pt": {"volume", 0.473176473},
+	"pint": {"volume", 0.473176473}, "qt": {"volume", 0.946352946}, "quart": {"volume", 0.946352946},
+	"gal": {"volume", 3.785411784}, "gallon": {"volume", 3.785411784}, "fl oz": {"volume", 0.0295735295625},
+
+	"m/s": {"speed", 1}, "km/h": {"speed", 1 / 3.6}, "kph": {"speed", 1 / 3.6}, "mph": {"speed", 0.44704},
+	"kn": {"speed", 0.514444}, "knot": {"speed", 0.514444},
+
+	"m2": {"area", 1}, "square meter": {"area", 1}, "km2": {"area", 1000000}, "ha": {"area", 10000},
+	"hectare": {"area", 10000}, "acre": {"area", 4046.8564224}, "ft2": {"area", 0.09290304},
+	"square foot": {"area", 0.09290304},
+
+	"b": {"data", 1}, "byte": {"data", 1}, "kb": {"data", 1000}, "mb": {"data", 1000000}, "gb": {"data", 1e9},
+	"tb": {"data", 1e12}, "kib": {"data", 1024}, "mib": {"data", 1 << 20}, "gib": {"data", 1 << 30},
+	"tib": {"data", 1 << 40},
+
+	"s": {"time", 1}, "second": {"time", 1}, "min": {"time", 60}, "minute": {"time", 60}, "h": {"time", 3600},
+	"hour": {"time", 3600}, "day": {"time", 86400}, "week": {"time", 604800},
+}
+
+// UnitConverter converts values between units of length, mass, volume, speed, area, data, time and temperature.
+type UnitConverter struct{}
+
+func (UnitConverter) Name() string {
+	return "convert_units"
+}
+
+func (UnitConverter) Description() string {
+	return "Convert a value between units of length, mass, volume, speed, area, data size, time " +
+		"or temperature (C, F, K). Use unit symbols such as km, mi, lb, kg, gal, l, mph, GiB."
+}
+
+func (UnitConverter) Parameters() jsonschema.Definition {
+	return jsonschema.Definition{
+		Type: jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{
+			"value": {Type: jsonschema.Number, Description: "The value to convert"},
+			"from":  {Type: jsonschema.String, Description: "The unit of the value"},
+			"to":    {Type: jsonschema.String, Description: "The unit to convert to"},
+		},
+		Required: []string{"value", "from", "to"},
+	}
+}
+
+func (UnitConverter) Call(_ context.Context, _ Env, arguments string) (Result, error) {
+	var args struct {
+		Value float64 `json:"value"`
+		From  string  `json:"from"`
+		To    string  `json:"to"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return Result{}, err
+	}
+
+	value, err := ConvertUnits(args.Value, args.From, args.To)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{Content: fmt.Sprintf("%s %s", strconv.FormatFloat(value, 'g', 10, 64), args.To)}, nil
+}
+
+// ConvertUnits converts the value between two units of the same quantity.
+func ConvertUnits(value float64, from string, to string) (float64, error) {
+	from, to = normalizeUnit(from), normalizeUnit(to)
+
+	if isTemperature(from) || isTemperature(to) {
+		if !isTemperature(from) || !isTemperature(to) {
+			return 0, fmt.Errorf("can't convert between %s and %s", from, to)
+		}
+
+		return fromKelvin(toKelvin(value, from), to), nil
+	}
+
+	fromUnit, ok := units[from]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %s", from)
+	}
+
+	toUnit, ok := units[to]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %s", to)
+	}
+
+	if fromUnit.quantity != toUnit.quantity {
+		return 0, fmt.Errorf("can't convert %s (%s) to %s (%s)", from, fromUnit.quantity, to, toUnit.quantity)
+	}
+
+	return value * fromUnit.factor / toUnit.factor, nil
+}
+
+// normalizeUnit lowercases the unit and drops a plural "s" from unit names.
+func normalizeUnit(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("°", "", "²", "2", "³", "3", "metre", "meter", "litre", "liter").Replace(name)
+
+	if _, ok := units[name]; !ok && len(name) > 3 && strings.HasSuffix(name, "s") {
+		if _, ok := units[strings.TrimSuffix(name, "s")]; ok {
+			return strings.TrimSuffix(name, "s")
+		}
+	}
+
+	switch name {
+	case "c", "celsius":
+		return "c"
+	case "f", "fahrenheit":
+		return "f"
+	case "k", "kelvin":
+		return "k"
+	}
+
+	return name
+}
+
+func isTemperature(unit string) bool {
+	return unit == "c" || unit == "f" || unit == "k"
+}
+
+func toKelvin(value float64, unit string) float64 {
+	switch unit {
+	case "c":
+		return value + 273.15
+	case "f":
+		return (value-32)*5/9 + 273.15
+	}
+
+	return value
+}
+
+func fromKelvin(value float64, unit string) float64 {
+	switch unit {
+	case "c":
+		return value - 273.15
+	case "f":
+		return (value-273.15)*9/5 + 32
+	}
+
+	return value
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestConvertUnits(t *testing.T) {
+	tests := []struct {
+		value float64
+		from  string
+		to    string
+		want  float64
+	}{
+		{1, "km", "m", 1000},
+		{1, "mile", "km", 1.609344},
+		{3, "feet", "in", 36},
+		{1, "lb", "kg", 0.45359237},
+		{1, "gal", "l", 3.785411784},
+		{100, "km/h", "m/s", 27.777777778},
+		{1, "GiB", "MiB", 1024},
+		{2, "hours", "min", 120},
+		{1, "ha", "m²", 10000},
+		{100, "°C", "F", 212},
+		{32, "fahrenheit", "celsius", 0},
+		{0, "K", "C", -273.15},
+	}
+
+	for _, tt := range tests {
+		got, err := ConvertUnits(tt.value, tt.from, tt.to)
+
+		if err != nil {
+			t.Errorf("%v %s to %s: %v", tt.value, tt.from, tt.to, err)
+
+			continue
+		}
+
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%v %s = %v %s, want %v", tt.value, tt.from, got, tt.to, tt.want)
+		}
+	}
+}
+
+func TestConvertUnitsErrors(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+	}{
+		{"km", "kg"},
+		{"c", "m"},
+		{"parsec", "m"},
+		{"m", "cubit"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ConvertUnits(1, tt.from, tt.to); err == nil {
+			t.Errorf("%s to %s: expected an error", tt.from, tt.to)
+		}
+	}
+}
+
+func TestUnitConverterCall(t *testing.T) {
+	result, err := UnitConverter{}.Call(context.Background(), Env{}, `{"value": 5, "from": "km", "to": "mi"}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Content != "3.106855961 mi" {
+		t.Errorf("got %q", result.Content)
+	}
+}
@@ -1,15 +1,26 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
-func DownloadFileByUrl(url string) (*os.File, error) {
+// DownloadFileByUrl saves the response body to a temporary file the caller removes, no file is left
+// behind on errors. Like DownloadBytesByUrl's, returned errors leave out the URL.
+func DownloadFileByUrl(fileUrl string) (*os.File, error) {
+	data, err := DownloadBytesByUrl(fileUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
 	file, err := os.CreateTemp(os.TempDir(), "voice")
 
 	if err != nil {
@@ -17,16 +28,36 @@ func DownloadFileByUrl(url string) (*os.File, error) {
 	}
 	defer file.Close()
 
-	resp, err := http.Get(url)
+	if _, err := file.Write(data); err != nil {
+		os.Remove(file.Name())
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DownloadBytesByUrl reads the whole response body. Returned errors leave out the URL,
+// which may carry credentials such as the bot token.
+func DownloadBytesByUrl(fileUrl string) ([]byte, error) {
+	resp, err := http.Get(fileUrl)
+
+	var urlErr *url.Error
+
+	if errors.As(err, &urlErr) {
+		return nil, urlErr.Err
+	}
 
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(file, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed with status %s", resp.Status)
+	}
 
-	return file, err
+	return io.ReadAll(resp.Body)
 }
 
 func ConvertOggToMp3(oggFilepath string) (mp3Filepath string, err error) {
@@ -42,3 +73,18 @@ func ConvertOggToMp3(oggFilepath string) (mp3Filepath string, err error) {
 
 	return mp3Filepath, err
 }
+
+// ConvertMp3ToOgg encodes the audio with Opus in an OGG container, the format of Telegram voice messages.
+func ConvertMp3ToOgg(mp3Filepath string) (oggFilepath string, err error) {
+	name := strings.TrimSuffix(filepath.Base(mp3Filepath), filepath.Ext(mp3Filepath))
+	oggFilepath = filepath.Join(os.TempDir(), name+".ogg")
+
+	params := []string{"-y", "-i", mp3Filepath, "-c:a", "libopus", "-b:a", "48k", oggFilepath}
+	cmd := exec.Command("ffmpeg", params...)
+
+	if _, err = cmd.CombinedOutput(); err != nil {
+		oggFilepath = ""
+	}
+
+	return oggFilepath, err
+}
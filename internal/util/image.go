@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+)
+
+// SquarePNG crops the image to a centered square, scales it down to at most side pixels and encodes
+// it as an RGBA PNG, the format the image edit and variation APIs require. It also reports whether
+// the image has transparent pixels, which the edit API treats as the area to change.
+func SquarePNG(data []byte, side int) ([]byte, bool, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	size := bounds.Dx()
+
+	if bounds.Dy() < size {
+		size = bounds.Dy()
+	}
+
+	if size == 0 {
+		return nil, false, fmt.Errorf("empty image")
+	}
+
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-size)/2, bounds.Min.Y+(bounds.Dy()-size)/2)
+	square := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(square, square.Bounds(), src, origin, draw.Src)
+
+	if side > size {
+		side = size
+	}
+
+	scaled := scaleDown(square, side)
+	transparent := false
+
+	for i := 3; i < len(scaled.Pix); i += 4 {
+		if scaled.Pix[i] < 0xff {
+			transparent = true
+
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, scaled); err != nil {
+		return nil, false, err
+	}
+
+	return buf.Bytes(), transparent, nil
+}
+
+// TransparentMask returns a fully transparent PNG of the same size as the PNG image, used as the mask
+// of an edit that may change the whole image.
+func TransparentMask(imagePNG []byte) ([]byte, error) {
+	config, err := png.DecodeConfig(bytes.NewReader(imagePNG))
+
+	if err != nil {
+		return nil, err
+	}
+
+	mask := image.NewNRGBA(image.Rect(0, 0, config.Width, config.Height))
+	draw.Draw(mask, mask.Bounds(), image.NewUniform(color.Transparent), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, mask); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteTempFile stores the data in a new temporary file, the caller removes it.
+func WriteTempFile(pattern string, data []byte) (*os.File, error) {
+	file, err := os.CreateTemp(os.TempDir(), pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// scaleDown resizes a square image by averaging the source pixels covered by each target pixel.
+func scaleDown(src *image.NRGBA, side int) *image.NRGBA {
+	size := src.Bounds().Dx()
+
+	if side == size {
+		return src
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+
+	for y := 0; y < side; y++ {
+		y0, y1 := y*size/side, (y+1)*size/side
+
+		for x := 0; x < side; x++ {
+			x0, x1 := x*size/side, (x+1)*size/side
+
+			var r, g, b, a, n int
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,468 @@
+package anthropicclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	defaultBaseURL = "https://api.anthropic.com/v1"
+	apiVersion     = "2023-06-01"
+	// defaultMaxTokens is used when the request leaves it to the provider, the API requires it.
+	defaultMaxTokens = 1024
+	// maxTemperature is the upper bound of the Anthropic temperature range, OpenAI's goes up to 2.
+	maxTemperature = 1
+)
+
+// streamErrorStatuses are the status codes of the error types.
+var streamErrorStatuses = map[string]int{
+	"rate_limit_error": http.StatusTooManyRequests,
+	"api_error":        http.StatusInternalServerError,
+	"overloaded_error": 529,
+}
+
+// AnthropicClient is the Anthropic provider, talking to the Messages API.
+// Anthropic has no speech, image or embedding models, those calls return llm.ErrNotSupported.
+type AnthropicClient struct {
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewAnthropicClient(apiKey string) *AnthropicClient {
+	return &AnthropicClient{
+		apiKey:     apiKey,
+		baseURL:    defaultBaseURL,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// APIError is an error response of the API.
+type APIError struct {
+	StatusCode int
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("anthropic: %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// classified wraps the error in its llm.Error. Errors sent in the middle of a stream come
+// without a status code, it is derived from the error type.
+func (e *APIError) classified(retryAfter time.Duration) *llm.Error {
+	statusCode := e.StatusCode
+
+	if statusCode == 0 {
+		statusCode = streamErrorStatuses[e.Type]
+	}
+
+	return llm.NewAPIError(e, statusCode, e.Type, retryAfter)
+}
+
+type messagesRequest struct {
+	Model       string      `json:"model"`
+	System      string      `json:"system,omitempty"`
+	Messages    []message   `json:"messages"`
+	MaxTokens   int         `json:"max_tokens"`
+	Temperature float32     `json:"temperature,omitempty"`
+	TopP        float32     `json:"top_p,omitempty"`
+	Tools       []tool      `json:"tools,omitempty"`
+	ToolChoice  *toolChoice `json:"tool_choice,omitempty"`
+	Metadata    *metadata   `json:"metadata,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+}
+
+type toolChoice struct {
+	Type string `json:"type"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Source    *imageSource    `json:"source,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type metadata struct {
+	UserId string `json:"user_id,omitempty"`
+}
+
+type messagesResponse struct {
+	Id         string         `json:"id"`
+	Model      string         `json:"model"`
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+}
+
+// streamEvent is any of the server-sent events of a streamed message, only the fields of its type are set.
+type streamEvent struct {
+	Type         string            `json:"type"`
+	Message      *messagesResponse `json:"message"`
+	Index        int               `json:"index"`
+	ContentBlock *contentBlock     `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Error *APIError `json:"error"`
+}
+
+func (c *AnthropicClient) Chat(ctx context.Context, request llm.ChatRequest) (llm.Result, error) {
+	var resp messagesResponse
+
+	body, err := c.post(ctx, messagesRequestFrom(request, false))
+
+	if err != nil {
+		return llm.Result{}, err
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return llm.Result{}, err
+	}
+
+	result := llm.Result{Id: resp.Id, Model: resp.Model, FinishReason: finishReason(resp.StopReason)}
+
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			result.Content += block.Text
+		case "tool_use":
+			result.ToolCalls = append(result.ToolCalls, llm.ToolCall{
+				Id:        block.Id,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// Stream reads the server-sent events of the message. Tool use arguments arrive as pieces of JSON
+// and are assembled by the index of their content block.
+func (c *AnthropicClient) Stream(
+	ctx context.Context,
+	request llm.ChatRequest,
+	onDelta func(content string),
+) (llm.Result, error) {
+	var result llm.Result
+
+	body, err := c.post(ctx, messagesRequestFrom(request, true))
+
+	if err != nil {
+		return result, err
+	}
+	defer body.Close()
+
+	// calls maps content block indexes to the tool calls they hold.
+	calls := make(map[int]int)
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+
+		if !ok {
+			continue
+		}
+
+		var event streamEvent
+
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return result, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			if event.Message != nil {
+				result.Id = event.Message.Id
+				result.Model = event.Message.Model
+			}
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				calls[event.Index] = len(result.ToolCalls)
+				result.ToolCalls = append(result.ToolCalls, llm.ToolCall{
+					Id:   event.ContentBlock.Id,
+					Name: event.ContentBlock.Name,
+				})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				result.Content += event.Delta.Text
+				onDelta(result.Content)
+			case "input_json_delta":
+				if i, ok := calls[event.Index]; ok {
+					result.ToolCalls[i].Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				result.FinishReason = finishReason(event.Delta.StopReason)
+			}
+		case "error":
+			if event.Error != nil {
+				return result, event.Error.classified(0)
+			}
+		case "message_stop":
+			return completeToolCalls(result), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return completeToolCalls(result), err
+	}
+
+	return completeToolCalls(result), io.ErrUnexpectedEOF
+}
+
+func (c *AnthropicClient) Transcribe(context.Context, llm.TranscriptionRequest) (string, error) {
+	return "", fmt.Errorf("anthropic transcription: %w", llm.ErrNotSupported)
+}
+
+func (c *AnthropicClient) Speak(context.Context, llm.SpeechRequest) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("anthropic speech: %w", llm.ErrNotSupported)
+}
+
+func (c *AnthropicClient) Image(context.Context, llm.ImageRequest) ([]llm.Image, error) {
+	return nil, fmt.Errorf("anthropic images: %w", llm.ErrNotSupported)
+}
+
+func (c *AnthropicClient) Embed(context.Context, llm.EmbeddingRequest) ([][]float32, error) {
+	return nil, fmt.Errorf("anthropic embeddings: %w", llm.ErrNotSupported)
+}
+
+// post sends the request to the messages endpoint and returns the body of a successful response.
+func (c *AnthropicClient) post(ctx context.Context, request messagesRequest) (io.ReadCloser, error) {
+	payload, err := json.Marshal(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewReader(payload))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("Anthropic-Version", apiVersion)
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 == 2 {
+		return resp.Body, nil
+	}
+
+	defer resp.Body.Close()
+
+	var errorResponse struct {
+		Error APIError `json:"error"`
+	}
+
+	apiErr := &errorResponse.Error
+
+	if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil || apiErr.Message == "" {
+		apiErr.Message = resp.Status
+	}
+
+	apiErr.StatusCode = resp.StatusCode
+
+	return nil, apiErr.classified(llm.ParseRetryAfter(resp.Header))
+}
+
+// messagesRequestFrom moves the system messages to the system prompt and merges consecutive turns
+// of the same role, the API expects alternating user and assistant turns starting with the user.
+// Tool results are sent back as user turns.
+func messagesRequestFrom(request llm.ChatRequest, stream bool) messagesRequest {
+	result := messagesRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		Stream:      stream,
+	}
+
+	if result.MaxTokens == 0 {
+		result.MaxTokens = defaultMaxTokens
+	}
+
+	if result.Temperature > maxTemperature {
+		result.Temperature = maxTemperature
+	}
+
+	if request.User != "" {
+		result.Metadata = &metadata{UserId: request.User}
+	}
+
+	system := make([]string, 0)
+
+	for _, msg := range request.Messages {
+		if msg.Role == llm.RoleSystem {
+			system = append(system, messageText(msg))
+
+			continue
+		}
+
+		role := llm.RoleUser
+
+		if msg.Role == llm.RoleAssistant {
+			role = llm.RoleAssistant
+		}
+
+		if len(result.Messages) == 0 && role != llm.RoleUser {
+			continue
+		}
+
+		blocks := contentBlocks(msg)
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if last := len(result.Messages) - 1; last >= 0 && result.Messages[last].Role == role {
+			result.Messages[last].Content = append(result.Messages[last].Content, blocks...)
+		} else {
+			result.Messages = append(result.Messages, message{Role: role, Content: blocks})
+		}
+	}
+
+	result.System = strings.Join(system, "\n\n")
+
+	for _, t := range request.Tools {
+		result.Tools = append(result.Tools, tool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+	}
+
+	if request.NoToolCalls && len(result.Tools) > 0 {
+		result.ToolChoice = &toolChoice{Type: "none"}
+	}
+
+	return result
+}
+
+func contentBlocks(msg llm.Message) []contentBlock {
+	if msg.Role == llm.RoleTool {
+		return []contentBlock{{Type: "tool_result", ToolUseId: msg.ToolCallId, Content: msg.Content}}
+	}
+
+	blocks := make([]contentBlock, 0, len(msg.Parts)+len(msg.ToolCalls)+1)
+
+	if msg.Content != "" {
+		blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+	}
+
+	for _, part := range msg.Parts {
+		if part.ImageURL == "" {
+			if part.Text != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: part.Text})
+			}
+
+			continue
+		}
+
+		blocks = append(blocks, contentBlock{Type: "image", Source: imageSourceFrom(part.ImageURL)})
+	}
+
+	for _, call := range msg.ToolCalls {
+		input := json.RawMessage(call.Arguments)
+
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+
+		blocks = append(blocks, contentBlock{Type: "tool_use", Id: call.Id, Name: call.Name, Input: input})
+	}
+
+	return blocks
+}
+
+// imageSourceFrom sends data URLs inline and lets the API fetch other URLs.
+func imageSourceFrom(url string) *imageSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return &imageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+
+	return &imageSource{Type: "url", URL: url}
+}
+
+func messageText(msg llm.Message) string {
+	if msg.Content != "" {
+		return msg.Content
+	}
+
+	texts := make([]string, 0, len(msg.Parts))
+
+	for _, part := range msg.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// completeToolCalls gives calls without arguments an empty arguments object, as the API
+// sends no input deltas for tools called without arguments.
+func completeToolCalls(result llm.Result) llm.Result {
+	for i := range result.ToolCalls {
+		if result.ToolCalls[i].Arguments == "" {
+			result.ToolCalls[i].Arguments = "{}"
+		}
+	}
+
+	return result
+}
+
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return llm.FinishLength
+	case "tool_use":
+		return llm.FinishToolCalls
+	default:
+		return llm.FinishStop
+	}
+}
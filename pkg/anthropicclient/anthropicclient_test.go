@@ -0,0 +1,193 @@
+package anthropicclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ibuddy_bot/pkg/llm"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *AnthropicClient {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewAnthropicClient("key")
+	client.baseURL = srv.URL
+
+	return client
+}
+
+func TestMessagesRequestFrom(t *testing.T) {
+	request := messagesRequestFrom(
+		llm.ChatRequest{
+			Model: "claude-3-haiku-20240307",
+			Messages: []llm.Message{
+				{Role: llm.RoleSystem, Content: "Be brief."},
+				{Role: llm.RoleSystem, Content: "Answer in English."},
+				{Role: llm.RoleAssistant, Content: "dropped, the conversation starts with the user"},
+				{Role: llm.RoleUser, Content: "What time is it?"},
+				{
+					Role:      llm.RoleAssistant,
+					ToolCalls: []llm.ToolCall{{Id: "call_1", Name: "datetime", Arguments: "not json"}},
+				},
+				{Role: llm.RoleTool, ToolCallId: "call_1", Name: "datetime", Content: "12:00"},
+				{Role: llm.RoleUser, Content: "Thanks"},
+			},
+			Tools:       []llm.Tool{{Name: "datetime", Parameters: map[string]any{"type": "object"}}},
+			NoToolCalls: true,
+		},
+		false,
+	)
+
+	if request.System != "Be brief.\n\nAnswer in English." {
+		t.Errorf("system = %q", request.System)
+	}
+
+	if request.MaxTokens != defaultMaxTokens {
+		t.Errorf("max tokens = %d, want %d", request.MaxTokens, defaultMaxTokens)
+	}
+
+	roles := make([]string, len(request.Messages))
+
+	for i, msg := range request.Messages {
+		roles[i] = msg.Role
+	}
+
+	if fmt.Sprint(roles) != "[user assistant user]" {
+		t.Fatalf("roles = %v", roles)
+	}
+
+	toolUse := request.Messages[1].Content[0]
+
+	if toolUse.Type != "tool_use" || toolUse.Id != "call_1" || string(toolUse.Input) != "{}" {
+		t.Errorf("tool use = %+v", toolUse)
+	}
+
+	results := request.Messages[2].Content
+
+	if len(results) != 2 || results[0].Type != "tool_result" || results[0].ToolUseId != "call_1" || results[1].Text != "Thanks" {
+		t.Errorf("tool result turn = %+v", results)
+	}
+
+	if len(request.Tools) != 1 || request.ToolChoice == nil || request.ToolChoice.Type != "none" {
+		t.Errorf("tools = %+v, tool choice = %+v", request.Tools, request.ToolChoice)
+	}
+}
+
+func TestChat(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" || r.Header.Get("X-Api-Key") != "key" || r.Header.Get("Anthropic-Version") != apiVersion {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+
+		fmt.Fprint(w, `{
+			"id": "msg_1",
+			"model": "claude-3-haiku-20240307",
+			"stop_reason": "tool_use",
+			"content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "call_1", "name": "datetime", "input": {"zone": "UTC"}}
+			]
+		}`)
+	})
+
+	result, err := client.Chat(context.Background(), llm.ChatRequest{Model: "claude-3-haiku-20240307"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Content != "Let me check." || result.FinishReason != llm.FinishToolCalls {
+		t.Errorf("result = %+v", result)
+	}
+
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Arguments != `{"zone": "UTC"}` {
+		t.Errorf("tool calls = %+v", result.ToolCalls)
+	}
+}
+
+func TestStream(t *testing.T) {
+	events := []string{
+		`{"type": "message_start", "message": {"id": "msg_1", "model": "claude-3-haiku-20240307"}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Hello"}}`,
+		`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": " world"}}`,
+		`{"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "call_1", "name": "datetime"}}`,
+		`{"type": "message_delta", "delta": {"stop_reason": "tool_use"}}`,
+		`{"type": "message_stop"}`,
+	}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var request messagesRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !request.Stream {
+			t.Errorf("request = %+v, %v", request, err)
+		}
+
+		for _, event := range events {
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", event)
+		}
+	})
+
+	var deltas []string
+
+	result, err := client.Stream(context.Background(), llm.ChatRequest{}, func(content string) {
+		deltas = append(deltas, content)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(deltas) != "[Hello Hello world]" || result.Id != "msg_1" {
+		t.Errorf("deltas = %q, result = %+v", deltas, result)
+	}
+
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Arguments != "{}" || result.FinishReason != llm.FinishToolCalls {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		class      llm.ErrorClass
+		retryAfter string
+	}{
+		{"rate limited", http.StatusTooManyRequests, `{"error": {"type": "rate_limit_error", "message": "slow down"}}`, llm.ErrorRateLimited, "7"},
+		{"overloaded", 529, `{"error": {"type": "overloaded_error", "message": "Overloaded"}}`, llm.ErrorServer, ""},
+		{"too long", http.StatusBadRequest, `{"error": {"type": "invalid_request_error", "message": "prompt is too long"}}`, llm.ErrorContextLength, ""},
+		{"not json", http.StatusBadGateway, `<html></html>`, llm.ErrorServer, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			})
+
+			_, err := client.Chat(context.Background(), llm.ChatRequest{})
+			class, retryAfter := llm.Classify(err)
+
+			if class != tt.class {
+				t.Errorf("class = %s, want %s (%v)", class, tt.class, err)
+			}
+
+			if tt.retryAfter != "" && retryAfter.String() != tt.retryAfter+"s" {
+				t.Errorf("retry after = %s, want %ss", retryAfter, tt.retryAfter)
+			}
+		})
+	}
+}
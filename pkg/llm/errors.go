@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrorClass tells how a failed call should be handled, see Classify.
+type ErrorClass string
+
+const (
+	// ErrorOther is any error that retrying will not fix, e.g. a bad request or an invalid key.
+	ErrorOther ErrorClass = "other"
+	// ErrorRateLimited is a 429, Error.RetryAfter tells how long to wait when the provider says so.
+	ErrorRateLimited ErrorClass = "rate_limited"
+	// ErrorServer is a 5xx or an overloaded provider.
+	ErrorServer ErrorClass = "server"
+	// ErrorTimeout is a call that took too long or a connection that broke.
+	ErrorTimeout ErrorClass = "timeout"
+	// ErrorContextLength is a prompt that does not fit in the context window of the model.
+	ErrorContextLength ErrorClass = "context_length"
+	// ErrorContentPolicy is a prompt or an answer rejected by the provider's content filter.
+	ErrorContentPolicy ErrorClass = "content_policy"
+	// ErrorUnavailable is a call refused because the circuit breaker of the provider is open.
+	ErrorUnavailable ErrorClass = "unavailable"
+)
+
+// contextLengthMessages are how the providers report a context overflow.
+var contextLengthMessages = []string{"maximum context length", "prompt is too long", "context_length_exceeded"}
+
+// contentPolicyMessages are how the providers report a rejected prompt.
+var contentPolicyMessages = []string{"content_policy_violation", "content_filter", "content management policy", "safety system"}
+
+// Error is a failed call of a provider, classified by the provider from the API response.
+type Error struct {
+	Class      ErrorClass
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewAPIError classifies an error response of the API by its status code and, since the providers
+// report a context overflow and a content filter hit as bad requests, by its code and message.
+func NewAPIError(err error, statusCode int, code string, retryAfter time.Duration) *Error {
+	class := ErrorOther
+	text := strings.ToLower(code + " " + err.Error())
+
+	switch {
+	case containsAny(text, contextLengthMessages):
+		class = ErrorContextLength
+	case containsAny(text, contentPolicyMessages):
+		class = ErrorContentPolicy
+	case code == "insufficient_quota":
+		// A 429 as well, but waiting does not help.
+	case statusCode == http.StatusTooManyRequests:
+		class = ErrorRateLimited
+	case statusCode == http.StatusRequestTimeout:
+		class = ErrorTimeout
+	case statusCode >= http.StatusInternalServerError:
+		class = ErrorServer
+	}
+
+	return &Error{Class: class, StatusCode: statusCode, RetryAfter: retryAfter, Err: err}
+}
+
+// Classify returns the class of the error and how long to wait before calling again, if known.
+// Errors not classified by a provider are timeouts when the network or a deadline failed them.
+func Classify(err error) (ErrorClass, time.Duration) {
+	var llmErr *Error
+
+	if errors.As(err, &llmErr) {
+		return llmErr.Class, llmErr.RetryAfter
+	}
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout, 0
+	case err != nil && containsAny(strings.ToLower(err.Error()), contextLengthMessages):
+		return ErrorContextLength, 0
+	}
+
+	return ErrorOther, 0
+}
+
+// ParseRetryAfter reads a Retry-After header, given either in seconds or as a date.
+func ParseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+
+	if value == "" {
+		return 0
+	}
+
+	var seconds int
+
+	if _, err := fmt.Sscanf(value, "%d", &seconds); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(time.Now()) {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+func containsAny(text string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(text, substring) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeEmbeddingSize is the length of the vectors returned by Fake.Embed.
+const fakeEmbeddingSize = 16
+
+// Fake is an in-process provider for tests. Chat and Stream replay the scripted Results in order
+// and record the requests they received, the other calls return fixed data.
+type Fake struct {
+	mu sync.Mutex
+
+	Results       []Result
+	Requests      []ChatRequest
+	Transcription string
+	Speech        string
+	Images        []Image
+	// Err, when set, fails every call.
+	Err error
+}
+
+func (f *Fake) Chat(_ context.Context, request ChatRequest) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Requests = append(f.Requests, request)
+
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+
+	if len(f.Results) == 0 {
+		return Result{}, errors.New("fake has no results left")
+	}
+
+	result := f.Results[0]
+	f.Results = f.Results[1:]
+
+	if result.Model == "" {
+		result.Model = request.Model
+	}
+
+	return result, nil
+}
+
+// Stream delivers the content of the next result word by word.
+func (f *Fake) Stream(ctx context.Context, request ChatRequest, onDelta func(content string)) (Result, error) {
+	result, err := f.Chat(ctx, request)
+
+	if err != nil {
+		return result, err
+	}
+
+	content := ""
+
+	for _, word := range strings.SplitAfter(result.Content, " ") {
+		content += word
+		onDelta(content)
+	}
+
+	return result, nil
+}
+
+func (f *Fake) Transcribe(context.Context, TranscriptionRequest) (string, error) {
+	return f.Transcription, f.Err
+}
+
+func (f *Fake) Speak(context.Context, SpeechRequest) (io.ReadCloser, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	return io.NopCloser(strings.NewReader(f.Speech)), nil
+}
+
+func (f *Fake) Image(_ context.Context, request ImageRequest) ([]Image, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	n := request.N
+
+	if n == 0 {
+		n = 1
+	}
+
+	images := make([]Image, 0, n)
+
+	for i := 0; i < n && i < len(f.Images); i++ {
+		images = append(images, f.Images[i])
+	}
+
+	return images, nil
+}
+
+// Embed returns vectors derived from the words of each input, so equal texts get equal vectors
+// and texts sharing words end up close.
+func (f *Fake) Embed(_ context.Context, request EmbeddingRequest) ([][]float32, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	embeddings := make([][]float32, len(request.Input))
+
+	for i, input := range request.Input {
+		embedding := make([]float32, fakeEmbeddingSize)
+
+		for _, word := range strings.Fields(strings.ToLower(input)) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			embedding[h.Sum32()%fakeEmbeddingSize]++
+		}
+
+		embeddings[i] = embedding
+	}
+
+	return embeddings, nil
+}
@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+
+	FinishStop      = "stop"
+	FinishLength    = "length"
+	FinishToolCalls = "tool_calls"
+
+	// ImageEdit and ImageVariation are the operations on an existing image, see ImageRequest.
+	ImageEdit      = "edit"
+	ImageVariation = "variation"
+)
+
+// ErrNotSupported is returned for the calls a provider has no API for.
+var ErrNotSupported = errors.New("not supported by the provider")
+
+// LLM is a model provider. Every request names the model it is meant for, see Router.ParseModel.
+type LLM interface {
+	Chat(ctx context.Context, request ChatRequest) (Result, error)
+	// Stream calls onDelta with the content accumulated so far. On a mid-stream failure
+	// the partial result is returned together with the error.
+	Stream(ctx context.Context, request ChatRequest, onDelta func(content string)) (Result, error)
+	Transcribe(ctx context.Context, request TranscriptionRequest) (string, error)
+	// Speak returns the MP3 audio of the speech, the caller closes it.
+	Speak(ctx context.Context, request SpeechRequest) (io.ReadCloser, error)
+	Image(ctx context.Context, request ImageRequest) ([]Image, error)
+	Embed(ctx context.Context, request EmbeddingRequest) ([][]float32, error)
+}
+
+// Message is a chat turn. Messages with images have Parts instead of Content.
+// Assistant turns that called tools list the calls, and each result comes back in a tool turn.
+type Message struct {
+	Role       string
+	Content    string
+	Parts      []Part
+	Name       string
+	ToolCalls  []ToolCall
+	ToolCallId string
+}
+
+// Part is a text or, when ImageURL is set, an image given by an http(s) or data URL.
+type Part struct {
+	Text     string
+	ImageURL string
+}
+
+type ToolCall struct {
+	Id        string `bson:"id"`
+	Name      string `bson:"name"`
+	Arguments string `bson:"arguments"`
+}
+
+// Tool is a function the model may call, Parameters is the JSON schema of its arguments object.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  any
+}
+
+// ChatRequest leaves the sampling parameters to the provider's defaults when they are zero.
+type ChatRequest struct {
+	Model           string
+	Messages        []Message
+	MaxTokens       int
+	Temperature     float32
+	TopP            float32
+	PresencePenalty float32
+	Tools           []Tool
+	// NoToolCalls forbids calling the Tools, they are still sent since providers reject
+	// tool calls and results in the messages of a request without tools.
+	NoToolCalls bool
+	User        string
+}
+
+// Result is a completion, it is stored with the answer.
+type Result struct {
+	Id           string     `bson:"id"`
+	Model        string     `bson:"model"`
+	Content      string     `bson:"content"`
+	ToolCalls    []ToolCall `bson:"tool_calls,omitempty"`
+	FinishReason string     `bson:"finish_reason"`
+}
+
+type TranscriptionRequest struct {
+	Model    string
+	FilePath string
+}
+
+type SpeechRequest struct {
+	Model string
+	Input string
+	Voice string
+}
+
+// ImageRequest generates images from the prompt, or with an Operation changes the PNG image at ImagePath.
+// An edit only changes the transparent area of the image, or of the mask at MaskPath when it is set.
+type ImageRequest struct {
+	Operation string
+	Model     string
+	Prompt    string
+	Size      string
+	N         int
+	Quality   string
+	Style     string
+	User      string
+	ImagePath string
+	MaskPath  string
+}
+
+type Image struct {
+	URL           string
+	RevisedPrompt string
+}
+
+type EmbeddingRequest struct {
+	Model string
+	Input []string
+}
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"strings"
+)
+
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+
+	defaultContextWindow = 4096
+)
+
+var (
+	// chatModels are the models users can choose from besides the routed ones.
+	chatModels = []string{
+		"gpt-3.5-turbo",
+		"gpt-3.5-turbo-16k",
+		"gpt-4",
+		"gpt-4-32k",
+		"gpt-4-vision-preview",
+		"claude-3-haiku-20240307",
+		"claude-3-sonnet-20240229",
+		"claude-3-opus-20240229",
+		"claude-3-5-sonnet-20240620",
+	}
+
+	// providerPrefixes pick the provider of a model named without one.
+	providerPrefixes = []struct {
+		prefix   string
+		provider string
+	}{
+		{"claude-", ProviderAnthropic},
+	}
+
+	// visionModels are the prefixes of models that accept image content parts.
+	visionModels = []string{"gpt-4-vision", "gpt-4-1106-vision", "gpt-4-turbo-2024", "gpt-4o", "claude-3"}
+
+	// contextWindows is ordered so that more specific prefixes are matched first.
+	// Newer models cap the completion well below half of their window.
+	contextWindows = []struct {
+		prefix        string
+		size          int
+		maxCompletion int
+	}{
+		{"gpt-4o", 128000, 4096},
+		{"gpt-4-turbo", 128000, 4096},
+		{"gpt-4-vision", 128000, 4096},
+		{"gpt-4-1106", 128000, 4096},
+		{"gpt-4-0125", 128000, 4096},
+		{"gpt-4-32k", 32768, 0},
+		{"gpt-4", 8192, 0},
+		{"gpt-3.5-turbo-16k", 16385, 0},
+		{"gpt-3.5-turbo", 4096, 0},
+		{"claude-3", 200000, 4096},
+		{"claude-2.1", 200000, 4096},
+		{"claude-2", 100000, 4096},
+		{"claude-instant", 100000, 4096},
+	}
+)
+
+// ModelRoute makes a provider serve a model, e.g. a deployment on Azure OpenAI or a model of a
+// self-hosted gateway. The limits and capabilities of a model missing from the tables can be given here.
+type ModelRoute struct {
+	Model         string `json:"model"`
+	Provider      string `json:"provider"`
+	ContextWindow int    `json:"context_window"`
+	MaxCompletion int    `json:"max_completion"`
+	Tools         *bool  `json:"tools"`
+	Vision        *bool  `json:"vision"`
+}
+
+// ParseModel returns the provider serving the model and the name the provider knows it by.
+// The routes are consulted first, then the provider is either given explicitly,
+// as in "anthropic/claude-3-opus-20240229", or derived from the model name, OpenAI serving everything unknown.
+func (r *Router) ParseModel(model string) (string, string) {
+	if route, ok := r.routes[model]; ok {
+		return route.Provider, model
+	}
+
+	if provider, name, ok := strings.Cut(model, "/"); ok && r.isProvider(provider) {
+		return provider, name
+	}
+
+	for _, p := range providerPrefixes {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.provider, model
+		}
+	}
+
+	return ProviderOpenAI, model
+}
+
+func (r *Router) isProvider(name string) bool {
+	if name == ProviderOpenAI || name == ProviderAnthropic {
+		return true
+	}
+
+	for _, route := range r.routes {
+		if route.Provider == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContextWindow returns the total number of tokens (prompt and completion) the model accepts.
+func (r *Router) ContextWindow(model string) int {
+	size, _ := r.modelLimits(model)
+
+	return size
+}
+
+// MaxTokensLimit returns the largest completion size allowed for the model,
+// leaving at least half of the context window for the conversation.
+func (r *Router) MaxTokensLimit(model string) int {
+	size, maxCompletion := r.modelLimits(model)
+
+	if maxCompletion > 0 {
+		return maxCompletion
+	}
+
+	return size / 2
+}
+
+func (r *Router) modelLimits(model string) (int, int) {
+	if route, ok := r.routes[model]; ok && route.ContextWindow > 0 {
+		return route.ContextWindow, route.MaxCompletion
+	}
+
+	_, model = r.ParseModel(model)
+
+	for _, w := range contextWindows {
+		if strings.HasPrefix(model, w.prefix) {
+			return w.size, w.maxCompletion
+		}
+	}
+
+	return defaultContextWindow, 0
+}
+
+// SupportsTools reports whether the model accepts tool definitions.
+func (r *Router) SupportsTools(model string) bool {
+	if route, ok := r.routes[model]; ok && route.Tools != nil {
+		return *route.Tools
+	}
+
+	provider, model := r.ParseModel(model)
+
+	if provider == ProviderAnthropic {
+		return strings.HasPrefix(model, "claude-3")
+	}
+
+	return !strings.Contains(model, "vision-preview")
+}
+
+// SupportsVision reports whether the model accepts images.
+func (r *Router) SupportsVision(model string) bool {
+	if route, ok := r.routes[model]; ok && route.Vision != nil {
+		return *route.Vision
+	}
+
+	_, model = r.ParseModel(model)
+
+	if model == "gpt-4-turbo" {
+		return true
+	}
+
+	for _, prefix := range visionModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
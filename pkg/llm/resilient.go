@@ -0,0 +1,263 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxAttempts = 3
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 8 * time.Second
+	// maxRetryAfter is the longest wait asked for by the provider that is sat out, the user is told about longer ones.
+	maxRetryAfter = 20 * time.Second
+
+	// The breaker opens after breakerThreshold failures in a row and lets a probe call through after breakerCooldown.
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+// Resilient retries the calls of a provider that failed for a passing reason and stops calling it
+// for a while when it keeps failing, so users learn about an outage at once instead of after a timeout.
+// Image generation is not retried since a failed request may still have been billed, and neither is
+// a stream that has already delivered content.
+type Resilient struct {
+	name string
+	llm  LLM
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewResilient(name string, llm LLM) *Resilient {
+	return &Resilient{name: name, llm: llm}
+}
+
+func (r *Resilient) Chat(ctx context.Context, request ChatRequest) (Result, error) {
+	var result Result
+
+	err := r.retry(ctx, true, func() error {
+		var err error
+
+		result, err = r.llm.Chat(ctx, request)
+
+		return err
+	})
+
+	return result, err
+}
+
+func (r *Resilient) Stream(ctx context.Context, request ChatRequest, onDelta func(content string)) (Result, error) {
+	var result Result
+
+	streamed := false
+
+	err := r.retry(ctx, true, func() error {
+		var err error
+
+		result, err = r.llm.Stream(ctx, request, func(content string) {
+			streamed = true
+			onDelta(content)
+		})
+
+		if streamed && err != nil {
+			return permanent{err}
+		}
+
+		return err
+	})
+
+	return result, err
+}
+
+func (r *Resilient) Transcribe(ctx context.Context, request TranscriptionRequest) (string, error) {
+	var text string
+
+	err := r.retry(ctx, true, func() error {
+		var err error
+
+		text, err = r.llm.Transcribe(ctx, request)
+
+		return err
+	})
+
+	return text, err
+}
+
+func (r *Resilient) Speak(ctx context.Context, request SpeechRequest) (io.ReadCloser, error) {
+	var speech io.ReadCloser
+
+	err := r.retry(ctx, true, func() error {
+		var err error
+
+		speech, err = r.llm.Speak(ctx, request)
+
+		return err
+	})
+
+	return speech, err
+}
+
+func (r *Resilient) Image(ctx context.Context, request ImageRequest) ([]Image, error) {
+	var images []Image
+
+	err := r.retry(ctx, false, func() error {
+		var err error
+
+		images, err = r.llm.Image(ctx, request)
+
+		return err
+	})
+
+	return images, err
+}
+
+func (r *Resilient) Embed(ctx context.Context, request EmbeddingRequest) ([][]float32, error) {
+	var embeddings [][]float32
+
+	err := r.retry(ctx, true, func() error {
+		var err error
+
+		embeddings, err = r.llm.Embed(ctx, request)
+
+		return err
+	})
+
+	return embeddings, err
+}
+
+// permanent marks an error of a call that must not be repeated.
+type permanent struct {
+	error
+}
+
+func (p permanent) Unwrap() error {
+	return p.error
+}
+
+// retry runs the call, repeating an idempotent one with jittered exponential backoff
+// while it fails with a rate limit, a server error or a timeout.
+func (r *Resilient) retry(ctx context.Context, idempotent bool, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := r.allow(); err != nil {
+			return err
+		}
+
+		err := call()
+		retryable := idempotent
+
+		if p, ok := err.(permanent); ok {
+			err = p.error
+			retryable = false
+		}
+
+		class, retryAfter := Classify(err)
+		r.record(ctx, err, class)
+
+		if err == nil || !retryable || attempt == maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		if class != ErrorRateLimited && class != ErrorServer && class != ErrorTimeout {
+			return err
+		}
+
+		if retryAfter > maxRetryAfter {
+			return err
+		}
+
+		delay := retryAfter
+
+		if delay == 0 {
+			delay = backoff(attempt)
+		}
+
+		log.Printf("%s: attempt %d failed, retrying in %s: %v", r.name, attempt, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns a random delay up to the exponentially growing cap of the attempt ("full jitter").
+func backoff(attempt int) time.Duration {
+	limit := baseBackoff << (attempt - 1)
+
+	if limit > maxBackoff {
+		limit = maxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(limit))) + time.Millisecond
+}
+
+// allow refuses the call while the breaker is open. Once the cooldown has passed a single probe
+// is let through, its outcome closes the breaker or opens it again.
+func (r *Resilient) allow() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures < breakerThreshold {
+		return nil
+	}
+
+	wait := time.Until(r.openedAt.Add(breakerCooldown))
+
+	if wait > 0 || r.probing {
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		return &Error{Class: ErrorUnavailable, RetryAfter: wait, Err: &unavailableError{name: r.name}}
+	}
+
+	r.probing = true
+
+	return nil
+}
+
+// record counts the server errors and timeouts in a row, other outcomes show the provider is up.
+// Calls given up by the caller, cancelled or past the caller's deadline, say nothing about the provider.
+func (r *Resilient) record(ctx context.Context, err error, class ErrorClass) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.probing = false
+
+	if errors.Is(err, context.Canceled) || (err != nil && ctx.Err() != nil) {
+		return
+	}
+
+	if err == nil || (class != ErrorServer && class != ErrorTimeout) {
+		r.failures = 0
+
+		return
+	}
+
+	r.failures++
+
+	if r.failures >= breakerThreshold {
+		if r.failures == breakerThreshold {
+			log.Printf("%s: %d failures in a row, pausing calls for %s", r.name, r.failures, breakerCooldown)
+		}
+
+		r.openedAt = time.Now()
+	}
+}
+
+type unavailableError struct {
+	name string
+}
+
+func (e *unavailableError) Error() string {
+	return e.name + " is unavailable after repeated failures"
+}
@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResilientOpensBreaker(t *testing.T) {
+	fake := &Fake{Err: NewAPIError(errors.New("internal error"), http.StatusInternalServerError, "", 0)}
+	resilient := NewResilient("fake", fake)
+
+	// Image calls are not retried, every call is one failure.
+	for i := 0; i < breakerThreshold; i++ {
+		if _, err := resilient.Image(context.Background(), ImageRequest{}); err != fake.Err {
+			t.Fatalf("call %d: got %v, want the provider error", i, err)
+		}
+	}
+
+	_, err := resilient.Image(context.Background(), ImageRequest{})
+
+	if class, retryAfter := Classify(err); class != ErrorUnavailable || retryAfter <= 0 {
+		t.Errorf("got %s after %s, want %s", class, retryAfter, ErrorUnavailable)
+	}
+}
+
+func TestResilientIgnoresCallerDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+
+	<-ctx.Done()
+
+	fake := &Fake{Err: context.DeadlineExceeded}
+	resilient := NewResilient("fake", fake)
+
+	for i := 0; i < breakerThreshold*2; i++ {
+		if _, err := resilient.Chat(ctx, ChatRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("call %d: got %v, want the deadline", i, err)
+		}
+	}
+}
+
+func TestResilientDoesNotRetryBadRequests(t *testing.T) {
+	fake := &Fake{Err: NewAPIError(errors.New("invalid model"), http.StatusBadRequest, "", 0)}
+	resilient := NewResilient("fake", fake)
+
+	if _, err := resilient.Chat(context.Background(), ChatRequest{}); err != fake.Err {
+		t.Fatalf("got %v, want the provider error", err)
+	}
+
+	if len(fake.Requests) != 1 {
+		t.Errorf("sent %d requests, want 1", len(fake.Requests))
+	}
+}
+
+func TestResilientRetriesRateLimits(t *testing.T) {
+	fake := &Fake{Err: NewAPIError(errors.New("slow down"), http.StatusTooManyRequests, "", time.Millisecond)}
+	resilient := NewResilient("fake", fake)
+
+	if _, err := resilient.Chat(context.Background(), ChatRequest{}); err != fake.Err {
+		t.Fatalf("got %v, want the provider error", err)
+	}
+
+	if len(fake.Requests) != maxAttempts {
+		t.Errorf("sent %d requests, want %d", len(fake.Requests), maxAttempts)
+	}
+}
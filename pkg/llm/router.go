@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Router serves every request with the provider of its model, see ParseModel.
+// The provider receives the request with the model name it knows.
+// It also knows the limits and capabilities of the models, the routes can override them.
+type Router struct {
+	providers map[string]LLM
+	routes    map[string]ModelRoute
+	models    []string
+}
+
+// NewRouter routes the models of the routes to their providers and offers them to users
+// after the built-in chat models.
+func NewRouter(providers map[string]LLM, routes []ModelRoute) *Router {
+	r := &Router{
+		providers: providers,
+		routes:    make(map[string]ModelRoute, len(routes)),
+		models:    append([]string{}, chatModels...),
+	}
+
+	for _, route := range routes {
+		if _, ok := r.routes[route.Model]; !ok && !isChatModel(route.Model) {
+			r.models = append(r.models, route.Model)
+		}
+
+		r.routes[route.Model] = route
+	}
+
+	return r
+}
+
+func isChatModel(model string) bool {
+	for _, m := range chatModels {
+		if m == model {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Models returns the chat models whose provider is configured.
+func (r *Router) Models() []string {
+	models := make([]string, 0, len(r.models))
+
+	for _, model := range r.models {
+		if provider, _ := r.ParseModel(model); r.providers[provider] != nil {
+			models = append(models, model)
+		}
+	}
+
+	return models
+}
+
+func (r *Router) route(model string) (LLM, string, error) {
+	provider, name := r.ParseModel(model)
+
+	if llm := r.providers[provider]; llm != nil {
+		return llm, name, nil
+	}
+
+	return nil, "", fmt.Errorf("no provider %s configured for model %s", provider, model)
+}
+
+func (r *Router) Chat(ctx context.Context, request ChatRequest) (Result, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	request.Model = model
+
+	return llm.Chat(ctx, request)
+}
+
+func (r *Router) Stream(ctx context.Context, request ChatRequest, onDelta func(content string)) (Result, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	request.Model = model
+
+	return llm.Stream(ctx, request, onDelta)
+}
+
+func (r *Router) Transcribe(ctx context.Context, request TranscriptionRequest) (string, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return "", err
+	}
+
+	request.Model = model
+
+	return llm.Transcribe(ctx, request)
+}
+
+func (r *Router) Speak(ctx context.Context, request SpeechRequest) (io.ReadCloser, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Model = model
+
+	return llm.Speak(ctx, request)
+}
+
+func (r *Router) Image(ctx context.Context, request ImageRequest) ([]Image, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Model = model
+
+	return llm.Image(ctx, request)
+}
+
+func (r *Router) Embed(ctx context.Context, request EmbeddingRequest) ([][]float32, error) {
+	llm, model, err := r.route(request.Model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.Model = model
+
+	return llm.Embed(ctx, request)
+}
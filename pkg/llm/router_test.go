@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRouterRoutesByModel(t *testing.T) {
+	tests := []struct {
+		model    string
+		provider string
+		name     string
+	}{
+		{"gpt-4", ProviderOpenAI, "gpt-4"},
+		{"some-unknown-model", ProviderOpenAI, "some-unknown-model"},
+		{"claude-3-opus-20240229", ProviderAnthropic, "claude-3-opus-20240229"},
+		{"anthropic/claude-2.1", ProviderAnthropic, "claude-2.1"},
+		{"openai/gpt-4o", ProviderOpenAI, "gpt-4o"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			providers := map[string]*Fake{
+				ProviderOpenAI:    {Results: []Result{{Content: "openai"}}},
+				ProviderAnthropic: {Results: []Result{{Content: "anthropic"}}},
+			}
+			router := NewRouter(
+				map[string]LLM{
+					ProviderOpenAI:    providers[ProviderOpenAI],
+					ProviderAnthropic: providers[ProviderAnthropic],
+				},
+				nil,
+			)
+
+			result, err := router.Chat(context.Background(), ChatRequest{Model: tt.model})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Content != tt.provider {
+				t.Errorf("answered by %s, want %s", result.Content, tt.provider)
+			}
+
+			requests := providers[tt.provider].Requests
+
+			if len(requests) != 1 || requests[0].Model != tt.name {
+				t.Errorf("provider got %+v, want one request for %s", requests, tt.name)
+			}
+		})
+	}
+}
+
+func TestRouterStream(t *testing.T) {
+	fake := &Fake{Results: []Result{{Content: "one two three"}}}
+	router := NewRouter(map[string]LLM{ProviderOpenAI: fake}, nil)
+
+	var deltas []string
+
+	result, err := router.Stream(context.Background(), ChatRequest{Model: "gpt-4"}, func(content string) {
+		deltas = append(deltas, content)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deltas) != 3 || deltas[2] != result.Content {
+		t.Errorf("got deltas %q for %q", deltas, result.Content)
+	}
+}
+
+func TestRouterWithoutProvider(t *testing.T) {
+	router := NewRouter(map[string]LLM{ProviderOpenAI: &Fake{}}, nil)
+
+	if _, err := router.Chat(context.Background(), ChatRequest{Model: "claude-3-opus-20240229"}); err == nil {
+		t.Error("expected an error for a model of a provider that is not configured")
+	}
+}
+
+func TestRouterModels(t *testing.T) {
+	router := NewRouter(map[string]LLM{ProviderAnthropic: &Fake{}}, nil)
+
+	models := router.Models()
+
+	if len(models) == 0 {
+		t.Fatal("no models offered")
+	}
+
+	for _, model := range models {
+		if provider, _ := router.ParseModel(model); provider != ProviderAnthropic {
+			t.Errorf("offered %s of the unconfigured provider %s", model, provider)
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	enabled, disabled := true, false
+	gateway := &Fake{Results: []Result{{Content: "gateway"}, {Content: "gateway"}}}
+	router := NewRouter(
+		map[string]LLM{ProviderOpenAI: &Fake{}, "gateway": gateway},
+		[]ModelRoute{
+			{Model: "llama3:70b", Provider: "gateway", ContextWindow: 8192, MaxCompletion: 2048, Tools: &disabled},
+			{Model: "gpt-4", Provider: "gateway", Vision: &enabled},
+		},
+	)
+
+	for _, model := range []string{"llama3:70b", "gpt-4"} {
+		if _, err := router.Chat(context.Background(), ChatRequest{Model: model}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(gateway.Requests) != 2 || gateway.Requests[0].Model != "llama3:70b" {
+		t.Errorf("gateway got %+v", gateway.Requests)
+	}
+
+	if provider, name := router.ParseModel("gateway/mistral"); provider != "gateway" || name != "mistral" {
+		t.Errorf("gateway/mistral parsed as %s and %s", provider, name)
+	}
+
+	if router.ContextWindow("llama3:70b") != 8192 || router.MaxTokensLimit("llama3:70b") != 2048 {
+		t.Errorf("llama3:70b limits are %d and %d", router.ContextWindow("llama3:70b"), router.MaxTokensLimit("llama3:70b"))
+	}
+
+	if router.SupportsTools("llama3:70b") || !router.SupportsVision("gpt-4") {
+		t.Error("the capabilities of the routes are not used")
+	}
+
+	if NewRouter(map[string]LLM{ProviderOpenAI: &Fake{}}, nil).SupportsVision("gpt-4") {
+		t.Error("the routes of one router leak into another")
+	}
+
+	models := router.Models()
+
+	offered := make(map[string]int)
+
+	for _, model := range models {
+		offered[model]++
+	}
+
+	if offered["llama3:70b"] != 1 || offered["gpt-4"] != 1 {
+		t.Errorf("the routed models are not offered once: %v", models)
+	}
+}
+
+func TestRouterLimits(t *testing.T) {
+	router := NewRouter(nil, nil)
+
+	tests := []struct {
+		model         string
+		contextWindow int
+		maxTokens     int
+		tools         bool
+		vision        bool
+	}{
+		{"gpt-3.5-turbo", 4096, 2048, true, false},
+		{"gpt-4-32k", 32768, 16384, true, false},
+		{"gpt-4-vision-preview", 128000, 4096, false, true},
+		{"gpt-4o", 128000, 4096, true, true},
+		{"claude-3-opus-20240229", 200000, 4096, true, true},
+		{"anthropic/claude-2.1", 200000, 4096, false, false},
+		{"unknown", defaultContextWindow, defaultContextWindow / 2, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := router.ContextWindow(tt.model); got != tt.contextWindow {
+				t.Errorf("context window = %d, want %d", got, tt.contextWindow)
+			}
+
+			if got := router.MaxTokensLimit(tt.model); got != tt.maxTokens {
+				t.Errorf("max tokens = %d, want %d", got, tt.maxTokens)
+			}
+
+			if got := router.SupportsTools(tt.model); got != tt.tools {
+				t.Errorf("tools = %t, want %t", got, tt.tools)
+			}
+
+			if got := router.SupportsVision(tt.model); got != tt.vision {
+				t.Errorf("vision = %t, want %t", got, tt.vision)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package openaiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	EndpointTypeOpenAI = "openai"
+	EndpointTypeAzure  = "azure"
+
+	AuthBearer = "bearer"
+	AuthAPIKey = "api-key"
+	AuthNone   = "none"
+
+	defaultAzureAPIVersion = "2024-02-01"
+)
+
+// azureModelReplacer turns model names into the default Azure deployment names, which cannot contain dots.
+var azureModelReplacer = strings.NewReplacer(".", "", ":", "")
+
+// Endpoint is an OpenAI-compatible API: OpenAI itself, an Azure OpenAI resource or a self-hosted
+// gateway such as vLLM, Ollama or LiteLLM. Type picks the URL layout, Azure addresses every model by
+// its deployment. Deployments maps model names to the names the endpoint serves them under,
+// unmapped models keep their name (on Azure without dots). The key is read from APIKeyEnv when set,
+// so the endpoints file needs no secrets.
+type Endpoint struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	BaseURL     string            `json:"base_url"`
+	Auth        string            `json:"auth"`
+	APIKey      string            `json:"api_key"`
+	APIKeyEnv   string            `json:"api_key_env"`
+	APIVersion  string            `json:"api_version"`
+	OrgID       string            `json:"org_id"`
+	Deployments map[string]string `json:"deployments"`
+}
+
+// Endpoints is the endpoints file: the endpoints and the models routed to them.
+type Endpoints struct {
+	Endpoints []Endpoint       `json:"endpoints"`
+	Models    []llm.ModelRoute `json:"models"`
+}
+
+// LoadEndpoints reads the endpoints file and checks that every model is routed to one of its endpoints.
+func LoadEndpoints(path string) (Endpoints, error) {
+	var endpoints Endpoints
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return endpoints, err
+	}
+
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return endpoints, fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := make(map[string]bool, len(endpoints.Endpoints))
+
+	for _, endpoint := range endpoints.Endpoints {
+		if endpoint.Name == "" || names[endpoint.Name] {
+			return endpoints, fmt.Errorf("%s: endpoint names must be unique and not empty", path)
+		}
+
+		names[endpoint.Name] = true
+	}
+
+	for _, route := range endpoints.Models {
+		if !names[route.Provider] {
+			return endpoints, fmt.Errorf("%s: model %s is routed to unknown endpoint %q", path, route.Model, route.Provider)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// NewEndpointClient returns the client of the endpoint. Requests are authenticated by the HTTP client,
+// so any auth style works with either URL layout.
+func NewEndpointClient(endpoint Endpoint) (*OpenAiClient, error) {
+	var config openai.ClientConfig
+
+	switch endpoint.Type {
+	case EndpointTypeOpenAI, "":
+		config = openai.DefaultConfig("")
+
+		if endpoint.BaseURL != "" {
+			config.BaseURL = strings.TrimRight(endpoint.BaseURL, "/")
+		}
+	case EndpointTypeAzure:
+		if endpoint.BaseURL == "" {
+			return nil, fmt.Errorf("endpoint %s: azure endpoints need a base URL", endpoint.Name)
+		}
+
+		config = openai.DefaultAzureConfig("", endpoint.BaseURL)
+		// The key is sent by the HTTP client, with an empty token the library adds no header of its own.
+		config.APIType = openai.APITypeAzureAD
+		config.APIVersion = defaultAzureAPIVersion
+		config.AzureModelMapperFunc = func(model string) string {
+			return model
+		}
+	default:
+		return nil, fmt.Errorf("endpoint %s: unknown type %q", endpoint.Name, endpoint.Type)
+	}
+
+	if endpoint.APIVersion != "" {
+		config.APIVersion = endpoint.APIVersion
+	}
+
+	config.OrgID = endpoint.OrgID
+
+	key := endpoint.APIKey
+
+	if endpoint.APIKeyEnv != "" {
+		key = os.Getenv(endpoint.APIKeyEnv)
+	}
+
+	auth := endpoint.Auth
+
+	if auth == "" {
+		auth = AuthBearer
+
+		if endpoint.Type == EndpointTypeAzure {
+			auth = AuthAPIKey
+		}
+	}
+
+	header := authHeader{}
+
+	switch auth {
+	case AuthBearer:
+		header = authHeader{name: "Authorization", value: "Bearer " + key}
+	case AuthAPIKey:
+		header = authHeader{name: openai.AzureAPIKeyHeader, value: key}
+	case AuthNone:
+	default:
+		return nil, fmt.Errorf("endpoint %s: unknown auth %q", endpoint.Name, endpoint.Auth)
+	}
+
+	config.HTTPClient = &http.Client{Transport: transport{header: header, base: http.DefaultTransport}}
+
+	return &OpenAiClient{
+		client:      openai.NewClientWithConfig(config),
+		deployments: endpoint.Deployments,
+		azure:       endpoint.Type == EndpointTypeAzure,
+	}, nil
+}
+
+type authHeader struct {
+	name  string
+	value string
+}
+
+// retryAfterKey is the context key of the duration the transport sets from the Retry-After header,
+// the library does not expose the headers of a failed response.
+type retryAfterKey struct{}
+
+func withRetryAfter(ctx context.Context) (context.Context, *time.Duration) {
+	retryAfter := new(time.Duration)
+
+	return context.WithValue(ctx, retryAfterKey{}, retryAfter), retryAfter
+}
+
+// transport adds the auth header of the endpoint to every request and reports the Retry-After
+// header of the response, see withRetryAfter.
+type transport struct {
+	header authHeader
+	base   http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.header.name != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(t.header.name, t.header.value)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok && resp != nil {
+		*retryAfter = llm.ParseRetryAfter(resp.Header)
+	}
+
+	return resp, err
+}
+
+// deployment returns the name the endpoint serves the model under.
+func (c *OpenAiClient) deployment(model string) string {
+	if name, ok := c.deployments[model]; ok {
+		return name
+	}
+
+	if c.azure {
+		return azureModelReplacer.Replace(model)
+	}
+
+	return model
+}
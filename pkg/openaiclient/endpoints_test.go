@@ -0,0 +1,257 @@
+package openaiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ibuddy_bot/pkg/llm"
+)
+
+// recorded is what the test server saw of a request.
+type recorded struct {
+	path   string
+	query  string
+	header http.Header
+	model  string
+}
+
+func newTestServer(t *testing.T, requests chan<- recorded) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+
+		requests <- recorded{path: r.URL.Path, query: r.URL.RawQuery, header: r.Header, model: body.Model}
+
+		if body.Model == "busy" {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error": {"message": "Rate limit reached", "type": "requests", "code": "rate_limit_exceeded"}}`)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "1", "model": %q, "choices": [{"message": {"role": "assistant", "content": "hi"}, "finish_reason": "stop"}]}`, body.Model)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestNewEndpointClient(t *testing.T) {
+	t.Setenv("TEST_ENDPOINT_KEY", "env-key")
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		model    string
+		path     string
+		query    string
+		header   string
+		value    string
+		sent     string
+	}{
+		{
+			name:     "compatible gateway",
+			endpoint: Endpoint{Name: "gateway", APIKeyEnv: "TEST_ENDPOINT_KEY"},
+			model:    "llama3:70b",
+			path:     "/chat/completions",
+			header:   "Authorization",
+			value:    "Bearer env-key",
+			sent:     "llama3:70b",
+		},
+		{
+			name:     "compatible gateway with deployments",
+			endpoint: Endpoint{Name: "gateway", APIKey: "key", Deployments: map[string]string{"gpt-4": "openai/gpt-4"}},
+			model:    "gpt-4",
+			path:     "/chat/completions",
+			header:   "Authorization",
+			value:    "Bearer key",
+			sent:     "openai/gpt-4",
+		},
+		{
+			name:     "without auth",
+			endpoint: Endpoint{Name: "local", Auth: AuthNone, APIKey: "unused"},
+			model:    "mistral",
+			path:     "/chat/completions",
+			header:   "Authorization",
+			value:    "",
+			sent:     "mistral",
+		},
+		{
+			name:     "azure",
+			endpoint: Endpoint{Name: "azure", Type: EndpointTypeAzure, APIKey: "azure-key"},
+			model:    "gpt-3.5-turbo",
+			path:     "/openai/deployments/gpt-35-turbo/chat/completions",
+			query:    "api-version=" + defaultAzureAPIVersion,
+			header:   "Api-Key",
+			value:    "azure-key",
+			sent:     "gpt-35-turbo",
+		},
+		{
+			name: "azure with deployments and bearer auth",
+			endpoint: Endpoint{
+				Name:        "azure",
+				Type:        EndpointTypeAzure,
+				Auth:        AuthBearer,
+				APIKey:      "token",
+				APIVersion:  "2024-05-01-preview",
+				Deployments: map[string]string{"gpt-4o": "chat"},
+			},
+			model:  "gpt-4o",
+			path:   "/openai/deployments/chat/chat/completions",
+			query:  "api-version=2024-05-01-preview",
+			header: "Authorization",
+			value:  "Bearer token",
+			sent:   "chat",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan recorded, 1)
+			srv := newTestServer(t, requests)
+			tt.endpoint.BaseURL = srv.URL
+
+			client, err := NewEndpointClient(tt.endpoint)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := client.Chat(context.Background(), llm.ChatRequest{Model: tt.model})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := <-requests
+
+			if r.path != tt.path || r.query != tt.query {
+				t.Errorf("requested %s?%s, want %s?%s", r.path, r.query, tt.path, tt.query)
+			}
+
+			if got := r.header.Get(tt.header); got != tt.value {
+				t.Errorf("%s = %q, want %q", tt.header, got, tt.value)
+			}
+
+			if tt.endpoint.Type == EndpointTypeAzure && tt.header != "Authorization" && r.header.Get("Authorization") != "" {
+				t.Errorf("azure key sent as a bearer token as well")
+			}
+
+			if r.model != tt.sent || result.Content != "hi" {
+				t.Errorf("sent model %s and got %q, want %s", r.model, result.Content, tt.sent)
+			}
+		})
+	}
+}
+
+func TestNewEndpointClientErrors(t *testing.T) {
+	for _, endpoint := range []Endpoint{
+		{Name: "azure", Type: EndpointTypeAzure},
+		{Name: "unknown type", Type: "other", BaseURL: "http://localhost"},
+		{Name: "unknown auth", Auth: "basic"},
+	} {
+		if _, err := NewEndpointClient(endpoint); err == nil {
+			t.Errorf("%s: expected an error", endpoint.Name)
+		}
+	}
+}
+
+func TestEndpointRetryAfter(t *testing.T) {
+	requests := make(chan recorded, 1)
+	srv := newTestServer(t, requests)
+
+	client, err := NewEndpointClient(Endpoint{Name: "gateway", BaseURL: srv.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Chat(context.Background(), llm.ChatRequest{Model: "busy"})
+	<-requests
+
+	if class, retryAfter := llm.Classify(err); class != llm.ErrorRateLimited || retryAfter != 3*time.Second {
+		t.Errorf("got %s after %s, want %s after 3s (%v)", class, retryAfter, llm.ErrorRateLimited, err)
+	}
+}
+
+func TestLoadEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{
+			name: "valid",
+			content: `{
+				"endpoints": [{"name": "azure", "type": "azure", "base_url": "https://example.openai.azure.com"}],
+				"models": [{"model": "gpt-4o", "provider": "azure", "vision": true}]
+			}`,
+			valid: true,
+		},
+		{
+			name:    "unknown endpoint",
+			content: `{"endpoints": [{"name": "azure"}], "models": [{"model": "gpt-4o", "provider": "gateway"}]}`,
+		},
+		{
+			name:    "duplicate endpoint",
+			content: `{"endpoints": [{"name": "azure"}, {"name": "azure"}]}`,
+		},
+		{
+			name:    "unnamed endpoint",
+			content: `{"endpoints": [{"base_url": "http://localhost"}]}`,
+		},
+		{
+			name:    "not json",
+			content: `endpoints:`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "endpoints.json")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			endpoints, err := LoadEndpoints(path)
+
+			if (err == nil) != tt.valid {
+				t.Fatalf("got error %v", err)
+			}
+
+			if tt.valid && (len(endpoints.Endpoints) != 1 || len(endpoints.Models) != 1 || !*endpoints.Models[0].Vision) {
+				t.Errorf("loaded %+v", endpoints)
+			}
+		})
+	}
+}
+
+func TestChatCompletionRequestToolChoice(t *testing.T) {
+	client := NewOpenAiClient("key")
+	tools := []llm.Tool{{Name: "datetime", Parameters: map[string]any{"type": "object"}}}
+
+	if request := client.chatCompletionRequest(llm.ChatRequest{Tools: tools}); request.ToolChoice != nil {
+		t.Errorf("tool choice = %v, want none sent", request.ToolChoice)
+	}
+
+	if request := client.chatCompletionRequest(llm.ChatRequest{Tools: tools, NoToolCalls: true}); request.ToolChoice != "none" {
+		t.Errorf("tool choice = %v, want none", request.ToolChoice)
+	}
+}
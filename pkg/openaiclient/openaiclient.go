@@ -1,15 +1,401 @@
 package openaiclient
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
 	"github.com/sashabaranov/go-openai"
+	"ibuddy_bot/pkg/llm"
 )
 
+// OpenAiClient is the OpenAI provider.
 type OpenAiClient struct {
-	*openai.Client
+	client      *openai.Client
+	deployments map[string]string
+	azure       bool
 }
 
 func NewOpenAiClient(apiKey string) *OpenAiClient {
-	client := openai.NewClient(apiKey)
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = &http.Client{Transport: transport{base: http.DefaultTransport}}
+
+	return &OpenAiClient{client: openai.NewClientWithConfig(config)}
+}
+
+func (c *OpenAiClient) Chat(ctx context.Context, request llm.ChatRequest) (llm.Result, error) {
+	var result llm.Result
+
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := c.client.CreateChatCompletion(ctx, c.chatCompletionRequest(request))
+
+	if err != nil {
+		return result, apiError(err, *retryAfter)
+	}
+
+	result.Id = resp.ID
+	result.Model = resp.Model
+
+	if len(resp.Choices) == 0 {
+		return result, errors.New("no choices in the completion")
+	}
+
+	result.Content = resp.Choices[0].Message.Content
+	result.FinishReason = string(resp.Choices[0].FinishReason)
+	result.ToolCalls = toolCalls(resp.Choices[0].Message.ToolCalls)
+
+	return result, nil
+}
+
+// Stream streams the completion and calls onDelta with the content accumulated so far.
+// Tool calls arrive in pieces as well and are assembled by their index.
+// On a mid-stream failure the partial result is returned together with the error.
+func (c *OpenAiClient) Stream(
+	ctx context.Context,
+	request llm.ChatRequest,
+	onDelta func(content string),
+) (llm.Result, error) {
+	var (
+		result llm.Result
+		calls  []openai.ToolCall
+	)
+
+	ctx, retryAfter := withRetryAfter(ctx)
+	stream, err := c.client.CreateChatCompletionStream(ctx, c.chatCompletionRequest(request))
+
+	if err != nil {
+		return result, apiError(err, *retryAfter)
+	}
+
+	defer stream.Close()
+
+	for {
+		resp, err := stream.Recv()
+
+		if errors.Is(err, io.EOF) {
+			result.ToolCalls = toolCalls(calls)
+
+			return result, nil
+		}
+
+		if err != nil {
+			result.ToolCalls = toolCalls(calls)
+
+			return result, apiError(err, 0)
+		}
+
+		result.Id = resp.ID
+		result.Model = resp.Model
+
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		choice := resp.Choices[0]
+
+		if choice.FinishReason != "" {
+			result.FinishReason = string(choice.FinishReason)
+		}
+
+		if choice.Delta.Content != "" {
+			result.Content += choice.Delta.Content
+			onDelta(result.Content)
+		}
+
+		for _, delta := range choice.Delta.ToolCalls {
+			calls = appendToolCallDelta(calls, delta)
+		}
+	}
+}
+
+func (c *OpenAiClient) Transcribe(ctx context.Context, request llm.TranscriptionRequest) (string, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := c.client.CreateTranscription(
+		ctx,
+		openai.AudioRequest{
+			Model:    c.deployment(request.Model),
+			FilePath: request.FilePath,
+		},
+	)
+
+	return resp.Text, apiError(err, *retryAfter)
+}
+
+func (c *OpenAiClient) Speak(ctx context.Context, request llm.SpeechRequest) (io.ReadCloser, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	speech, err := c.client.CreateSpeech(
+		ctx,
+		openai.CreateSpeechRequest{
+			Model:          openai.SpeechModel(c.deployment(request.Model)),
+			Input:          request.Input,
+			Voice:          openai.SpeechVoice(request.Voice),
+			ResponseFormat: openai.SpeechResponseFormatMp3,
+		},
+	)
+
+	if err != nil {
+		return nil, apiError(err, *retryAfter)
+	}
+
+	return speech, nil
+}
+
+func (c *OpenAiClient) Image(ctx context.Context, request llm.ImageRequest) ([]llm.Image, error) {
+	var (
+		resp openai.ImageResponse
+		err  error
+	)
+
+	ctx, retryAfter := withRetryAfter(ctx)
+
+	switch request.Operation {
+	case llm.ImageEdit, llm.ImageVariation:
+		resp, err = c.transformImage(ctx, request)
+	default:
+		resp, err = c.client.CreateImage(
+			ctx,
+			openai.ImageRequest{
+				Prompt:         request.Prompt,
+				Model:          c.deployment(request.Model),
+				Size:           request.Size,
+				N:              request.N,
+				Quality:        request.Quality,
+				Style:          request.Style,
+				ResponseFormat: openai.CreateImageResponseFormatURL,
+				User:           request.User,
+			},
+		)
+	}
+
+	if err != nil {
+		return nil, apiError(err, *retryAfter)
+	}
+
+	images := make([]llm.Image, len(resp.Data))
+
+	for i, data := range resp.Data {
+		images[i] = llm.Image{URL: data.URL, RevisedPrompt: data.RevisedPrompt}
+	}
+
+	return images, nil
+}
+
+// transformImage edits or varies the image, the API takes the image and the mask as files.
+func (c *OpenAiClient) transformImage(ctx context.Context, request llm.ImageRequest) (openai.ImageResponse, error) {
+	image, err := os.Open(request.ImagePath)
+
+	if err != nil {
+		return openai.ImageResponse{}, err
+	}
+	defer image.Close()
+
+	if request.Operation == llm.ImageVariation {
+		return c.client.CreateVariImage(
+			ctx,
+			openai.ImageVariRequest{
+				Image:          image,
+				Model:          c.deployment(request.Model),
+				N:              request.N,
+				Size:           request.Size,
+				ResponseFormat: openai.CreateImageResponseFormatURL,
+			},
+		)
+	}
+
+	edit := openai.ImageEditRequest{
+		Image:          image,
+		Prompt:         request.Prompt,
+		Model:          c.deployment(request.Model),
+		N:              request.N,
+		Size:           request.Size,
+		ResponseFormat: openai.CreateImageResponseFormatURL,
+	}
+
+	if request.MaskPath != "" {
+		mask, err := os.Open(request.MaskPath)
+
+		if err != nil {
+			return openai.ImageResponse{}, err
+		}
+		defer mask.Close()
+
+		edit.Mask = mask
+	}
+
+	return c.client.CreateEditImage(ctx, edit)
+}
+
+func (c *OpenAiClient) Embed(ctx context.Context, request llm.EmbeddingRequest) ([][]float32, error) {
+	ctx, retryAfter := withRetryAfter(ctx)
+	resp, err := c.client.CreateEmbeddings(
+		ctx,
+		openai.EmbeddingRequestStrings{
+			Input: request.Input,
+			Model: openai.EmbeddingModel(c.deployment(request.Model)),
+		},
+	)
+
+	if err != nil {
+		return nil, apiError(err, *retryAfter)
+	}
+
+	embeddings := make([][]float32, len(resp.Data))
+
+	for i, data := range resp.Data {
+		embeddings[i] = data.Embedding
+	}
+
+	return embeddings, nil
+}
+
+func (c *OpenAiClient) chatCompletionRequest(request llm.ChatRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(request.Messages))
+
+	for i, message := range request.Messages {
+		messages[i] = chatCompletionMessage(message)
+	}
+
+	var tools []openai.Tool
+
+	for _, tool := range request.Tools {
+		tools = append(
+			tools,
+			openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			},
+		)
+	}
+
+	var toolChoice any
+
+	if request.NoToolCalls && len(tools) > 0 {
+		toolChoice = "none"
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:           c.deployment(request.Model),
+		Messages:        messages,
+		MaxTokens:       request.MaxTokens,
+		Temperature:     request.Temperature,
+		TopP:            request.TopP,
+		PresencePenalty: request.PresencePenalty,
+		Tools:           tools,
+		ToolChoice:      toolChoice,
+		User:            request.User,
+	}
+}
+
+func chatCompletionMessage(message llm.Message) openai.ChatCompletionMessage {
+	result := openai.ChatCompletionMessage{
+		Role:       message.Role,
+		Content:    message.Content,
+		Name:       message.Name,
+		ToolCallID: message.ToolCallId,
+	}
+
+	for _, part := range message.Parts {
+		if part.ImageURL != "" {
+			result.MultiContent = append(result.MultiContent, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: part.ImageURL, Detail: openai.ImageURLDetailAuto},
+			})
+		} else {
+			result.MultiContent = append(result.MultiContent, openai.ChatMessagePart{
+				Type: openai.ChatMessagePartTypeText,
+				Text: part.Text,
+			})
+		}
+	}
+
+	if len(result.MultiContent) > 0 {
+		result.Content = ""
+	}
+
+	for _, call := range message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, openai.ToolCall{
+			ID:   call.Id,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Name,
+				Arguments: call.Arguments,
+			},
+		})
+	}
+
+	return result
+}
+
+func toolCalls(calls []openai.ToolCall) []llm.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	result := make([]llm.ToolCall, len(calls))
+
+	for i, call := range calls {
+		result[i] = llm.ToolCall{Id: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments}
+	}
+
+	return result
+}
+
+func appendToolCallDelta(calls []openai.ToolCall, delta openai.ToolCall) []openai.ToolCall {
+	// Without an index the delta continues the last call.
+	index := len(calls) - 1
+
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+
+	if index < 0 {
+		index = 0
+	}
+
+	for index >= len(calls) {
+		calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+	}
+
+	call := &calls[index]
+
+	if delta.ID != "" {
+		call.ID = delta.ID
+	}
+
+	if delta.Type != "" {
+		call.Type = delta.Type
+	}
+
+	call.Function.Name += delta.Function.Name
+	call.Function.Arguments += delta.Function.Arguments
+
+	return calls
+}
+
+// apiError classifies the error of a request, see llm.NewAPIError.
+func apiError(err error, retryAfter time.Duration) error {
+	var (
+		apiErr     *openai.APIError
+		requestErr *openai.RequestError
+	)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &apiErr):
+		code, _ := apiErr.Code.(string)
+
+		return llm.NewAPIError(err, apiErr.HTTPStatusCode, code, retryAfter)
+	case errors.As(err, &requestErr):
+		return llm.NewAPIError(err, requestErr.HTTPStatusCode, "", retryAfter)
+	}
 
-	return &OpenAiClient{client}
+	return err
 }
@@ -0,0 +1,311 @@
+package tgbotclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ModeCommonMark marks CommonMark text (e.g. model output) that is rendered to Telegram HTML before sending.
+const ModeCommonMark = "CommonMark"
+
+var (
+	markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	htmlEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+	// linkSchemes are the URL schemes Telegram accepts in text links.
+	linkSchemes = []string{"http://", "https://", "tg://"}
+)
+
+// RenderHTML converts CommonMark into the subset of HTML supported by Telegram.
+// Elements Telegram has no entity for are approximated: headings become bold,
+// lists get bullet or number prefixes and tables are laid out in a preformatted block.
+func RenderHTML(source string) string {
+	return render(source, false)
+}
+
+// RenderPlainText converts CommonMark into plain text without any markup.
+func RenderPlainText(source string) string {
+	return render(source, true)
+}
+
+func render(source string, plain bool) string {
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+	r := &markdownRenderer{source: src, plain: plain}
+
+	return strings.TrimSpace(r.blocks(doc, "\n\n"))
+}
+
+type markdownRenderer struct {
+	source []byte
+	plain  bool
+}
+
+func (r *markdownRenderer) blocks(parent ast.Node, separator string) string {
+	items := make([]string, 0, parent.ChildCount())
+
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		if item := r.block(n); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return strings.Join(items, separator)
+}
+
+func (r *markdownRenderer) block(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return r.inlines(n)
+	case *ast.Heading:
+		return r.tag("b", r.inlines(n))
+	case *ast.ThematicBreak:
+		return "———"
+	case *ast.FencedCodeBlock:
+		return r.code(string(n.Lines().Value(r.source)), string(n.Language(r.source)))
+	case *ast.CodeBlock:
+		return r.code(string(n.Lines().Value(r.source)), "")
+	case *ast.Blockquote:
+		return r.tag("blockquote", r.blocks(n, "\n\n"))
+	case *ast.List:
+		return r.list(n)
+	case *ast.HTMLBlock:
+		raw := string(n.Lines().Value(r.source))
+
+		if n.HasClosure() {
+			raw += string(n.ClosureLine.Value(r.source))
+		}
+
+		return r.escape(strings.TrimRight(raw, "\n"))
+	case *east.Table:
+		return r.table(n)
+	default:
+		return r.blocks(n, "\n\n")
+	}
+}
+
+func (r *markdownRenderer) list(list *ast.List) string {
+	separator := "\n\n"
+
+	if list.IsTight {
+		separator = "\n"
+	}
+
+	items := make([]string, 0, list.ChildCount())
+	number := list.Start
+
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "•"
+
+		if list.IsOrdered() {
+			marker = fmt.Sprintf("%d.", number)
+			number++
+		}
+
+		indent := strings.Repeat(" ", len([]rune(marker))+1)
+		content := strings.ReplaceAll(r.blocks(item, separator), "\n", "\n"+indent)
+		items = append(items, fmt.Sprintf("%s %s", marker, content))
+	}
+
+	return strings.Join(items, separator)
+}
+
+// table lays the cells out in fixed-width columns, Telegram has no table entity.
+func (r *markdownRenderer) table(table *east.Table) string {
+	plainCells := &markdownRenderer{source: r.source, plain: true}
+	rows := make([][]string, 0)
+	widths := make([]int, 0)
+
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cells := make([]string, 0)
+
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			value := plainCells.inlines(cell)
+
+			if len(widths) <= len(cells) {
+				widths = append(widths, 0)
+			}
+
+			if length := TextLength(value); length > widths[len(cells)] {
+				widths[len(cells)] = length
+			}
+
+			cells = append(cells, value)
+		}
+
+		rows = append(rows, cells)
+	}
+
+	lines := make([]string, 0, len(rows)+1)
+
+	for i, cells := range rows {
+		padded := make([]string, len(cells))
+
+		for j, cell := range cells {
+			padding := strings.Repeat(" ", widths[j]-TextLength(cell))
+
+			if j < len(table.Alignments) && table.Alignments[j] == east.AlignRight {
+				padded[j] = padding + cell
+			} else {
+				padded[j] = cell + padding
+			}
+		}
+
+		lines = append(lines, strings.TrimRight(strings.Join(padded, " | "), " "))
+
+		if i == 0 {
+			separators := make([]string, len(widths))
+
+			for j, width := range widths {
+				separators[j] = strings.Repeat("-", width)
+			}
+
+			lines = append(lines, strings.Join(separators, "-+-"))
+		}
+	}
+
+	return r.tag("pre", r.escape(strings.Join(lines, "\n")))
+}
+
+func (r *markdownRenderer) code(code string, language string) string {
+	code = r.escape(strings.TrimRight(code, "\n"))
+
+	if r.plain {
+		return code
+	}
+
+	if language != "" {
+		return fmt.Sprintf(`<pre><code class="language-%s">%s</code></pre>`, attributeEscaper.Replace(language), code)
+	}
+
+	return fmt.Sprintf("<pre>%s</pre>", code)
+}
+
+func (r *markdownRenderer) inlines(parent ast.Node) string {
+	var sb strings.Builder
+
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		sb.WriteString(r.inline(n))
+	}
+
+	return sb.String()
+}
+
+func (r *markdownRenderer) inline(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Text:
+		value := r.escape(unescapeMarkdown(n.Value(r.source)))
+
+		if n.SoftLineBreak() || n.HardLineBreak() {
+			value += "\n"
+		}
+
+		return value
+	case *ast.String:
+		return r.escape(string(n.Value))
+	case *ast.CodeSpan:
+		var sb strings.Builder
+
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			if t, ok := c.(*ast.Text); ok {
+				sb.Write(t.Value(r.source))
+			} else if s, ok := c.(*ast.String); ok {
+				sb.Write(s.Value)
+			}
+		}
+
+		return r.tag("code", r.escape(sb.String()))
+	case *ast.Emphasis:
+		if n.Level >= 2 {
+			return r.tag("b", r.inlines(n))
+		}
+
+		return r.tag("i", r.inlines(n))
+	case *east.Strikethrough:
+		return r.tag("s", r.inlines(n))
+	case *ast.Link:
+		return r.link(string(n.Destination), r.inlines(n))
+	case *ast.AutoLink:
+		url := string(n.URL(r.source))
+
+		if n.AutoLinkType == ast.AutoLinkEmail {
+			return r.escape(string(n.Label(r.source)))
+		}
+
+		return r.link(url, r.escape(string(n.Label(r.source))))
+	case *ast.Image:
+		alt := r.inlines(n)
+
+		if alt == "" {
+			alt = "image"
+		}
+
+		return r.link(string(n.Destination), alt)
+	case *ast.RawHTML:
+		return r.escape(string(n.Segments.Value(r.source)))
+	case *east.TaskCheckBox:
+		if n.IsChecked {
+			return "☑ "
+		}
+
+		return "☐ "
+	default:
+		return r.inlines(n)
+	}
+}
+
+func (r *markdownRenderer) link(url string, label string) string {
+	if !isSupportedLink(url) {
+		return label
+	}
+
+	if r.plain {
+		if label == url {
+			return url
+		}
+
+		return fmt.Sprintf("%s (%s)", label, url)
+	}
+
+	return fmt.Sprintf(`<a href="%s">%s</a>`, attributeEscaper.Replace(url), label)
+}
+
+func (r *markdownRenderer) tag(name string, content string) string {
+	if r.plain || content == "" {
+		return content
+	}
+
+	return fmt.Sprintf("<%s>%s</%s>", name, content, name)
+}
+
+func (r *markdownRenderer) escape(s string) string {
+	if r.plain {
+		return s
+	}
+
+	return htmlEscaper.Replace(s)
+}
+
+func isSupportedLink(url string) bool {
+	for _, scheme := range linkSchemes {
+		if strings.HasPrefix(strings.ToLower(url), scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescapeMarkdown resolves backslash escapes and character references left in text segments.
+func unescapeMarkdown(value []byte) string {
+	return string(util.UnescapePunctuations(util.ResolveEntityNames(util.ResolveNumericReferences(value))))
+}
@@ -0,0 +1,97 @@
+package tgbotclient
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		html   string
+		plain  string
+	}{
+		{
+			name:   "fenced code block",
+			source: "```go\nif a < b && c {\n}\n```",
+			html:   "<pre><code class=\"language-go\">if a &lt; b &amp;&amp; c {\n}</code></pre>",
+			plain:  "if a < b && c {\n}",
+		},
+		{
+			name:   "indented code block",
+			source: "    indented <code>",
+			html:   "<pre>indented &lt;code&gt;</pre>",
+			plain:  "indented <code>",
+		},
+		{
+			name:   "code span",
+			source: "run `a <b>` now",
+			html:   "run <code>a &lt;b&gt;</code> now",
+			plain:  "run a <b> now",
+		},
+		{
+			name:   "nested lists",
+			source: "- one\n- two\n  - nested\n  - nested **bold**\n- three",
+			html:   "• one\n• two\n  • nested\n  • nested <b>bold</b>\n• three",
+			plain:  "• one\n• two\n  • nested\n  • nested bold\n• three",
+		},
+		{
+			name:   "ordered lists",
+			source: "3. first\n4. second\n   1. inner",
+			html:   "3. first\n4. second\n   1. inner",
+			plain:  "3. first\n4. second\n   1. inner",
+		},
+		{
+			name:   "table",
+			source: "| Name | Qty |\n|:--|--:|\n| apple | 3 |\n| kiwi & co | 12 |",
+			html:   "<pre>Name      | Qty\n----------+----\napple     |   3\nkiwi &amp; co |  12</pre>",
+			plain:  "Name      | Qty\n----------+----\napple     |   3\nkiwi & co |  12",
+		},
+		{
+			name:   "links",
+			source: "[site](https://example.com/?a=1&b=\"2\") and <https://go.dev>",
+			html:   "<a href=\"https://example.com/?a=1&amp;b=&quot;2&quot;\">site</a> and <a href=\"https://go.dev\">https://go.dev</a>",
+			plain:  "site (https://example.com/?a=1&b=\"2\") and https://go.dev",
+		},
+		{
+			name:   "unsupported link scheme",
+			source: "[click](javascript:alert(1))",
+			html:   "click",
+			plain:  "click",
+		},
+		{
+			name:   "html escaping",
+			source: "5 < 6 & 7 > 3 <b>not a tag</b>",
+			html:   "5 &lt; 6 &amp; 7 &gt; 3 &lt;b&gt;not a tag&lt;/b&gt;",
+			plain:  "5 < 6 & 7 > 3 <b>not a tag</b>",
+		},
+		{
+			name:   "unclosed emphasis and code span",
+			source: "**bold without end and `code without end",
+			html:   "**bold without end and `code without end",
+			plain:  "**bold without end and `code without end",
+		},
+		{
+			name:   "unclosed code block",
+			source: "```python\nprint(1 < 2)",
+			html:   "<pre><code class=\"language-python\">print(1 &lt; 2)</code></pre>",
+			plain:  "print(1 < 2)",
+		},
+		{
+			name:   "heading, quote and strikethrough",
+			source: "# Title\n> quote *it*\n\n~~gone~~",
+			html:   "<b>Title</b>\n\n<blockquote>quote <i>it</i></blockquote>\n\n<s>gone</s>",
+			plain:  "Title\n\nquote it\n\ngone",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderHTML(tt.source); got != tt.html {
+				t.Errorf("RenderHTML(%q) = %q, want %q", tt.source, got, tt.html)
+			}
+
+			if got := RenderPlainText(tt.source); got != tt.plain {
+				t.Errorf("RenderPlainText(%q) = %q, want %q", tt.source, got, tt.plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package tgbotclient
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// IsAddressed reports whether a group message is meant for the bot: a command without a bot name
+// or with the bot's name, a reply to one of the bot's messages or a message mentioning the bot.
+func (h *TgBotClient) IsAddressed(message *tgbotapi.Message) bool {
+	if message.IsCommand() {
+		_, name, ok := strings.Cut(message.CommandWithAt(), "@")
+
+		return !ok || strings.EqualFold(name, h.Self.UserName)
+	}
+
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == h.Self.ID {
+		return true
+	}
+
+	return h.isMentioned(message.Text, message.Entities) || h.isMentioned(message.Caption, message.CaptionEntities)
+}
+
+func (h *TgBotClient) isMentioned(text string, entities []tgbotapi.MessageEntity) bool {
+	for _, entity := range entities {
+		switch {
+		case entity.Type == "text_mention" && entity.User != nil && entity.User.ID == h.Self.ID:
+			return true
+		case entity.IsMention() && strings.EqualFold(entityText(text, entity), "@"+h.Self.UserName):
+			return true
+		}
+	}
+
+	return false
+}
+
+// entityText cuts the entity out of the text, entity offsets are counted in UTF-16 code units.
+func entityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(units) {
+		return ""
+	}
+
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
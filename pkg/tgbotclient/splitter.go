@@ -0,0 +1,271 @@
+package tgbotclient
+
+import (
+	"strings"
+)
+
+const codeFence = "```"
+
+// SplitText splits text into parts of at most limit characters. It prefers to break between
+// paragraphs and code blocks, then between lines, then between words, and never inside a rune.
+// Code blocks cut across parts are closed at the end of a part and reopened with the same
+// fence in the next one, so every part is balanced on its own.
+func SplitText(text string, limit int) []string {
+	if TextLength(text) <= limit {
+		return []string{text}
+	}
+
+	parts := make([]string, 0)
+	current := ""
+
+	flush := func() {
+		if part := strings.TrimRight(current, " \n"); strings.TrimSpace(part) != "" {
+			parts = append(parts, part)
+		}
+
+		current = ""
+	}
+
+	for _, block := range splitBlocks(text) {
+		for _, piece := range splitBlock(block, limit) {
+			if TextLength(current)+TextLength(piece) > limit {
+				flush()
+				piece = strings.TrimLeft(piece, "\n")
+			}
+
+			current += piece
+		}
+	}
+
+	flush()
+
+	return parts
+}
+
+// SplitMarkdown splits CommonMark like SplitText, but so that every part also fits the limit once
+// rendered: list indentation, table padding and link URLs make the rendered text longer than its source.
+func SplitMarkdown(text string, limit int) []string {
+	parts := make([]string, 0)
+
+	for _, part := range SplitText(text, limit) {
+		parts = append(parts, splitRendered(part, limit)...)
+	}
+
+	return parts
+}
+
+// splitRendered splits the part again, with the limit shrunk by how much rendering grows it,
+// until every piece fits. The plain text rendering is measured, it is never shorter than the HTML one.
+func splitRendered(part string, limit int) []string {
+	length := TextLength(part)
+	rendered := TextLength(RenderPlainText(part))
+
+	if rendered <= limit || length < 2 {
+		return []string{part}
+	}
+
+	sourceLimit := length * limit / rendered
+
+	if sourceLimit < 1 {
+		sourceLimit = 1
+	}
+
+	pieces := make([]string, 0)
+
+	for _, piece := range SplitText(part, sourceLimit) {
+		pieces = append(pieces, splitRendered(piece, limit)...)
+	}
+
+	return pieces
+}
+
+// TextLength measures text the way Telegram does, in UTF-16 code units.
+func TextLength(text string) int {
+	length := 0
+
+	for _, r := range text {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+
+	return length
+}
+
+// splitBlocks cuts text into paragraphs and fenced code blocks, each keeping its trailing newlines.
+func splitBlocks(text string) []string {
+	blocks := make([]string, 0)
+	current := ""
+	inCode := false
+
+	for _, line := range splitLines(text) {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), codeFence)
+
+		switch {
+		case inCode:
+			current += line
+
+			if isFence {
+				blocks = append(blocks, current)
+				current = ""
+				inCode = false
+			}
+		case isFence:
+			if current != "" {
+				blocks = append(blocks, current)
+			}
+
+			current = line
+			inCode = true
+		case strings.TrimSpace(line) == "":
+			current += line
+			blocks = append(blocks, current)
+			current = ""
+		default:
+			current += line
+		}
+	}
+
+	if current != "" {
+		blocks = append(blocks, current)
+	}
+
+	return blocks
+}
+
+// splitBlock breaks a single block into pieces that fit the limit.
+func splitBlock(block string, limit int) []string {
+	if TextLength(block) <= limit {
+		return []string{block}
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(block), codeFence) {
+		return packLines(splitLines(block), limit)
+	}
+
+	lines := splitLines(block)
+	opening := strings.TrimLeft(lines[0], " ")
+
+	if !strings.HasSuffix(opening, "\n") {
+		opening += "\n"
+	}
+
+	body := lines[1:]
+
+	if len(body) > 0 && strings.HasPrefix(strings.TrimSpace(body[len(body)-1]), codeFence) {
+		body = body[:len(body)-1]
+	}
+
+	closing := codeFence + "\n"
+	inner := limit - TextLength(opening) - TextLength(closing) - 1
+
+	if inner < 1 {
+		return packLines(lines, limit)
+	}
+
+	pieces := packLines(body, inner)
+
+	for i, piece := range pieces {
+		if !strings.HasSuffix(piece, "\n") {
+			piece += "\n"
+		}
+
+		pieces[i] = opening + piece + closing
+	}
+
+	return pieces
+}
+
+// packLines joins lines into pieces of at most limit characters, cutting overlong lines.
+func packLines(lines []string, limit int) []string {
+	pieces := make([]string, 0)
+	current := ""
+
+	for _, line := range lines {
+		for _, chunk := range splitLine(line, limit) {
+			if current != "" && TextLength(current)+TextLength(chunk) > limit {
+				pieces = append(pieces, current)
+				current = ""
+			}
+
+			current += chunk
+		}
+	}
+
+	if current != "" {
+		pieces = append(pieces, current)
+	}
+
+	return pieces
+}
+
+// splitLine cuts a line longer than limit on spaces, falling back to rune boundaries for long words.
+func splitLine(line string, limit int) []string {
+	if TextLength(line) <= limit {
+		return []string{line}
+	}
+
+	chunks := make([]string, 0)
+	current := ""
+
+	for _, word := range strings.SplitAfter(line, " ") {
+		for TextLength(word) > limit {
+			head := TruncateText(word, limit)
+			word = word[len(head):]
+
+			if current != "" {
+				chunks = append(chunks, current)
+				current = ""
+			}
+
+			chunks = append(chunks, head)
+		}
+
+		if TextLength(current)+TextLength(word) > limit {
+			chunks = append(chunks, current)
+			current = ""
+		}
+
+		current += word
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// splitLines splits text after each newline, keeping the newlines.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// TruncateText cuts the text to at most limit characters without splitting a UTF-8 rune.
+func TruncateText(text string, limit int) string {
+	length := 0
+
+	for i, r := range text {
+		size := 1
+
+		if r >= 0x10000 {
+			size = 2
+		}
+
+		if length+size > limit {
+			return text[:i]
+		}
+
+		length += size
+	}
+
+	return text
+}
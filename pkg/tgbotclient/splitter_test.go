@@ -0,0 +1,88 @@
+package tgbotclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		parts []string
+	}{
+		{
+			name:  "short",
+			text:  "hello",
+			limit: 10,
+			parts: []string{"hello"},
+		},
+		{
+			name:  "paragraphs",
+			text:  "first part\n\nsecond part",
+			limit: 15,
+			parts: []string{"first part", "second part"},
+		},
+		{
+			name:  "words",
+			text:  "one two three four",
+			limit: 9,
+			parts: []string{"one two", "three", "four"},
+		},
+		{
+			name:  "code block",
+			text:  "```go\na()\nb()\n```",
+			limit: 16,
+			parts: []string{"```go\na()\n```", "```go\nb()\n```"},
+		},
+		{
+			name:  "runes",
+			text:  "😀😀😀",
+			limit: 4,
+			parts: []string{"😀😀", "😀"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitText(tt.text, tt.limit)
+
+			if strings.Join(parts, "|") != strings.Join(tt.parts, "|") {
+				t.Errorf("SplitText(%q, %d) = %q, want %q", tt.text, tt.limit, parts, tt.parts)
+			}
+		})
+	}
+}
+
+func TestSplitMarkdownFitsRendered(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "nested lists",
+			text: strings.Repeat("1. item\n   - nested item with some words\n     - deeper item with more words\n", 200),
+		},
+		{
+			name: "table",
+			text: "| a | b |\n|---|---|\n| a long cell that sets the width of the column | b |\n" + strings.Repeat("| x | y |\n", 400),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitMarkdown(tt.text, MaxMessageLength)
+
+			if len(parts) < 2 {
+				t.Fatalf("got %d parts", len(parts))
+			}
+
+			for i, part := range parts {
+				if length := TextLength(RenderPlainText(part)); length > MaxMessageLength {
+					t.Errorf("part %d is %d characters long once rendered", i, length)
+				}
+			}
+		})
+	}
+}
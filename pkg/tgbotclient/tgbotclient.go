@@ -8,8 +8,12 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// MaxMessageLength is the maximum length of a Telegram text message.
+const MaxMessageLength = 4096
+
 type TgBotClient struct {
 	*tgbotapi.BotAPI
+	topics *topics
 }
 
 func NewTgBotClient(botToken string, debug bool) (*TgBotClient, error) {
@@ -22,7 +26,12 @@ func NewTgBotClient(botToken string, debug bool) (*TgBotClient, error) {
 
 	bot.Debug = debug
 
-	return &TgBotClient{bot}, nil
+	return NewTgBotClientWithBot(bot), nil
+}
+
+// NewTgBotClientWithBot wraps a configured bot, e.g. one talking to a test server.
+func NewTgBotClientWithBot(bot *tgbotapi.BotAPI) *TgBotClient {
+	return &TgBotClient{BotAPI: bot, topics: &topics{}}
 }
 
 func (h *TgBotClient) DeleteMessage(msg *tgbotapi.Message) (tgbotapi.Message, error) {
@@ -35,6 +44,10 @@ func (h *TgBotClient) SendChatTypingAction(chatId int64) {
 	h.BotAPI.Send(loadingMsgConfig)
 }
 
+func (h *TgBotClient) SendChatRecordVoiceAction(chatId int64) {
+	h.BotAPI.Send(tgbotapi.NewChatAction(chatId, tgbotapi.ChatRecordVoice))
+}
+
 func (h *TgBotClient) NewSystemReply(message *tgbotapi.Message, text string) (tgbotapi.Message, error) {
 	msgConfig := h.NewSystemMessage(message.Chat.ID, text)
 
@@ -65,12 +78,10 @@ func (h *TgBotClient) NewReplyWithFallback(
 	responseText string,
 	parseMode string,
 ) (tgbotapi.Message, error) {
-	if len(responseText) > 4096 {
-		responseText = responseText[:4096]
-	}
+	text, mode := formatText(responseText, parseMode)
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, responseText)
-	msg.ParseMode = parseMode
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = mode
 	msg.ReplyToMessageID = message.MessageID
 
 	res, err := h.Send(msg)
@@ -78,22 +89,103 @@ func (h *TgBotClient) NewReplyWithFallback(
 	if err != nil {
 		log.Println(err)
 
-		if strings.Contains(err.Error(), "can't parse entities") {
-			if parseMode == tgbotapi.ModeMarkdownV2 {
-				return h.NewReplyWithFallback(
-					message,
-					responseText,
-					tgbotapi.ModeMarkdown,
-				)
-			} else {
-				return h.NewReplyWithFallback(
-					message,
-					responseText,
-					"",
-				)
-			}
+		if isParseError(err) && parseMode != "" {
+			text, mode := fallbackText(responseText, parseMode)
+
+			return h.NewReplyWithFallback(message, text, mode)
 		}
 	}
 
 	return res, err
 }
+
+// NewRepliesWithFallback sends a long text as a chain of replies, each part answering the previous one.
+func (h *TgBotClient) NewRepliesWithFallback(
+	message *tgbotapi.Message,
+	responseText string,
+	parseMode string,
+) ([]tgbotapi.Message, error) {
+	parts := SplitText(responseText, MaxMessageLength)
+
+	if parseMode == ModeCommonMark {
+		parts = SplitMarkdown(responseText, MaxMessageLength)
+	}
+
+	replies := make([]tgbotapi.Message, 0, len(parts))
+	replyTo := message
+
+	for _, part := range parts {
+		res, err := h.NewReplyWithFallback(replyTo, part, parseMode)
+
+		if err != nil {
+			return replies, err
+		}
+
+		replies = append(replies, res)
+		replyTo = &replies[len(replies)-1]
+	}
+
+	return replies, nil
+}
+
+func (h *TgBotClient) EditMessageWithFallback(
+	chatId int64,
+	messageId int,
+	text string,
+	parseMode string,
+) (tgbotapi.Message, error) {
+	formatted, mode := formatText(text, parseMode)
+
+	msg := tgbotapi.NewEditMessageText(chatId, messageId, formatted)
+	msg.ParseMode = mode
+
+	res, err := h.Send(msg)
+
+	if err != nil {
+		if IsNotModifiedError(err) {
+			return res, nil
+		}
+
+		log.Println(err)
+
+		if isParseError(err) && parseMode != "" {
+			text, mode := fallbackText(text, parseMode)
+
+			return h.EditMessageWithFallback(chatId, messageId, text, mode)
+		}
+	}
+
+	return res, err
+}
+
+// formatText renders CommonMark into Telegram HTML, text in other parse modes is sent as is.
+func formatText(text string, parseMode string) (string, string) {
+	text = TruncateText(text, MaxMessageLength)
+
+	if parseMode == ModeCommonMark {
+		return RenderHTML(text), tgbotapi.ModeHTML
+	}
+
+	return text, parseMode
+}
+
+// fallbackText returns the text and the parse mode to retry with when Telegram could not parse the entities.
+func fallbackText(text string, parseMode string) (string, string) {
+	switch parseMode {
+	case ModeCommonMark:
+		return RenderPlainText(text), ""
+	case tgbotapi.ModeMarkdownV2:
+		return text, tgbotapi.ModeMarkdown
+	default:
+		return text, ""
+	}
+}
+
+func isParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
+// IsNotModifiedError reports an edit that would leave the message unchanged.
+func IsNotModifiedError(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
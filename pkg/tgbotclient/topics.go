@@ -0,0 +1,148 @@
+package tgbotclient
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxRememberedTopics bounds the table of message topics, the oldest entries are forgotten first.
+const maxRememberedTopics = 10000
+
+// topicMessage holds the forum topic fields of a message, which the API library does not decode.
+type topicMessage struct {
+	MessageId int `json:"message_id"`
+	Chat      struct {
+		Id int64 `json:"id"`
+	} `json:"chat"`
+	MessageThreadId int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+}
+
+type topicUpdate struct {
+	Message       *topicMessage `json:"message"`
+	EditedMessage *topicMessage `json:"edited_message"`
+	CallbackQuery *struct {
+		Message *topicMessage `json:"message"`
+	} `json:"callback_query"`
+}
+
+type messageKey struct {
+	chatId    int64
+	messageId int
+}
+
+// topics remembers the forum topic of the received messages.
+type topics struct {
+	mu      sync.Mutex
+	threads map[messageKey]int
+	order   []messageKey
+}
+
+func (t *topics) remember(message *topicMessage) {
+	if message == nil || !message.IsTopicMessage {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.threads == nil {
+		t.threads = make(map[messageKey]int)
+	}
+
+	key := messageKey{chatId: message.Chat.Id, messageId: message.MessageId}
+
+	if _, ok := t.threads[key]; !ok {
+		t.order = append(t.order, key)
+	}
+
+	t.threads[key] = message.MessageThreadId
+
+	for len(t.order) > maxRememberedTopics {
+		delete(t.threads, t.order[0])
+		t.order = t.order[1:]
+	}
+}
+
+func (t *topics) thread(chatId int64, messageId int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.threads[messageKey{chatId: chatId, messageId: messageId}]
+}
+
+// GetUpdatesChan polls updates like BotAPI.GetUpdatesChan and also remembers the forum topic
+// of every received message, see MessageThreadId.
+func (h *TgBotClient) GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	ch := make(chan tgbotapi.Update, h.Buffer)
+
+	go func() {
+		for {
+			updates, topicUpdates, err := h.getUpdates(config)
+
+			if err != nil {
+				log.Println(err)
+				log.Println("Failed to get updates, retrying in 3 seconds...")
+				time.Sleep(time.Second * 3)
+
+				continue
+			}
+
+			for i, update := range updates {
+				if update.UpdateID < config.Offset {
+					continue
+				}
+
+				config.Offset = update.UpdateID + 1
+
+				if i < len(topicUpdates) {
+					h.topics.remember(topicUpdates[i].Message)
+					h.topics.remember(topicUpdates[i].EditedMessage)
+
+					if topicUpdates[i].CallbackQuery != nil {
+						h.topics.remember(topicUpdates[i].CallbackQuery.Message)
+					}
+				}
+
+				ch <- update
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (h *TgBotClient) getUpdates(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, []topicUpdate, error) {
+	resp, err := h.Request(config)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var updates []tgbotapi.Update
+
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, nil, err
+	}
+
+	var topicUpdates []topicUpdate
+
+	if err := json.Unmarshal(resp.Result, &topicUpdates); err != nil {
+		log.Println(err)
+	}
+
+	return updates, topicUpdates, nil
+}
+
+// MessageThreadId returns the forum topic of a received message, 0 outside of topics.
+func (h *TgBotClient) MessageThreadId(message *tgbotapi.Message) int {
+	if message == nil || message.Chat == nil {
+		return 0
+	}
+
+	return h.topics.thread(message.Chat.ID, message.MessageID)
+}
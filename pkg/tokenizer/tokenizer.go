@@ -0,0 +1,87 @@
+package tokenizer
+
+import (
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+	"ibuddy_bot/pkg/llm"
+)
+
+const (
+	fallbackEncoding = "cl100k_base"
+
+	// tokensPerMessage and ReplyTokens follow the chat format accounting from the OpenAI cookbook.
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	ReplyTokens      = 3
+
+	// ImageTokens estimates an image part: a 1024x1024 image at high detail takes 765 tokens.
+	ImageTokens = 765
+)
+
+type Tokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+var (
+	tokenizers sync.Map
+)
+
+func init() {
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// ForModel returns a tokenizer for the model, falling back to cl100k_base for unknown models.
+func ForModel(model string) (*Tokenizer, error) {
+	if t, ok := tokenizers.Load(model); ok {
+		return t.(*Tokenizer), nil
+	}
+
+	encoding, err := tiktoken.EncodingForModel(model)
+
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(fallbackEncoding)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, _ := tokenizers.LoadOrStore(model, &Tokenizer{encoding: encoding})
+
+	return t.(*Tokenizer), nil
+}
+
+func (t *Tokenizer) Count(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+func (t *Tokenizer) CountMessage(message llm.Message) int {
+	count := tokensPerMessage + t.Count(message.Role) + t.Count(message.Content)
+
+	for _, part := range message.Parts {
+		if part.ImageURL != "" {
+			count += ImageTokens
+		} else {
+			count += t.Count(part.Text)
+		}
+	}
+
+	if message.Name != "" {
+		count += tokensPerName + t.Count(message.Name)
+	}
+
+	return count
+}
+
+// Truncate cuts the text to at most maxTokens tokens.
+func (t *Tokenizer) Truncate(text string, maxTokens int) string {
+	tokens := t.encoding.EncodeOrdinary(text)
+
+	if len(tokens) <= maxTokens {
+		return text
+	}
+
+	return t.encoding.Decode(tokens[:maxTokens])
+}